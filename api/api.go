@@ -4,8 +4,10 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 
+	"go.sia.tech/core/types"
 	"go.sia.tech/host-revenue-api/stats"
 	"go.sia.tech/jape"
 	"go.uber.org/zap"
@@ -16,7 +18,24 @@ type (
 	// A StatProvider provides statistics about the current state of the Sia network.
 	StatProvider interface {
 		Metrics(timestamp time.Time) (stats.ContractState, error)
+		MetricsAtHeight(height uint64) (stats.ContractState, error)
 		Periods(start, end time.Time, period string) ([]stats.ContractState, error)
+		ProofPeriods(start, end time.Time, period string) ([]stats.ProofPeriod, error)
+		Contract(id types.FileContractID) (stats.ContractLifecycle, error)
+		ContractRenewals(id types.FileContractID) ([]stats.ContractRenewal, error)
+		PendingRevenue() (stats.PendingRevenue, error)
+		RevenueForecast(days int) ([]stats.RevenueForecast, error)
+		Events(since uint64, limit int) ([]stats.ContractEvent, error)
+		Block(id types.BlockID) (stats.BlockSummary, error)
+		BlockAtHeight(height uint64) (stats.BlockSummary, error)
+
+		HostMetrics(addr types.Address, timestamp time.Time) (stats.ContractState, error)
+		HostPeriods(addr types.Address, start, end time.Time, period string) ([]stats.ContractState, error)
+		HostProofPeriods(addr types.Address, start, end time.Time, period string) ([]stats.ProofPeriod, error)
+		Hosts(start, end time.Time, sort string, limit, offset int) ([]stats.HostRevenue, error)
+
+		Distribution(kind string, start, end time.Time) ([]stats.DistributionBucket, error)
+		StoragePrices(start, end time.Time, period string) ([]stats.StoragePrice, error)
 	}
 
 	api struct {
@@ -26,11 +45,87 @@ type (
 	}
 )
 
+// decodeBasis decodes the accounting basis form value. Revenue is reported on
+// a cash basis by default.
+func decodeBasis(c jape.Context) (string, bool) {
+	basis := stats.BasisCash
+	if err := c.DecodeForm("basis", &basis); err != nil {
+		return "", false
+	}
+
+	switch basis {
+	case stats.BasisCash, stats.BasisAccrual:
+		return basis, true
+	default:
+		c.Error(fmt.Errorf("invalid basis %q", basis), http.StatusBadRequest)
+		return "", false
+	}
+}
+
+// withBasis returns the state with its revenue reported on the accounting
+// basis.
+func withBasis(state stats.ContractState, basis string) stats.ContractState {
+	if basis == stats.BasisAccrual {
+		state.Revenue = state.AccrualRevenue()
+	}
+	return state
+}
+
+// decodeHeight decodes a block height form value. The returned bool is false
+// if the value was not set.
+func decodeHeight(c jape.Context, key string) (height uint64, set bool, err error) {
+	value := c.Request.FormValue(key)
+	if value == "" {
+		return 0, false, nil
+	}
+	height, err = strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, false, c.Error(fmt.Errorf("invalid form value %q: %w", key, err), http.StatusBadRequest)
+	}
+	return height, true, nil
+}
+
+// metricsAtHeight returns the contract stats as of the block at the height,
+// writing the error to the response on failure.
+func (a *api) metricsAtHeight(c jape.Context, height uint64) (stats.ContractState, bool) {
+	state, err := a.sp.MetricsAtHeight(height)
+	if errors.Is(err, stats.ErrNotFound) {
+		c.Error(fmt.Errorf("block at height %d not found", height), http.StatusNotFound)
+		return stats.ContractState{}, false
+	} else if err != nil {
+		c.Error(err, http.StatusInternalServerError)
+		return stats.ContractState{}, false
+	}
+	return state, true
+}
+
 func (a *api) handleGetRevenue(c jape.Context) {
 	var timestamp time.Time
 	if err := c.DecodeForm("timestamp", &timestamp); err != nil {
 		return
 	}
+	height, byHeight, err := decodeHeight(c, "height")
+	if err != nil {
+		return
+	} else if byHeight && !timestamp.IsZero() {
+		c.Error(errors.New("timestamp and height are mutually exclusive"), http.StatusBadRequest)
+		return
+	}
+
+	basis, ok := decodeBasis(c)
+	if !ok {
+		return
+	}
+
+	// the state as of the block, not the containing hour
+	if byHeight {
+		state, ok := a.metricsAtHeight(c, height)
+		if !ok {
+			return
+		}
+		c.Encode(withBasis(state, basis))
+		return
+	}
 
 	if timestamp.IsZero() {
 		timestamp = time.Now()
@@ -41,27 +136,34 @@ func (a *api) handleGetRevenue(c jape.Context) {
 		c.Error(err, http.StatusInternalServerError)
 		return
 	}
-	c.Encode(state)
+	c.Encode(withBasis(state, basis))
 }
 
-func (a *api) handleGetRevenuePeriods(c jape.Context) {
-	var period string
+// decodePeriodRange decodes the period param and the start and end form
+// values, expanding the range to cover whole periods.
+func decodePeriodRange(c jape.Context) (period string, start, end time.Time, ok bool) {
 	if err := c.DecodeParam("period", &period); err != nil {
-		return
+		return "", time.Time{}, time.Time{}, false
 	}
 
-	var start, end time.Time
 	if err := c.DecodeForm("start", &start); err != nil {
-		return
+		return "", time.Time{}, time.Time{}, false
 	} else if err := c.DecodeForm("end", &end); err != nil {
-		return
+		return "", time.Time{}, time.Time{}, false
 	}
 
 	if start.IsZero() || end.IsZero() {
 		c.Error(errors.New("start and end are required"), http.StatusBadRequest)
-		return
-	} else if end.Before(start) {
+		return "", time.Time{}, time.Time{}, false
+	}
+	return expandPeriodRange(c, period, start, end)
+}
+
+// expandPeriodRange expands the range to cover whole periods.
+func expandPeriodRange(c jape.Context, period string, start, end time.Time) (string, time.Time, time.Time, bool) {
+	if end.Before(start) {
 		c.Error(errors.New("end must be after start"), http.StatusBadRequest)
+		return "", time.Time{}, time.Time{}, false
 	}
 
 	switch period {
@@ -85,6 +187,62 @@ func (a *api) handleGetRevenuePeriods(c jape.Context) {
 		end = time.Date(y, m+1, 1, 0, 0, 0, 0, end.Location())
 	default:
 		c.Error(fmt.Errorf("invalid period %q", period), http.StatusBadRequest)
+		return "", time.Time{}, time.Time{}, false
+	}
+	return period, start, end, true
+}
+
+func (a *api) handleGetRevenuePeriods(c jape.Context) {
+	// the router does not allow static routes alongside the period param, so
+	// the pending revenue and forecast routes are dispatched here
+	switch c.PathParams.ByName("period") {
+	case "pending":
+		a.handleGetPendingRevenue(c)
+		return
+	case "forecast":
+		a.handleGetRevenueForecast(c)
+		return
+	}
+
+	startHeight, byStartHeight, err := decodeHeight(c, "startHeight")
+	if err != nil {
+		return
+	}
+	endHeight, byEndHeight, err := decodeHeight(c, "endHeight")
+	if err != nil {
+		return
+	} else if byStartHeight != byEndHeight {
+		c.Error(errors.New("startHeight and endHeight are required"), http.StatusBadRequest)
+		return
+	} else if byStartHeight && endHeight < startHeight {
+		c.Error(errors.New("endHeight must be after startHeight"), http.StatusBadRequest)
+		return
+	}
+
+	var period string
+	var start, end time.Time
+	var startState, endState stats.ContractState
+	var ok bool
+	if byStartHeight {
+		// heights are resolved to the timestamps of their blocks. The range
+		// is only validated here since the store expands the timestamps to
+		// whole periods itself.
+		if err := c.DecodeParam("period", &period); err != nil {
+			return
+		} else if startState, ok = a.metricsAtHeight(c, startHeight); !ok {
+			return
+		} else if endState, ok = a.metricsAtHeight(c, endHeight); !ok {
+			return
+		} else if period, _, _, ok = expandPeriodRange(c, period, startState.Timestamp, endState.Timestamp); !ok {
+			return
+		}
+		start, end = startState.Timestamp, endState.Timestamp
+	} else if period, start, end, ok = decodePeriodRange(c); !ok {
+		return
+	}
+
+	basis, ok := decodeBasis(c)
+	if !ok {
 		return
 	}
 
@@ -93,9 +251,160 @@ func (a *api) handleGetRevenuePeriods(c jape.Context) {
 		c.Error(err, http.StatusInternalServerError)
 		return
 	}
+	if byStartHeight && len(revenue) > 0 {
+		// the first period is the state at the start block and the last
+		// period the state at the end block rather than the end of the
+		// period
+		startState.Timestamp = revenue[0].Timestamp
+		revenue[0] = startState
+		endState.Timestamp = revenue[len(revenue)-1].Timestamp
+		revenue[len(revenue)-1] = endState
+	}
+	for i := range revenue {
+		revenue[i] = withBasis(revenue[i], basis)
+	}
 	c.Encode(revenue)
 }
 
+func (a *api) handleGetPendingRevenue(c jape.Context) {
+	pending, err := a.sp.PendingRevenue()
+	if err != nil {
+		c.Error(err, http.StatusInternalServerError)
+		return
+	}
+	c.Encode(pending)
+}
+
+func (a *api) handleGetRevenueForecast(c jape.Context) {
+	days := 30
+	if err := c.DecodeForm("days", &days); err != nil {
+		return
+	} else if days <= 0 || days > 365 {
+		c.Error(errors.New("days must be between 1 and 365"), http.StatusBadRequest)
+		return
+	}
+
+	forecast, err := a.sp.RevenueForecast(days)
+	if err != nil {
+		c.Error(err, http.StatusInternalServerError)
+		return
+	}
+	c.Encode(forecast)
+}
+
+func (a *api) handleGetBurned(c jape.Context) {
+	var timestamp time.Time
+	if err := c.DecodeForm("timestamp", &timestamp); err != nil {
+		return
+	}
+
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+
+	state, err := a.sp.Metrics(timestamp)
+	if err != nil {
+		c.Error(err, http.StatusInternalServerError)
+		return
+	}
+	c.Encode(stats.ValueSnapshot{Values: state.Burned, Timestamp: state.Timestamp})
+}
+
+func (a *api) handleGetBurnedPeriods(c jape.Context) {
+	period, start, end, ok := decodePeriodRange(c)
+	if !ok {
+		return
+	}
+
+	states, err := a.sp.Periods(start, end, period)
+	if err != nil {
+		c.Error(err, http.StatusInternalServerError)
+		return
+	}
+
+	burned := make([]stats.ValueSnapshot, 0, len(states))
+	for _, state := range states {
+		burned = append(burned, stats.ValueSnapshot{Values: state.Burned, Timestamp: state.Timestamp})
+	}
+	c.Encode(burned)
+}
+
+// handleGetProofPeriods returns the contracts that matured valid or missed in
+// each period, optionally only those of the host with the payout address.
+func (a *api) handleGetProofPeriods(c jape.Context) {
+	var addr types.Address
+	if err := c.DecodeForm("address", &addr); err != nil {
+		return
+	}
+	byHost := c.Request.FormValue("address") != ""
+
+	period, start, end, ok := decodePeriodRange(c)
+	if !ok {
+		return
+	}
+
+	var proofs []stats.ProofPeriod
+	var err error
+	if byHost {
+		proofs, err = a.sp.HostProofPeriods(addr, start, end, period)
+	} else {
+		proofs, err = a.sp.ProofPeriods(start, end, period)
+	}
+	if err != nil {
+		c.Error(err, http.StatusInternalServerError)
+		return
+	}
+	c.Encode(proofs)
+}
+
+func (a *api) handleGetStoragePrices(c jape.Context) {
+	period, start, end, ok := decodePeriodRange(c)
+	if !ok {
+		return
+	}
+
+	prices, err := a.sp.StoragePrices(start, end, period)
+	if err != nil {
+		c.Error(err, http.StatusInternalServerError)
+		return
+	}
+	c.Encode(prices)
+}
+
+func (a *api) handleGetContract(c jape.Context) {
+	var id types.FileContractID
+	if err := c.DecodeParam("id", &id); err != nil {
+		return
+	}
+
+	contract, err := a.sp.Contract(id)
+	if errors.Is(err, stats.ErrNotFound) {
+		c.Error(err, http.StatusNotFound)
+		return
+	} else if err != nil {
+		c.Error(err, http.StatusInternalServerError)
+		return
+	}
+	c.Encode(contract)
+}
+
+func (a *api) handleGetContractRenewals(c jape.Context) {
+	var id types.FileContractID
+	if err := c.DecodeParam("id", &id); err != nil {
+		return
+	}
+
+	renewals, err := a.sp.ContractRenewals(id)
+	if errors.Is(err, stats.ErrNotFound) {
+		c.Error(err, http.StatusNotFound)
+		return
+	} else if err != nil {
+		c.Error(err, http.StatusInternalServerError)
+		return
+	}
+	c.Encode(renewals)
+}
+
 // NewServer returns an http.Handler that serves the API.
 func NewServer(sp StatProvider, log *zap.Logger) http.Handler {
 	a := &api{
@@ -106,6 +415,20 @@ func NewServer(sp StatProvider, log *zap.Logger) http.Handler {
 	return jape.Mux(map[string]jape.Handler{
 		"GET /metrics/revenue":                a.handleGetRevenue,
 		"GET /metrics/revenue/:period":        a.handleGetRevenuePeriods,
+		"GET /metrics/burned":                 a.handleGetBurned,
+		"GET /metrics/burned/:period":         a.handleGetBurnedPeriods,
+		"GET /metrics/distributions":          a.handleGetDistributions,
+		"GET /metrics/price/:period":          a.handleGetStoragePrices,
+		"GET /metrics/proofs/:period":         a.handleGetProofPeriods,
+		"GET /contracts/:id":                  a.handleGetContract,
+		"GET /contracts/:id/renewals":         a.handleGetContractRenewals,
+		"GET /events":                         a.handleGetEvents,
+		"GET /blocks/:id":                     a.handleGetBlock,
+		"GET /hosts":                          a.handleGetHosts,
+		"GET /hosts/:address/revenue":         a.handleGetHostRevenue,
+		"GET /hosts/:address/revenue/:period": a.handleGetHostRevenuePeriods,
+		"GET /siafunds/revenue":               a.handleGetSiafundRevenue,
+		"GET /siafunds/revenue/:period":       a.handleGetSiafundRevenuePeriods,
 		"GET /integrations/web3index/revenue": a.handleGetWeb3Index,
 	})
 }
@@ -0,0 +1,156 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.sia.tech/host-revenue-api/stats"
+	"go.uber.org/zap/zaptest"
+)
+
+// heightProvider serves hourly periods of blocks mined every 10 minutes.
+// The state at each block has one valid contract per block. Calling any other
+// method panics.
+type heightProvider struct {
+	StatProvider
+
+	genesis    time.Time
+	start, end time.Time
+}
+
+func (hp *heightProvider) MetricsAtHeight(height uint64) (stats.ContractState, error) {
+	return stats.ContractState{Valid: int(height), Timestamp: hp.genesis.Add(time.Duration(height) * 10 * time.Minute)}, nil
+}
+
+// Periods expands the range to whole periods like the store.
+func (hp *heightProvider) Periods(start, end time.Time, period string) (states []stats.ContractState, _ error) {
+	hp.start, hp.end = start, end
+	for t := stats.NormalizePeriod(start, period); !t.After(stats.NormalizePeriod(end, period)); t = t.Add(time.Hour) {
+		states = append(states, stats.ContractState{Valid: -1, Timestamp: t})
+	}
+	return states, nil
+}
+
+func TestHandleGetRevenuePeriodsByHeight(t *testing.T) {
+	hp := &heightProvider{genesis: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)}
+	srv := httptest.NewServer(NewServer(hp, zaptest.NewLogger(t)))
+	defer srv.Close()
+
+	tests := []struct {
+		name       string
+		start, end uint64
+		valid      []int
+	}{
+		{"same period", 1, 4, []int{4}},
+		{"adjacent periods", 4, 8, []int{4, 8}},
+		{"spanning periods", 2, 14, []int{2, -1, 14}},
+	}
+
+	for _, test := range tests {
+		hp.start, hp.end = time.Time{}, time.Time{}
+		resp, err := http.Get(fmt.Sprintf("%s/metrics/revenue/hourly?startHeight=%d&endHeight=%d", srv.URL, test.start, test.end))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var periods []stats.ContractState
+		if resp.StatusCode == http.StatusOK {
+			err = json.NewDecoder(resp.Body).Decode(&periods)
+		}
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		} else if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s: expected status %d, got %d", test.name, http.StatusOK, resp.StatusCode)
+		}
+
+		// the block timestamps are passed to the store unexpanded
+		startState, _ := hp.MetricsAtHeight(test.start)
+		endState, _ := hp.MetricsAtHeight(test.end)
+		if !hp.start.Equal(startState.Timestamp) || !hp.end.Equal(endState.Timestamp) {
+			t.Fatalf("%s: expected range %v to %v, got %v to %v", test.name, startState.Timestamp, endState.Timestamp, hp.start, hp.end)
+		} else if len(periods) != len(test.valid) {
+			t.Fatalf("%s: expected %d periods, got %d", test.name, len(test.valid), len(periods))
+		}
+		for i, period := range periods {
+			if period.Valid != test.valid[i] {
+				t.Fatalf("%s: expected period %d to have %d valid contracts, got %d", test.name, i, test.valid[i], period.Valid)
+			} else if expected := stats.NormalizePeriod(startState.Timestamp, stats.PeriodHourly).Add(time.Duration(i) * time.Hour); !period.Timestamp.Equal(expected) {
+				t.Fatalf("%s: expected period %d at %v, got %v", test.name, i, expected, period.Timestamp)
+			}
+		}
+	}
+}
+
+// pendingProvider serves the pending revenue and forecast. Calling any other
+// method panics.
+type pendingProvider struct {
+	StatProvider
+
+	days int
+}
+
+func (pp *pendingProvider) PendingRevenue() (stats.PendingRevenue, error) {
+	return stats.PendingRevenue{Active: 3}, nil
+}
+
+func (pp *pendingProvider) RevenueForecast(days int) ([]stats.RevenueForecast, error) {
+	pp.days = days
+	return make([]stats.RevenueForecast, days), nil
+}
+
+func TestHandleGetPendingRevenue(t *testing.T) {
+	pp := new(pendingProvider)
+	srv := httptest.NewServer(NewServer(pp, zaptest.NewLogger(t)))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/metrics/revenue/pending")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var pending stats.PendingRevenue
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, resp.StatusCode)
+	} else if err := json.NewDecoder(resp.Body).Decode(&pending); err != nil {
+		t.Fatal(err)
+	} else if pending.Active != 3 {
+		t.Fatalf("expected 3 active contracts, got %d", pending.Active)
+	}
+
+	tests := []struct {
+		query  string
+		status int
+		days   int
+	}{
+		{"", http.StatusOK, 30},
+		{"?days=7", http.StatusOK, 7},
+		{"?days=0", http.StatusBadRequest, 0},
+		{"?days=366", http.StatusBadRequest, 0},
+	}
+	for _, test := range tests {
+		pp.days = 0
+		resp, err := http.Get(srv.URL + "/metrics/revenue/forecast" + test.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var forecast []stats.RevenueForecast
+		if resp.StatusCode == http.StatusOK {
+			err = json.NewDecoder(resp.Body).Decode(&forecast)
+		}
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		} else if resp.StatusCode != test.status {
+			t.Fatalf("%q: expected status %d, got %d", test.query, test.status, resp.StatusCode)
+		} else if pp.days != test.days || len(forecast) != test.days {
+			t.Fatalf("%q: expected %d days, got %d", test.query, test.days, len(forecast))
+		}
+	}
+}
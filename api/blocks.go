@@ -0,0 +1,40 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/host-revenue-api/stats"
+	"go.sia.tech/jape"
+)
+
+// handleGetBlock returns the summary of a block. The block is identified by
+// either its height or its ID.
+func (a *api) handleGetBlock(c jape.Context) {
+	param := c.PathParams.ByName("id")
+
+	var block stats.BlockSummary
+	var err error
+	if height, perr := strconv.ParseUint(param, 10, 64); perr == nil {
+		block, err = a.sp.BlockAtHeight(height)
+	} else {
+		var id types.BlockID
+		if err := id.UnmarshalText([]byte(param)); err != nil {
+			c.Error(fmt.Errorf("invalid block height or ID %q", param), http.StatusBadRequest)
+			return
+		}
+		block, err = a.sp.Block(id)
+	}
+
+	if errors.Is(err, stats.ErrNotFound) {
+		c.Error(err, http.StatusNotFound)
+		return
+	} else if err != nil {
+		c.Error(err, http.StatusInternalServerError)
+		return
+	}
+	c.Encode(block)
+}
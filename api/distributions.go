@@ -0,0 +1,47 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.sia.tech/host-revenue-api/stats"
+	"go.sia.tech/jape"
+)
+
+// handleGetDistributions returns the active contracts and the contracts
+// resolved in the period bucketed by duration, size or payout.
+func (a *api) handleGetDistributions(c jape.Context) {
+	var kind string
+	period := "30d"
+	if err := c.DecodeForm("kind", &kind); err != nil {
+		return
+	} else if err := c.DecodeForm("period", &period); err != nil {
+		return
+	}
+
+	switch kind {
+	case stats.DistributionDuration, stats.DistributionSize, stats.DistributionPayout:
+	case "":
+		c.Error(errors.New("kind is required"), http.StatusBadRequest)
+		return
+	default:
+		c.Error(fmt.Errorf("invalid kind %q", kind), http.StatusBadRequest)
+		return
+	}
+
+	window, err := parseWindow(period)
+	if err != nil {
+		c.Error(err, http.StatusBadRequest)
+		return
+	}
+
+	end := time.Now()
+	buckets, err := a.sp.Distribution(kind, end.Add(-window), end)
+	if err != nil {
+		c.Error(err, http.StatusInternalServerError)
+		return
+	}
+	c.Encode(buckets)
+}
@@ -0,0 +1,42 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"go.sia.tech/jape"
+)
+
+const (
+	defaultEventsLimit = 100
+	maxEventsLimit     = 1000
+)
+
+// handleGetEvents returns the contract events recorded after the since
+// cursor. The ID of the last event is the cursor of the next page.
+func (a *api) handleGetEvents(c jape.Context) {
+	var since uint64
+	if value := c.Request.FormValue("since"); value != "" {
+		var err error
+		if since, err = strconv.ParseUint(value, 10, 64); err != nil {
+			c.Error(fmt.Errorf("invalid form value %q: %w", "since", err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	limit := defaultEventsLimit
+	if err := c.DecodeForm("limit", &limit); err != nil {
+		return
+	} else if limit <= 0 || limit > maxEventsLimit {
+		c.Error(fmt.Errorf("limit must be between 1 and %d", maxEventsLimit), http.StatusBadRequest)
+		return
+	}
+
+	events, err := a.sp.Events(since, limit)
+	if err != nil {
+		c.Error(err, http.StatusInternalServerError)
+		return
+	}
+	c.Encode(events)
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.sia.tech/host-revenue-api/stats"
+	"go.uber.org/zap/zaptest"
+)
+
+// eventProvider serves the event feed. Calling any other method panics.
+type eventProvider struct {
+	StatProvider
+
+	since uint64
+	limit int
+}
+
+func (ep *eventProvider) Events(since uint64, limit int) ([]stats.ContractEvent, error) {
+	ep.since, ep.limit = since, limit
+	return []stats.ContractEvent{{ID: since + 1, Kind: stats.EventContractFormed}}, nil
+}
+
+func TestHandleGetEvents(t *testing.T) {
+	ep := new(eventProvider)
+	srv := httptest.NewServer(NewServer(ep, zaptest.NewLogger(t)))
+	defer srv.Close()
+
+	tests := []struct {
+		query  string
+		status int
+		since  uint64
+		limit  int
+	}{
+		{"", http.StatusOK, 0, defaultEventsLimit},
+		{"?since=9223372036854775808&limit=10", http.StatusOK, 1 << 63, 10},
+		{"?since=41", http.StatusOK, 41, defaultEventsLimit},
+		{"?since=-1", http.StatusBadRequest, 0, 0},
+		{"?since=abc", http.StatusBadRequest, 0, 0},
+		{"?limit=0", http.StatusBadRequest, 0, 0},
+		{"?limit=1001", http.StatusBadRequest, 0, 0},
+	}
+
+	for _, test := range tests {
+		ep.since, ep.limit = 0, 0
+		resp, err := http.Get(srv.URL + "/events" + test.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var events []stats.ContractEvent
+		if resp.StatusCode == http.StatusOK {
+			err = json.NewDecoder(resp.Body).Decode(&events)
+		}
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		} else if resp.StatusCode != test.status {
+			t.Fatalf("%q: expected status %d, got %d", test.query, test.status, resp.StatusCode)
+		} else if ep.since != test.since || ep.limit != test.limit {
+			t.Fatalf("%q: expected since %d and limit %d, got %d and %d", test.query, test.since, test.limit, ep.since, ep.limit)
+		} else if test.status == http.StatusOK && (len(events) != 1 || events[0].ID != test.since+1) {
+			t.Fatalf("%q: expected the event after %d, got %+v", test.query, test.since, events)
+		}
+	}
+}
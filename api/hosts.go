@@ -0,0 +1,142 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/host-revenue-api/stats"
+	"go.sia.tech/jape"
+)
+
+const (
+	defaultHostsLimit = 100
+	maxHostsLimit     = 500
+)
+
+// parseWindow parses a window of the form <n>h, <n>d or <n>w.
+func parseWindow(s string) (time.Duration, error) {
+	if len(s) < 2 {
+		return 0, fmt.Errorf("invalid period %q", s)
+	}
+
+	var unit time.Duration
+	switch s[len(s)-1] {
+	case 'h':
+		unit = time.Hour
+	case 'd':
+		unit = 24 * time.Hour
+	case 'w':
+		unit = 7 * 24 * time.Hour
+	default:
+		return 0, fmt.Errorf("invalid period %q", s)
+	}
+
+	n, err := strconv.ParseUint(s[:len(s)-1], 10, 16)
+	if err != nil || n == 0 {
+		return 0, fmt.Errorf("invalid period %q", s)
+	}
+	return time.Duration(n) * unit, nil
+}
+
+func (a *api) handleGetHosts(c jape.Context) {
+	sort, period := stats.HostSortRevenue, "30d"
+	limit, offset := defaultHostsLimit, 0
+	if err := c.DecodeForm("sort", &sort); err != nil {
+		return
+	} else if err := c.DecodeForm("period", &period); err != nil {
+		return
+	} else if err := c.DecodeForm("limit", &limit); err != nil {
+		return
+	} else if err := c.DecodeForm("offset", &offset); err != nil {
+		return
+	}
+
+	switch sort {
+	case stats.HostSortRevenue, stats.HostSortContracts, stats.HostSortSuccessRatio:
+	default:
+		c.Error(fmt.Errorf("invalid sort %q", sort), http.StatusBadRequest)
+		return
+	}
+
+	window, err := parseWindow(period)
+	if err != nil {
+		c.Error(err, http.StatusBadRequest)
+		return
+	} else if limit <= 0 || limit > maxHostsLimit {
+		c.Error(fmt.Errorf("limit must be between 1 and %d", maxHostsLimit), http.StatusBadRequest)
+		return
+	} else if offset < 0 {
+		c.Error(errors.New("offset must be non-negative"), http.StatusBadRequest)
+		return
+	}
+
+	end := time.Now()
+	hosts, err := a.sp.Hosts(end.Add(-window), end, sort, limit, offset)
+	if err != nil {
+		c.Error(err, http.StatusInternalServerError)
+		return
+	}
+	c.Encode(hosts)
+}
+
+func (a *api) handleGetHostRevenue(c jape.Context) {
+	var addr types.Address
+	if err := c.DecodeParam("address", &addr); err != nil {
+		return
+	}
+
+	var timestamp time.Time
+	if err := c.DecodeForm("timestamp", &timestamp); err != nil {
+		return
+	}
+
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+
+	basis, ok := decodeBasis(c)
+	if !ok {
+		return
+	}
+
+	state, err := a.sp.HostMetrics(addr, timestamp)
+	if errors.Is(err, stats.ErrNotFound) {
+		c.Error(err, http.StatusNotFound)
+		return
+	} else if err != nil {
+		c.Error(err, http.StatusInternalServerError)
+		return
+	}
+	c.Encode(withBasis(state, basis))
+}
+
+func (a *api) handleGetHostRevenuePeriods(c jape.Context) {
+	var addr types.Address
+	if err := c.DecodeParam("address", &addr); err != nil {
+		return
+	}
+
+	period, start, end, ok := decodePeriodRange(c)
+	if !ok {
+		return
+	}
+
+	basis, ok := decodeBasis(c)
+	if !ok {
+		return
+	}
+
+	revenue, err := a.sp.HostPeriods(addr, start, end, period)
+	if err != nil {
+		c.Error(err, http.StatusInternalServerError)
+		return
+	}
+	for i := range revenue {
+		revenue[i] = withBasis(revenue[i], basis)
+	}
+	c.Encode(revenue)
+}
@@ -0,0 +1,46 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"go.sia.tech/host-revenue-api/stats"
+	"go.sia.tech/jape"
+)
+
+func (a *api) handleGetSiafundRevenue(c jape.Context) {
+	var timestamp time.Time
+	if err := c.DecodeForm("timestamp", &timestamp); err != nil {
+		return
+	}
+
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+
+	state, err := a.sp.Metrics(timestamp)
+	if err != nil {
+		c.Error(err, http.StatusInternalServerError)
+		return
+	}
+	c.Encode(stats.ValueSnapshot{Values: state.SiafundTax, Timestamp: state.Timestamp})
+}
+
+func (a *api) handleGetSiafundRevenuePeriods(c jape.Context) {
+	period, start, end, ok := decodePeriodRange(c)
+	if !ok {
+		return
+	}
+
+	states, err := a.sp.Periods(start, end, period)
+	if err != nil {
+		c.Error(err, http.StatusInternalServerError)
+		return
+	}
+
+	revenue := make([]stats.ValueSnapshot, 0, len(states))
+	for _, state := range states {
+		revenue = append(revenue, stats.ValueSnapshot{Values: state.SiafundTax, Timestamp: state.Timestamp})
+	}
+	c.Encode(revenue)
+}
@@ -28,6 +28,8 @@ var (
 	dir       string
 	bootstrap bool
 
+	confirmations = sqlite.DefaultConfirmations
+
 	logStdout bool
 	logLevel  string
 
@@ -40,6 +42,7 @@ func init() {
 	flag.StringVar(&gatewayAddr, "gateway", defaultGatewayAddr, "gateway address")
 	flag.StringVar(&apiAddr, "api", defaultAPIAddr, "api address")
 	flag.BoolVar(&bootstrap, "bootstrap", true, "bootstrap the network")
+	flag.Uint64Var(&confirmations, "confirmations", sqlite.DefaultConfirmations, "number of blocks a payout must be buried before it is recognized")
 	flag.BoolVar(&logStdout, "log.stdout", true, "log to stdout")
 	flag.StringVar(&logLevel, "log.level", "debug", "log level")
 	flag.Parse()
@@ -104,6 +107,20 @@ func main() {
 		)
 	}))
 
+	// re-estimate contracts instead of starting the indexer
+	if flag.Arg(0) == "recompute" {
+		db, err := sqlite.OpenDatabase(filepath.Join(dir, "revenue.sqlite3"), confirmations, log.Named("sqlite3"))
+		if err != nil {
+			log.Panic("failed to open database", zap.Error(err))
+		}
+		defer db.Close()
+
+		if err := runRecompute(db, flag.Args()[1:]); err != nil {
+			log.Panic("failed to recompute", zap.Error(err))
+		}
+		return
+	}
+
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
 	defer cancel()
 
@@ -150,7 +167,7 @@ func main() {
 	}
 	defer tp.Close()
 
-	db, err := sqlite.OpenDatabase(filepath.Join(dir, "revenue.sqlite3"), log.Named("sqlite3"))
+	db, err := sqlite.OpenDatabase(filepath.Join(dir, "revenue.sqlite3"), confirmations, log.Named("sqlite3"))
 	if err != nil {
 		log.Panic("failed to open database", zap.Error(err))
 	}
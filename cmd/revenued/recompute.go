@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/shopspring/decimal"
+	"go.sia.tech/core/types"
+	"go.sia.tech/host-revenue-api/persist/sqlite"
+)
+
+// siacoins converts a currency from hastings to siacoins.
+func siacoins(c types.Currency) decimal.Decimal {
+	return decimal.NewFromBigInt(c.Big(), -24)
+}
+
+// printRecomputeReport prints how the totals changed when contracts were
+// re-estimated.
+func printRecomputeReport(report sqlite.RecomputeReport) {
+	fmt.Printf("re-estimated %d contracts with estimator v%d, %d changed\n", report.Contracts, report.EstimatorVersion, report.Changed)
+
+	before, after := report.Before, report.After
+	rows := []struct {
+		name          string
+		before, after decimal.Decimal
+	}{
+		{"revenue (SC)", siacoins(before.Revenue.SC), siacoins(after.Revenue.SC)},
+		{"revenue (USD)", before.Revenue.USD, after.Revenue.USD},
+		{"revenue (EUR)", before.Revenue.EUR, after.Revenue.EUR},
+		{"revenue (BTC)", before.Revenue.BTC, after.Revenue.BTC},
+		{"locked collateral (SC)", siacoins(before.Collateral.Locked), siacoins(after.Collateral.Locked)},
+		{"estimated contracts", decimal.NewFromInt(int64(before.Estimates.Estimated)), decimal.NewFromInt(int64(after.Estimates.Estimated))},
+		{"skipped contracts", decimal.NewFromInt(int64(before.Estimates.Skipped)), decimal.NewFromInt(int64(after.Estimates.Skipped))},
+		{"failed contracts", decimal.NewFromInt(int64(before.Estimates.Failed)), decimal.NewFromInt(int64(after.Estimates.Failed))},
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "\tbefore\tafter\tdiff\t")
+	for _, row := range rows {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t\n", row.name, row.before, row.after, row.after.Sub(row.before))
+	}
+	w.Flush()
+}
+
+// runRecompute re-estimates the contracts estimated by an older estimator and
+// re-derives the stats that depend on them. The changes are printed and only
+// committed once confirmed.
+func runRecompute(db *sqlite.Store, args []string) error {
+	fs := flag.NewFlagSet("recompute", flag.ExitOnError)
+	yes := fs.Bool("yes", false, "commit the changes without confirmation")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	report, err := db.Recompute(func(report sqlite.RecomputeReport) bool {
+		printRecomputeReport(report)
+		if report.Contracts == 0 {
+			return false
+		} else if *yes {
+			return true
+		}
+
+		fmt.Print("commit changes? [y/N] ")
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		answer = strings.ToLower(strings.TrimSpace(answer))
+		return answer == "y" || answer == "yes"
+	})
+	if err != nil {
+		return fmt.Errorf("failed to recompute: %w", err)
+	}
+
+	if report.Committed {
+		fmt.Println("changes committed")
+	} else {
+		fmt.Println("no changes committed")
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/host-revenue-api/stats"
+)
+
+// blockContracts returns the IDs of the contracts matching the query.
+func blockContracts(tx txn, query string, args ...any) (ids []types.FileContractID, err error) {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids = []types.FileContractID{}
+	for rows.Next() {
+		var id types.FileContractID
+		if err := rows.Scan((*sqlHash256)(&id)); err != nil {
+			return nil, fmt.Errorf("failed to scan contract id: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// blockSummary returns the summary of the block matching the where clause.
+// Resolved contracts are pruned from the active contracts, so both the active
+// and archived contracts are searched.
+func blockSummary(tx txn, where string, arg any) (b stats.BlockSummary, err error) {
+	var blockID int64
+	err = tx.QueryRow(`SELECT id, block_id, height, date_created FROM blocks WHERE `+where, arg).Scan(&blockID, (*sqlHash256)(&b.ID), &b.Height, (*sqlTime)(&b.Timestamp))
+	if errors.Is(err, sql.ErrNoRows) {
+		return stats.BlockSummary{}, stats.ErrNotFound
+	} else if err != nil {
+		return stats.BlockSummary{}, fmt.Errorf("failed to get block: %w", err)
+	}
+
+	b.Formed, err = blockContracts(tx, `SELECT contract_id FROM active_contracts WHERE block_id=$1
+UNION SELECT contract_id FROM archived_contracts WHERE block_id=$1`, blockID)
+	if err != nil {
+		return stats.BlockSummary{}, fmt.Errorf("failed to get formed contracts: %w", err)
+	}
+	b.Revised, err = blockContracts(tx, `SELECT DISTINCT contract_id FROM contract_revisions WHERE block_id=$1`, blockID)
+	if err != nil {
+		return stats.BlockSummary{}, fmt.Errorf("failed to get revised contracts: %w", err)
+	}
+	b.Proven, err = blockContracts(tx, `SELECT contract_id FROM active_contracts WHERE proof_block_id=$1
+UNION SELECT contract_id FROM archived_contracts WHERE proof_block_id=$1`, blockID)
+	if err != nil {
+		return stats.BlockSummary{}, fmt.Errorf("failed to get proven contracts: %w", err)
+	}
+	b.MaturedValid, err = blockContracts(tx, `SELECT contract_id FROM archived_contracts WHERE resolved_block_id=$1 AND valid`, blockID)
+	if err != nil {
+		return stats.BlockSummary{}, fmt.Errorf("failed to get valid contracts: %w", err)
+	}
+	b.MaturedMissed, err = blockContracts(tx, `SELECT contract_id FROM archived_contracts WHERE resolved_block_id=$1 AND NOT valid`, blockID)
+	if err != nil {
+		return stats.BlockSummary{}, fmt.Errorf("failed to get missed contracts: %w", err)
+	}
+
+	delta, err := blockStats(tx, blockID)
+	if err != nil {
+		return stats.BlockSummary{}, fmt.Errorf("failed to get block stats: %w", err)
+	}
+	b.Revenue, b.Payout = delta.Revenue, delta.Payout
+	return b, nil
+}
+
+// Block returns the summary of the block with the ID.
+func (s *Store) Block(id types.BlockID) (b stats.BlockSummary, err error) {
+	err = s.transaction(func(tx txn) error {
+		b, err = blockSummary(tx, `block_id=$1`, sqlHash256(id))
+		return err
+	})
+	b.Confirmations = s.confirmations
+	return
+}
+
+// BlockAtHeight returns the summary of the block at the height.
+func (s *Store) BlockAtHeight(height uint64) (b stats.BlockSummary, err error) {
+	err = s.transaction(func(tx txn) error {
+		b, err = blockSummary(tx, `height=$1`, height)
+		return err
+	})
+	b.Confirmations = s.confirmations
+	return
+}
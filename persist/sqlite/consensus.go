@@ -10,6 +10,7 @@ import (
 
 	"github.com/shopspring/decimal"
 	"gitlab.com/NebulousLabs/encoding"
+	"go.sia.tech/core/consensus"
 	"go.sia.tech/core/types"
 	"go.sia.tech/host-revenue-api/stats"
 	"go.sia.tech/siad/modules"
@@ -18,9 +19,40 @@ import (
 )
 
 var (
-	maturityDelay = uint64(stypes.MaturityDelay)
+	// DefaultConfirmations is the number of blocks a contract's proof window
+	// or storage proof must be buried before its payout is recognized. It
+	// matches the maturity delay of the payout outputs.
+	DefaultConfirmations = uint64(stypes.MaturityDelay)
 )
 
+// Confirmations returns the number of confirmations the store recognizes
+// payouts at.
+func (s *Store) Confirmations() uint64 {
+	return s.confirmations
+}
+
+// setConfirmations sets the number of confirmations the database is indexed
+// at. The stats depend on the depth payouts were recognized at, so the depth
+// cannot be changed once blocks have been indexed.
+func (s *Store) setConfirmations(confirmations uint64) error {
+	return s.transaction(func(tx txn) error {
+		var indexed bool
+		var current sql.NullInt64
+		err := tx.QueryRow(`SELECT contracts_last_processed_change IS NOT NULL, confirmations FROM global_settings`).Scan(&indexed, &current)
+		if err != nil {
+			return fmt.Errorf("failed to get confirmations: %w", err)
+		} else if indexed && current.Valid && uint64(current.Int64) != confirmations {
+			return fmt.Errorf("database was indexed with %d confirmations, cannot use %d without reindexing", current.Int64, confirmations)
+		}
+
+		if _, err := tx.Exec(`UPDATE global_settings SET confirmations=$1`, confirmations); err != nil {
+			return fmt.Errorf("failed to set confirmations: %w", err)
+		}
+		s.confirmations = confirmations
+		return nil
+	})
+}
+
 // LastChange returns the last consensus change processed by the store.
 func (s *Store) LastChange() (ccID modules.ConsensusChangeID, err error) {
 	value := nullable((*sqlHash256)(&ccID))
@@ -33,11 +65,15 @@ func (s *Store) LastChange() (ccID modules.ConsensusChangeID, err error) {
 	return
 }
 
+// errNoExchangeRate is returned by getExchangeRate when there is no market
+// data.
+var errNoExchangeRate = errors.New("no exchange rate data")
+
 func getExchangeRate(tx txn, timestamp time.Time) (usd, eur, btc decimal.Decimal, err error) {
 	err = tx.QueryRow(`SELECT usd_rate, eur_rate, btc_rate FROM market_data ORDER BY ABS(date_created - $1) LIMIT 1`, sqlTime(timestamp)).Scan(
 		&usd, &eur, &btc)
 	if errors.Is(err, sql.ErrNoRows) {
-		return decimal.Zero, decimal.Zero, decimal.Zero, errors.New("no exchange rate data")
+		return decimal.Zero, decimal.Zero, decimal.Zero, errNoExchangeRate
 	} else if err != nil {
 		return decimal.Zero, decimal.Zero, decimal.Zero, err
 	}
@@ -50,9 +86,8 @@ func (s *Store) ProcessConsensusChange(cc modules.ConsensusChange) {
 
 	err := s.transaction(func(tx txn) error {
 		for _, reverted := range cc.RevertedBlocks {
-			// note: since the stats are incremented only afer the payout matures,
-			// there's no need to revert them when a block is reverted. The
-			// payout value should still be the same.
+			// each block stores the exact stat delta it contributed, reverting
+			// the block subtracts the delta from the stats.
 			blockID := types.BlockID(reverted.ID())
 			if err := revertBlock(tx, blockID); err != nil {
 				return fmt.Errorf("failed to revert block %q: %w", blockID, err)
@@ -60,15 +95,16 @@ func (s *Store) ProcessConsensusChange(cc modules.ConsensusChange) {
 			log.Debug("reverted block", zap.Stringer("blockID", blockID))
 		}
 
-		spentUtxoValues := make(map[types.SiacoinOutputID]types.Currency)
+		spentUtxos := make(map[types.SiacoinOutputID]siacoinElement)
 		for _, diff := range cc.AppliedDiffs {
 			for _, scod := range diff.SiacoinOutputDiffs {
 				if scod.Direction != modules.DiffRevert {
 					continue
 				}
-				var spent types.Currency
-				convertToCore(scod.SiacoinOutput.Value, &spent)
-				spentUtxoValues[types.SiacoinOutputID(scod.ID)] = spent
+				var spent siacoinElement
+				convertToCore(scod.SiacoinOutput.Value, &spent.Value)
+				spent.Address = types.Address(scod.SiacoinOutput.UnlockHash)
+				spentUtxos[types.SiacoinOutputID(scod.ID)] = spent
 			}
 		}
 
@@ -82,22 +118,39 @@ func (s *Store) ProcessConsensusChange(cc modules.ConsensusChange) {
 				return fmt.Errorf("failed to add block %q: %w", applied.ID(), err)
 			}
 
-			var active int
+			// the stat changes of the block, network-wide and for each host
+			var delta statDelta
+			hostDeltas := make(map[types.Address]statDelta)
+			updateDelta := func(addr types.Address, fn func(*statDelta)) {
+				fn(&delta)
+				if addr == (types.Address{}) {
+					return
+				}
+				hd := hostDeltas[addr]
+				fn(&hd)
+				hostDeltas[addr] = hd
+			}
+			// newEvent returns a contract event observed in the block
+			newEvent := func(kind string, id types.FileContractID) stats.ContractEvent {
+				return stats.ContractEvent{Kind: kind, ContractID: &id, BlockID: blockID, Height: height, Timestamp: timestamp}
+			}
+
 			for _, txn := range applied.Transactions {
-				var inputs []types.Currency
+				var inputs []siacoinElement
 				for _, input := range txn.SiacoinInputs {
-					value, ok := spentUtxoValues[types.SiacoinOutputID(input.ParentID)]
+					spent, ok := spentUtxos[types.SiacoinOutputID(input.ParentID)]
 					if !ok {
 						log.Panic("missing spent utxo value", zap.Stringer("utxoID", input.ParentID))
 					}
-					inputs = append(inputs, value)
+					inputs = append(inputs, spent)
 				}
 
-				var outputs []types.Currency
+				var outputs []siacoinElement
 				for _, output := range txn.SiacoinOutputs {
-					var value types.Currency
-					convertToCore(output.Value, &value)
-					outputs = append(outputs, value)
+					var sce siacoinElement
+					convertToCore(output.Value, &sce.Value)
+					sce.Address = types.Address(output.UnlockHash)
+					outputs = append(outputs, sce)
 				}
 
 				var fees types.Currency
@@ -107,105 +160,221 @@ func (s *Store) ProcessConsensusChange(cc modules.ConsensusChange) {
 					fees = fees.Add(value)
 				}
 
+				// contract transactions are valued at the block's exchange
+				// rate
+				var usdRate, eurRate, btcRate decimal.Decimal
+				if len(txn.FileContracts) > 0 || len(txn.FileContractRevisions) > 0 {
+					usdRate, eurRate, btcRate, err = getExchangeRate(tx, timestamp)
+					if err != nil {
+						return fmt.Errorf("failed to get exchange rate: %w", err)
+					}
+				}
+
+				if len(txn.FileContracts) > 0 {
+					minerFees := fiatValues(fees, usdRate, eurRate, btcRate)
+
+					// the fees are only attributed to a host if the
+					// transaction forms a single contract
+					var addr types.Address
+					if len(txn.FileContracts) == 1 {
+						var contract types.FileContract
+						convertToCore(txn.FileContracts[0], &contract)
+						addr, _ = hostAddress(contract)
+					}
+					updateDelta(addr, func(sd *statDelta) {
+						sd.MinerFees = sd.MinerFees.Add(minerFees)
+					})
+				}
+
 				for i, fc := range txn.FileContracts {
 					fcID := types.FileContractID(txn.FileContractID(uint64(i)))
 
 					var contract types.FileContract
 					convertToCore(fc, &contract)
 
-					// attempt to calculate the initial revenue for renewals.
-					// This isn't guaranteed to be correct, but it's better than
-					// nothing.
-					var initialValidRevenue, initialMissedRevenue types.Currency
-					if len(contract.ValidProofOutputs) >= 2 && len(contract.MissedProofOutputs) >= 2 && len(txn.FileContracts) == 1 { // ignore weird transactions with multiple contracts
-						renterTarget := contract.ValidProofOutputs[0].Value.Add(fees)
-						hostTarget := contract.MissedProofOutputs[1].Value
-
-						hostFunds, ok := estimateHostFunds(inputs, outputs, renterTarget, hostTarget)
-						if ok {
-							v, underflow := contract.ValidHostPayout().SubWithUnderflow(hostFunds)
-							if !underflow {
-								initialValidRevenue = v
-							}
+					// attempt to calculate the initial revenue for renewals
+					estimate := estimateContract(contract, inputs, outputs, fees, len(txn.FileContracts))
+
+					// the siafund tax is paid to the siafund pool when the
+					// contract is formed
+					tax := fiatValues(siafundTax(s.network, contract, height), usdRate, eurRate, btcRate)
 
-							v, underflow = contract.MissedHostPayout().SubWithUnderflow(hostFunds)
-							if !underflow {
-								initialMissedRevenue = v
+					if err := addActiveContract(tx, fcID, contract, blockDBID, estimate, tax.SC); err != nil {
+						return fmt.Errorf("failed to add active contract %q: %w", fcID, err)
+					} else if err := addContractFormation(tx, fcID, contract, blockDBID, inputs, outputs, fees, len(txn.FileContracts)); err != nil {
+						return fmt.Errorf("failed to add formation of contract %q: %w", fcID, err)
+					}
+					log.Debug("added active contract", zap.Stringer("contractID", fcID), zap.Uint64("expirationHeight", contract.WindowEnd))
+
+					// renewals contain the final revision of the renewed
+					// contract alongside the new contract
+					if len(txn.FileContracts) == 1 {
+						for _, fcr := range txn.FileContractRevisions {
+							var rev types.FileContractRevision
+							convertToCore(fcr, &rev)
+							if !isRenewal(contract, rev) {
+								continue
+							} else if err := addContractRenewal(tx, rev.ParentID, fcID, blockDBID); err != nil {
+								return fmt.Errorf("failed to add renewal of contract %q: %w", rev.ParentID, err)
 							}
+							log.Debug("renewed contract", zap.Stringer("contractID", rev.ParentID), zap.Stringer("renewalID", fcID))
 						}
 					}
 
-					if err := addActiveContract(tx, fcID, contract, blockDBID, initialValidRevenue, initialMissedRevenue); err != nil {
-						return fmt.Errorf("failed to add active contract %q: %w", fcID, err)
+					// the initial revenue is earned when the contract is
+					// formed
+					var accrued stats.Values
+					if !estimate.InitialValidRevenue.IsZero() {
+						accrued = fiatValues(estimate.InitialValidRevenue, usdRate, eurRate, btcRate)
+						if err := addAccrual(tx, fcID, blockDBID, stats.AccrualFormation, accrued); err != nil {
+							return fmt.Errorf("failed to accrue revenue of contract %q: %w", fcID, err)
+						}
 					}
-					log.Debug("added active contract", zap.Stringer("contractID", fcID), zap.Uint64("expirationHeight", contract.WindowEnd))
-					active++
+
+					validPayout, missedPayout := hostPayouts(contract)
+					event := newEvent(stats.EventContractFormed, fcID)
+					event.ValidPayout, event.MissedPayout = validPayout, missedPayout
+					if err := addContractEvent(tx, event); err != nil {
+						return fmt.Errorf("failed to add formation event of contract %q: %w", fcID, err)
+					}
+
+					addr, _ := hostAddress(contract)
+					updateDelta(addr, func(sd *statDelta) {
+						sd.Active++
+						sd.Stored += int64(contract.Filesize)
+						sd.Collateral.Locked = sd.Collateral.Locked.Add(estimate.HostFunds)
+						switch estimate.Status {
+						case stats.EstimateStatusEstimated:
+							sd.Estimates.Estimated++
+						case stats.EstimateStatusSkipped:
+							sd.Estimates.Skipped++
+						case stats.EstimateStatusFailed:
+							sd.Estimates.Failed++
+						}
+						sd.Collateral.Risked = sd.Collateral.Risked.Add(riskedCollateral(validPayout, missedPayout))
+						sd.SiafundTax = sd.SiafundTax.Add(tax)
+						sd.Accrued = sd.Accrued.Add(accrued)
+					})
 				}
 
 				for _, fcr := range txn.FileContractRevisions {
-					fcID := types.FileContractID(fcr.ParentID)
-
-					var validPayout, missedPayout types.Currency
-					if len(fcr.NewValidProofOutputs) >= 2 {
-						convertToCore(fcr.NewValidProofOutputs[1].Value, &validPayout)
-					}
-					if len(fcr.NewMissedProofOutputs) >= 2 {
-						convertToCore(fcr.NewMissedProofOutputs[1].Value, &missedPayout)
+					var rev types.FileContractRevision
+					convertToCore(fcr, &rev)
+					fcID := rev.ParentID
+
+					// revisions of contracts that are not indexed do not
+					// change the stats
+					prev, err := currentRevision(tx, fcID)
+					indexed := err == nil
+					if err != nil && !errors.Is(err, sql.ErrNoRows) {
+						return fmt.Errorf("failed to get contract %q: %w", fcID, err)
 					}
 
-					if err := reviseContract(tx, fcID, validPayout, missedPayout); err != nil {
+					if err := reviseContract(tx, blockDBID, rev); err != nil {
 						return fmt.Errorf("failed to revise contract %q: %w", fcID, err)
 					}
 					log.Debug("revised contract", zap.Stringer("contractID", fcID))
+
+					if indexed {
+						validPayout, missedPayout := hostPayouts(rev.FileContract)
+						event := newEvent(stats.EventContractRevised, fcID)
+						event.ValidPayout, event.MissedPayout = validPayout, missedPayout
+						if err := addContractEvent(tx, event); err != nil {
+							return fmt.Errorf("failed to add revision event of contract %q: %w", fcID, err)
+						}
+
+						// the increase of the host's valid payout is earned
+						// when the revision is confirmed. Revisions only
+						// move funds from the renter to the host in
+						// practice.
+						var accrued stats.Values
+						if v, underflow := validPayout.SubWithUnderflow(prev.FinalValid); !underflow && !v.IsZero() {
+							accrued = fiatValues(v, usdRate, eurRate, btcRate)
+							if err := addAccrual(tx, fcID, blockDBID, stats.AccrualRevision, accrued); err != nil {
+								return fmt.Errorf("failed to accrue revenue of contract %q: %w", fcID, err)
+							}
+						}
+
+						updateDelta(prev.HostAddress, func(sd *statDelta) {
+							sd.Stored += int64(rev.Filesize) - int64(prev.Filesize)
+							sd.Collateral.Risked = sd.Collateral.Risked.Add(riskedCollateral(validPayout, missedPayout)).Sub(riskedCollateral(prev.FinalValid, prev.FinalMissed))
+							sd.Accrued = sd.Accrued.Add(accrued)
+						})
+					}
 				}
 
 				for _, sco := range txn.StorageProofs {
 					if err := proveContract(tx, types.FileContractID(sco.ParentID), blockDBID); err != nil {
 						return fmt.Errorf("failed to prove contract %q: %w", sco.ParentID, err)
+					} else if err := addContractEvent(tx, newEvent(stats.EventProofSubmitted, types.FileContractID(sco.ParentID))); err != nil {
+						return fmt.Errorf("failed to add proof event of contract %q: %w", sco.ParentID, err)
 					}
 					log.Debug("proved contract", zap.Stringer("contractID", sco.ParentID))
 				}
 			}
 
-			var valid, missed int
-			var totalRevenue, totalPayout stats.Values
-			if height > maturityDelay {
+			if height > s.confirmations {
 				usdRate, eurRate, btcRate, err := getExchangeRate(tx, timestamp)
 				if err != nil {
 					return fmt.Errorf("failed to get exchange rate: %w", err)
 				}
 
-				maturedHeight := height - maturityDelay
+				maturedHeight := height - s.confirmations
 				log.Debug("expiring contracts", zap.Uint64("maturedHeight", maturedHeight))
 				// apply payouts
 				expiredContracts, err := missedContracts(tx, maturedHeight)
 				if err != nil {
 					return fmt.Errorf("failed to get expired contracts: %w", err)
 				}
-				missed = len(expiredContracts)
 
 				for _, c := range expiredContracts {
-					var revenue stats.Values
-					v, underflow := c.FinalMissed.SubWithUnderflow(c.InitialMissed) // calculate the revenue from revisions
-					if !underflow {
-						revenue.SC = v.Add(c.InitialMissedRevenue) // add the initial revenue from a renewal
-						sc := decimal.NewFromBigInt(revenue.SC.Big(), -24)
-						revenue.USD = sc.Mul(usdRate)
-						revenue.EUR = sc.Mul(eurRate)
-						revenue.BTC = sc.Mul(btcRate)
+					// the revenue from revisions and the initial revenue from
+					// a renewal
+					fees, revisions := contractRevenue(c.InitialMissed, c.FinalMissed, c.InitialMissedRevenue)
+					feeRevenue, revisionRevenue := fiatValues(fees, usdRate, eurRate, btcRate), fiatValues(revisions, usdRate, eurRate, btcRate)
+					revenue := feeRevenue.Add(revisionRevenue)
+
+					// the missed payout is paid out
+					payout := fiatValues(c.FinalMissed, usdRate, eurRate, btcRate)
+
+					// the void payout is burned
+					burned := fiatValues(c.VoidPayout, usdRate, eurRate, btcRate)
+
+					if err := resolveContract(tx, c.ID, blockDBID, false, revenue, feeRevenue, revisionRevenue, payout, burned, usdRate, eurRate, btcRate); err != nil {
+						return fmt.Errorf("failed to resolve missed contract %q: %w", c.ID, err)
 					}
 
-					// add the revenue to the total
-					totalRevenue = totalRevenue.Add(revenue)
-					// add the missed payout to the total
-					var payout stats.Values
-					payout.SC = c.FinalValid
-					sc := decimal.NewFromBigInt(payout.SC.Big(), -24)
-					payout.USD = sc.Mul(usdRate)
-					payout.EUR = sc.Mul(eurRate)
-					payout.BTC = sc.Mul(btcRate)
+					event := newEvent(stats.EventMaturedMissed, c.ID)
+					event.ValidPayout, event.MissedPayout = c.FinalValid, c.FinalMissed
+					event.Revenue, event.Payout = revenue, payout
+					if err := addContractEvent(tx, event); err != nil {
+						return fmt.Errorf("failed to add maturity event of contract %q: %w", c.ID, err)
+					}
+
+					// the revenue accrued by the contract was not earned
+					reversed, err := accruedRevenue(tx, c.ID)
+					if err != nil {
+						return fmt.Errorf("failed to get accrued revenue of contract %q: %w", c.ID, err)
+					} else if !reversed.IsZero() {
+						if err := addAccrual(tx, c.ID, blockDBID, stats.AccrualReversal, reversed); err != nil {
+							return fmt.Errorf("failed to reverse revenue of contract %q: %w", c.ID, err)
+						}
+					}
 
-					totalPayout = totalPayout.Add(payout)
+					updateDelta(c.HostAddress, func(sd *statDelta) {
+						sd.Active--
+						sd.Missed++
+						sd.Revenue = sd.Revenue.Add(revenue)
+						sd.FeeRevenue = sd.FeeRevenue.Add(feeRevenue)
+						sd.RevisionRevenue = sd.RevisionRevenue.Add(revisionRevenue)
+						sd.Payout = sd.Payout.Add(payout)
+						sd.Stored -= int64(c.Filesize)
+						sd.Collateral.Locked = sd.Collateral.Locked.Sub(c.HostFunds)
+						sd.Collateral.Risked = sd.Collateral.Risked.Sub(riskedCollateral(c.FinalValid, c.FinalMissed))
+						sd.Collateral.Burned = sd.Collateral.Burned.Add(burnedCollateral(c))
+						sd.Burned = sd.Burned.Add(burned)
+						sd.Reversed = sd.Reversed.Add(reversed)
+					})
 
 					log.Debug("missed contract", zap.Stringer("contractID", c.ID), zap.String("payout", c.FinalMissed.ExactString()), zap.String("revenue", revenue.SC.ExactString()), zap.Stringer("revenueUSD", revenue.USD), zap.Stringer("exchangeRateUSD", usdRate))
 				}
@@ -214,51 +383,68 @@ func (s *Store) ProcessConsensusChange(cc modules.ConsensusChange) {
 				if err != nil {
 					return fmt.Errorf("failed to get proven contracts: %w", err)
 				}
-				valid = len(successfulContracts)
 
 				for _, c := range successfulContracts {
-					var revenue stats.Values
-					v, underflow := c.FinalValid.SubWithUnderflow(c.InitialValid) // calculate the revenue from revisions
-					if !underflow {
-						revenue.SC = v.Add(c.InitialValidRevenue) // add the initial revenue from a renewal
-						sc := decimal.NewFromBigInt(revenue.SC.Big(), -24)
-						revenue.USD = sc.Mul(usdRate)
-						revenue.EUR = sc.Mul(eurRate)
+					// the revenue from revisions and the initial revenue from
+					// a renewal
+					fees, revisions := contractRevenue(c.InitialValid, c.FinalValid, c.InitialValidRevenue)
+					feeRevenue, revisionRevenue := fiatValues(fees, usdRate, eurRate, btcRate), fiatValues(revisions, usdRate, eurRate, btcRate)
+					revenue := feeRevenue.Add(revisionRevenue)
 
+					// the valid payout is paid out
+					payout := fiatValues(c.FinalValid, usdRate, eurRate, btcRate)
+
+					if err := resolveContract(tx, c.ID, blockDBID, true, revenue, feeRevenue, revisionRevenue, payout, stats.Values{}, usdRate, eurRate, btcRate); err != nil {
+						return fmt.Errorf("failed to resolve valid contract %q: %w", c.ID, err)
+					}
+
+					event := newEvent(stats.EventMaturedValid, c.ID)
+					event.ValidPayout, event.MissedPayout = c.FinalValid, c.FinalMissed
+					event.Revenue, event.Payout = revenue, payout
+					if err := addContractEvent(tx, event); err != nil {
+						return fmt.Errorf("failed to add maturity event of contract %q: %w", c.ID, err)
 					}
-					// add the revenue to the total
-					totalRevenue.SC = totalRevenue.SC.Add(revenue.SC)
-					totalRevenue.USD = totalRevenue.USD.Add(revenue.USD)
-					totalRevenue.EUR = totalRevenue.EUR.Add(revenue.EUR)
-					totalRevenue.BTC = totalRevenue.BTC.Add(revenue.BTC)
-
-					// add the valid payout to the total
-					var payout stats.Values
-					payout.SC = c.FinalValid
-					sc := decimal.NewFromBigInt(payout.SC.Big(), -24)
-					payout.USD = sc.Mul(usdRate)
-					payout.EUR = sc.Mul(eurRate)
-					payout.BTC = sc.Mul(btcRate)
-
-					totalPayout.SC = totalPayout.SC.Add(payout.SC)
-					totalPayout.USD = totalPayout.USD.Add(payout.USD)
-					totalPayout.EUR = totalPayout.EUR.Add(payout.EUR)
-					totalPayout.BTC = totalPayout.BTC.Add(payout.BTC)
+
+					updateDelta(c.HostAddress, func(sd *statDelta) {
+						sd.Active--
+						sd.Valid++
+						sd.Revenue = sd.Revenue.Add(revenue)
+						sd.FeeRevenue = sd.FeeRevenue.Add(feeRevenue)
+						sd.RevisionRevenue = sd.RevisionRevenue.Add(revisionRevenue)
+						sd.Payout = sd.Payout.Add(payout)
+						sd.Stored -= int64(c.Filesize)
+						sd.Collateral.Locked = sd.Collateral.Locked.Sub(c.HostFunds)
+						sd.Collateral.Risked = sd.Collateral.Risked.Sub(riskedCollateral(c.FinalValid, c.FinalMissed))
+					})
 
 					log.Debug("valid contract", zap.Stringer("contractID", c.ID), zap.String("payout", c.FinalValid.ExactString()), zap.String("revenue", revenue.SC.ExactString()), zap.Stringer("revenueUSD", revenue.USD), zap.Stringer("exchangeRateUSD", usdRate))
 				}
 			}
 
-			if err := updateContractStats(tx, active-valid-missed, valid, missed, totalRevenue, totalPayout, timestamp); err != nil {
+			if err := addBlockStats(tx, blockDBID, delta); err != nil {
+				return fmt.Errorf("failed to add block stats: %w", err)
+			} else if err := updateContractStats(tx, delta, timestamp, false); err != nil {
 				return fmt.Errorf("failed to update contract stats: %w", err)
 			}
 
+			for addr, hd := range hostDeltas {
+				if err := addBlockHostStats(tx, blockDBID, addr, hd); err != nil {
+					return fmt.Errorf("failed to add block stats for host %q: %w", addr, err)
+				} else if err := updateHostStats(tx, addr, hd, timestamp, false); err != nil {
+					return fmt.Errorf("failed to update stats for host %q: %w", addr, err)
+				}
+			}
+
 			height++
 			log.Debug("applied block", zap.Stringer("blockID", blockID), zap.Time("timestamp", timestamp))
 		}
 
-		if uint64(cc.BlockHeight) > maturityDelay {
-			if err := deleteExpired(tx, uint64(cc.BlockHeight)-maturityDelay); err != nil {
+		// resolved contracts are kept until the block that resolved them is
+		// buried deep enough that it is not expected to be reverted. A
+		// shallower confirmation depth does not shorten the reorg window.
+		pruneDepth := max(s.confirmations, DefaultConfirmations)
+		if uint64(cc.BlockHeight) > pruneDepth {
+			if err := deleteExpired(tx, uint64(cc.BlockHeight)-pruneDepth); err != nil {
 				return fmt.Errorf("failed to delete expired contracts: %w", err)
 			}
 		}
@@ -273,65 +459,96 @@ func (s *Store) ProcessConsensusChange(cc modules.ConsensusChange) {
 	}
 }
 
-func sum(values []types.Currency) (t types.Currency) {
-	for _, v := range values {
-		t = t.Add(v)
-	}
-	return
-}
-
-func estimateHostFunds(inputs, outputs []types.Currency, renterTarget, hostTarget types.Currency) (types.Currency, bool) {
-	// this is naive, but it attempts to separate the renter and host inputs
-	// and outputs using the estimated funding amounts for each party as a
-	// guide.
-	for i := range inputs {
-		renterInput, hostInput := sum(inputs[:i]), sum(inputs[i:])
-
-		for j := len(outputs); j >= 0; j-- {
-			renterOutput, hostOutput := sum(outputs[:j]), sum(outputs[j:])
-
-			// SUM(renter inputs) - SUM(renter outputs) should be greater than
-			// the miner fees + renter valid payout since the renter also pays
-			// the contract fee + initial revenue to the host payout
-			//
-			// SUM(host inputs) - SUM(host outputs) should be less than the host
-			// missed payout since the renter includes the contract fee.
-			if renterInput.Cmp(renterOutput) < 0 || hostInput.Cmp(hostOutput) < 0 {
-				continue
-			} else if renterInput.Sub(renterOutput).Cmp(renterTarget) <= 0 || hostInput.Sub(hostOutput).Cmp(hostTarget) >= 0 {
-				continue
-			}
-			return hostInput.Sub(hostOutput), true
-		}
-	}
-	return types.ZeroCurrency, false
-}
-
 func setLastChange(tx txn, ccID modules.ConsensusChangeID, height uint64) error {
 	_, err := tx.Exec(`UPDATE global_settings SET contracts_last_processed_change=$1, contracts_height=$2`, sqlHash256(ccID), height)
 	return err
 }
 
 func deleteExpired(tx txn, height uint64) error {
-	_, err := tx.Exec(`DELETE FROM active_contracts WHERE expiration_height <= $1`, height)
-	if err != nil {
-		return fmt.Errorf("failed to delete expired contracts: %w", err)
-	}
-	const query = `DELETE FROM active_contracts WHERE proof_block_id IN (SELECT id FROM blocks WHERE height <= $1)`
+	const query = `DELETE FROM active_contracts WHERE resolved_block_id IN (SELECT id FROM blocks WHERE height <= $1)`
 	if _, err := tx.Exec(query, height); err != nil {
-		return fmt.Errorf("failed to delete proven contracts: %w", err)
+		return fmt.Errorf("failed to delete resolved contracts: %w", err)
 	}
 	return nil
 }
 
 func revertBlock(tx txn, blockID types.BlockID) error {
 	var blockDBID int64
-	err := tx.QueryRow(`SELECT id FROM blocks WHERE block_id=$1`, sqlHash256(blockID)).Scan(&blockDBID)
+	var height uint64
+	var timestamp time.Time
+	err := tx.QueryRow(`SELECT id, height, date_created FROM blocks WHERE block_id=$1`, sqlHash256(blockID)).Scan(&blockDBID, &height, (*sqlTime)(&timestamp))
 	if err != nil {
 		return fmt.Errorf("failed to get block id: %w", err)
 	}
 
+	// the event feed is append-only, so the revert is recorded as events
+	proved, err := blockProofs(tx, blockID)
+	if err != nil {
+		return fmt.Errorf("failed to get proved contracts: %w", err)
+	}
+	for _, id := range proved {
+		event := stats.ContractEvent{Kind: stats.EventProofReverted, ContractID: &id, BlockID: blockID, Height: height, Timestamp: timestamp}
+		if err := addContractEvent(tx, event); err != nil {
+			return fmt.Errorf("failed to add proof revert event of contract %q: %w", id, err)
+		}
+	}
+	if err := addContractEvent(tx, stats.ContractEvent{Kind: stats.EventBlockReverted, BlockID: blockID, Height: height, Timestamp: timestamp}); err != nil {
+		return fmt.Errorf("failed to add block revert event: %w", err)
+	}
+
+	// subtract the stats added by this block
+	delta, err := blockStats(tx, blockDBID)
+	if err != nil {
+		return fmt.Errorf("failed to get block stats: %w", err)
+	} else if err := updateContractStats(tx, delta, timestamp, true); err != nil {
+		return fmt.Errorf("failed to revert contract stats: %w", err)
+	}
+
+	_, err = tx.Exec(`DELETE FROM block_contract_stats WHERE block_id=$1`, blockDBID)
+	if err != nil {
+		return fmt.Errorf("failed to delete block stats: %w", err)
+	}
+
+	hostDeltas, err := blockHostStats(tx, blockDBID)
+	if err != nil {
+		return fmt.Errorf("failed to get block host stats: %w", err)
+	}
+	for addr, hd := range hostDeltas {
+		if err := updateHostStats(tx, addr, hd, timestamp, true); err != nil {
+			return fmt.Errorf("failed to revert stats for host %q: %w", addr, err)
+		}
+	}
+
+	_, err = tx.Exec(`DELETE FROM block_host_stats WHERE block_id=$1`, blockDBID)
+	if err != nil {
+		return fmt.Errorf("failed to delete block host stats: %w", err)
+	}
+
+	_, err = tx.Exec(`DELETE FROM contract_renewals WHERE block_id=$1`, blockDBID)
+	if err != nil {
+		return fmt.Errorf("failed to delete contract renewals: %w", err)
+	}
+
+	_, err = tx.Exec(`DELETE FROM contract_accruals WHERE block_id=$1`, blockDBID)
+	if err != nil {
+		return fmt.Errorf("failed to delete contract accruals: %w", err)
+	}
+
+	_, err = tx.Exec(`DELETE FROM archived_contracts WHERE resolved_block_id=$1`, blockDBID)
+	if err != nil {
+		return fmt.Errorf("failed to delete archived contracts: %w", err)
+	}
+
+	if err := revertRevisions(tx, blockDBID); err != nil {
+		return fmt.Errorf("failed to revert revisions: %w", err)
+	}
+
 	// clear contract references to this block
+	_, err = tx.Exec(`UPDATE active_contracts SET resolved_block_id=NULL WHERE resolved_block_id=$1`, blockDBID)
+	if err != nil {
+		return fmt.Errorf("failed to unresolve active contracts: %w", err)
+	}
+
 	_, err = tx.Exec(`UPDATE active_contracts SET proof_block_id=NULL WHERE proof_block_id=$1`, blockDBID)
 	if err != nil {
 		return fmt.Errorf("failed to update active contracts: %w", err)
@@ -342,6 +559,16 @@ func revertBlock(tx txn, blockID types.BlockID) error {
 		return fmt.Errorf("failed to delete active contracts: %w", err)
 	}
 
+	_, err = tx.Exec(`DELETE FROM contract_formation_elements WHERE formation_id IN (SELECT id FROM contract_formations WHERE block_id=$1)`, blockDBID)
+	if err != nil {
+		return fmt.Errorf("failed to delete contract formation elements: %w", err)
+	}
+
+	_, err = tx.Exec(`DELETE FROM contract_formations WHERE block_id=$1`, blockDBID)
+	if err != nil {
+		return fmt.Errorf("failed to delete contract formations: %w", err)
+	}
+
 	_, err = tx.Exec(`DELETE FROM blocks WHERE id=$1`, blockDBID)
 	return err
 }
@@ -351,14 +578,13 @@ func addBlock(tx txn, blockID types.BlockID, height uint64, timestamp time.Time)
 	return
 }
 
-func addActiveContract(tx txn, id types.FileContractID, fc types.FileContract, blockID int64, initialValidRevenue, initialMissedRevenue types.Currency) error {
-	var initialValid, initialMissed types.Currency
-	if len(fc.ValidProofOutputs) >= 2 {
-		initialValid = fc.ValidHostPayout()
-	}
+func addActiveContract(tx txn, id types.FileContractID, fc types.FileContract, blockID int64, estimate fundsEstimate, tax types.Currency) error {
+	initialValid, initialMissed := hostPayouts(fc)
+	initialVoid := voidPayout(fc)
 
-	if len(fc.MissedProofOutputs) >= 2 {
-		initialMissed = fc.MissedHostPayout()
+	var addr *sqlHash256
+	if v, ok := hostAddress(fc); ok {
+		addr = (*sqlHash256)(&v)
 	}
 
 	var expirationHeight int64
@@ -368,74 +594,366 @@ func addActiveContract(tx txn, id types.FileContractID, fc types.FileContract, b
 		expirationHeight = int64(fc.WindowEnd)
 	}
 
-	_, err := tx.Exec(`INSERT INTO active_contracts (contract_id, block_id, valid_payout_value, missed_payout_value, initial_valid_payout_value, initial_missed_payout_value, initial_valid_revenue, initial_missed_revenue, expiration_height)
-VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`, sqlHash256(id), blockID, sqlCurrency(initialValid), sqlCurrency(initialMissed), sqlCurrency(initialValid), sqlCurrency(initialMissed), sqlCurrency(initialValidRevenue), sqlCurrency(initialMissedRevenue), expirationHeight)
+	_, err := tx.Exec(`INSERT INTO active_contracts (contract_id, block_id, valid_payout_value, missed_payout_value, initial_valid_payout_value, initial_missed_payout_value, initial_valid_revenue, initial_missed_revenue, expiration_height, host_address, initial_filesize, filesize, host_funds, initial_void_payout_value, void_payout_value, siafund_tax, host_funds_method, estimate_status, estimator_version)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19)`, sqlHash256(id), blockID, sqlCurrency(initialValid), sqlCurrency(initialMissed), sqlCurrency(initialValid), sqlCurrency(initialMissed), sqlCurrency(estimate.InitialValidRevenue), sqlCurrency(estimate.InitialMissedRevenue), expirationHeight, addr, sqlUint64(fc.Filesize), sqlUint64(fc.Filesize), sqlCurrency(estimate.HostFunds), sqlCurrency(initialVoid), sqlCurrency(initialVoid), sqlCurrency(tax), estimate.Method, estimate.Status, estimatorVersion)
+	return err
+}
+
+// addContractFormation stores the contract and the siacoin inputs, outputs
+// and miner fees of the transaction that formed it so that the contract can be
+// re-estimated when the estimator changes.
+func addContractFormation(tx txn, id types.FileContractID, fc types.FileContract, blockID int64, inputs, outputs []siacoinElement, fees types.Currency, count int) error {
+	var formationID int64
+	err := tx.QueryRow(`INSERT INTO contract_formations (contract_id, block_id, file_contract, miner_fees, contract_count) VALUES ($1, $2, $3, $4, $5) RETURNING id`, sqlHash256(id), blockID, sqlFileContract(fc), sqlCurrency(fees), count).Scan(&formationID)
+	if err != nil {
+		return fmt.Errorf("failed to add formation: %w", err)
+	}
+
+	stmt, err := tx.Prepare(`INSERT INTO contract_formation_elements (formation_id, output, address, value) VALUES ($1, $2, $3, $4)`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, sce := range inputs {
+		if _, err := stmt.Exec(formationID, false, sqlHash256(sce.Address), sqlCurrency(sce.Value)); err != nil {
+			return fmt.Errorf("failed to add input: %w", err)
+		}
+	}
+	for _, sce := range outputs {
+		if _, err := stmt.Exec(formationID, true, sqlHash256(sce.Address), sqlCurrency(sce.Value)); err != nil {
+			return fmt.Errorf("failed to add output: %w", err)
+		}
+	}
+	return nil
+}
+
+// isRenewal returns true if the revision finalizes a contract renewed by fc.
+func isRenewal(fc types.FileContract, rev types.FileContractRevision) bool {
+	return rev.RevisionNumber == types.MaxRevisionNumber && rev.UnlockHash == fc.UnlockHash
+}
+
+func addContractRenewal(tx txn, renewedFrom, renewedTo types.FileContractID, blockID int64) error {
+	_, err := tx.Exec(`INSERT INTO contract_renewals (renewed_from, renewed_to, block_id) VALUES ($1, $2, $3)`, sqlHash256(renewedFrom), sqlHash256(renewedTo), blockID)
 	return err
 }
 
-func reviseContract(tx txn, id types.FileContractID, validPayout, missedPayout types.Currency) error {
-	_, err := tx.Exec(`UPDATE active_contracts SET (valid_payout_value, missed_payout_value) = ($1, $2) WHERE contract_id=$3`, sqlCurrency(validPayout), sqlCurrency(missedPayout), sqlHash256(id))
+// siafundTax returns the tax paid to the siafund pool by a contract formed in
+// the block at height.
+func siafundTax(n *consensus.Network, fc types.FileContract, height uint64) types.Currency {
+	cs := consensus.State{
+		Network: n,
+		Index:   types.ChainIndex{Height: height - 1},
+	}
+	return cs.FileContractTax(fc)
+}
+
+// hostPayouts returns the host's valid and missed payouts.
+func hostPayouts(fc types.FileContract) (valid, missed types.Currency) {
+	if len(fc.ValidProofOutputs) >= 2 {
+		valid = fc.ValidHostPayout()
+	}
+	if len(fc.MissedProofOutputs) >= 2 {
+		missed = fc.MissedHostPayout()
+	}
+	return
+}
+
+// voidPayout returns the value of the missed proof outputs sent to the void
+// address. It is burned if the contract misses its storage proof.
+func voidPayout(fc types.FileContract) (v types.Currency) {
+	for _, sco := range fc.MissedProofOutputs {
+		if sco.Address == types.VoidAddress {
+			v = v.Add(sco.Value)
+		}
+	}
+	return
+}
+
+// hostAddress returns the host's payout address from the contract's proof
+// outputs.
+func hostAddress(fc types.FileContract) (types.Address, bool) {
+	switch {
+	case len(fc.ValidProofOutputs) >= 2:
+		return fc.ValidHostOutput().Address, true
+	case len(fc.MissedProofOutputs) >= 2:
+		return fc.MissedHostOutput().Address, true
+	}
+	return types.Address{}, false
+}
+
+// currentRevision returns the host address, payouts and filesize of an
+// active contract.
+func currentRevision(tx txn, id types.FileContractID) (c stats.Contract, err error) {
+	const query = `SELECT host_address, valid_payout_value, missed_payout_value, filesize FROM active_contracts WHERE contract_id=$1`
+	err = tx.QueryRow(query, sqlHash256(id)).Scan(nullable((*sqlHash256)(&c.HostAddress)), (*sqlCurrency)(&c.FinalValid), (*sqlCurrency)(&c.FinalMissed), (*sqlUint64)(&c.Filesize))
+	c.ID = id
+	return
+}
+
+func reviseContract(tx txn, blockID int64, rev types.FileContractRevision) error {
+	validPayout, missedPayout := hostPayouts(rev.FileContract)
+	void := voidPayout(rev.FileContract)
+
+	const query = `INSERT INTO contract_revisions (contract_id, block_id, revision_number, valid_payout_value, missed_payout_value, void_payout_value, filesize) VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	if _, err := tx.Exec(query, sqlHash256(rev.ParentID), blockID, sqlUint64(rev.RevisionNumber), sqlCurrency(validPayout), sqlCurrency(missedPayout), sqlCurrency(void), sqlUint64(rev.Filesize)); err != nil {
+		return fmt.Errorf("failed to add revision: %w", err)
+	}
+	_, err := tx.Exec(`UPDATE active_contracts SET (valid_payout_value, missed_payout_value, void_payout_value, filesize) = ($1, $2, $3, $4) WHERE contract_id=$5`, sqlCurrency(validPayout), sqlCurrency(missedPayout), sqlCurrency(void), sqlUint64(rev.Filesize), sqlHash256(rev.ParentID))
 	return err
 }
 
+// contractRevenue returns the revenue of a contract split into the initial
+// revenue from its contract fees and the revenue from its revisions. No revenue
+// is earned if the revisions decreased the payout.
+func contractRevenue(initial, final, initialRevenue types.Currency) (fees, revisions types.Currency) {
+	v, underflow := final.SubWithUnderflow(initial)
+	if underflow {
+		return types.ZeroCurrency, types.ZeroCurrency
+	}
+	return initialRevenue, v
+}
+
+// riskedCollateral returns the amount the host loses if the contract misses
+// its storage proof.
+func riskedCollateral(validPayout, missedPayout types.Currency) types.Currency {
+	v, underflow := validPayout.SubWithUnderflow(missedPayout)
+	if underflow {
+		return types.ZeroCurrency
+	}
+	return v
+}
+
+// burnedCollateral returns the host collateral sent to the void by a contract
+// that missed its storage proof. Revisions move collateral from the host's
+// missed payout to the void.
+func burnedCollateral(c stats.Contract) types.Currency {
+	v, underflow := c.InitialMissed.SubWithUnderflow(c.FinalMissed)
+	if underflow {
+		return types.ZeroCurrency
+	}
+	return v
+}
+
+// revertRevisions removes the revisions confirmed in a block and resets the
+// payouts and filesize of the revised contracts to their previous revision.
+func revertRevisions(tx txn, blockID int64) error {
+	rows, err := tx.Query(`SELECT DISTINCT contract_id FROM contract_revisions WHERE block_id=$1`, blockID)
+	if err != nil {
+		return fmt.Errorf("failed to query revisions: %w", err)
+	}
+	defer rows.Close()
+
+	var revised []types.FileContractID
+	for rows.Next() {
+		var id types.FileContractID
+		if err := rows.Scan((*sqlHash256)(&id)); err != nil {
+			return fmt.Errorf("failed to scan contract id: %w", err)
+		}
+		revised = append(revised, id)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to query revisions: %w", err)
+	}
+	rows.Close()
+
+	if _, err := tx.Exec(`DELETE FROM contract_revisions WHERE block_id=$1`, blockID); err != nil {
+		return fmt.Errorf("failed to delete revisions: %w", err)
+	}
+
+	// revisions are applied in order, so the latest remaining revision is the
+	// current state of the contract. If there are no remaining revisions, the
+	// contract is reset to its initial payouts.
+	const query = `UPDATE active_contracts SET (valid_payout_value, missed_payout_value, void_payout_value, filesize) = (
+	COALESCE((SELECT valid_payout_value FROM contract_revisions WHERE contract_id=$1 ORDER BY id DESC LIMIT 1), initial_valid_payout_value),
+	COALESCE((SELECT missed_payout_value FROM contract_revisions WHERE contract_id=$1 ORDER BY id DESC LIMIT 1), initial_missed_payout_value),
+	COALESCE((SELECT void_payout_value FROM contract_revisions WHERE contract_id=$1 ORDER BY id DESC LIMIT 1), initial_void_payout_value),
+	COALESCE((SELECT filesize FROM contract_revisions WHERE contract_id=$1 ORDER BY id DESC LIMIT 1), initial_filesize))
+WHERE contract_id=$1`
+	for _, id := range revised {
+		if _, err := tx.Exec(query, sqlHash256(id)); err != nil {
+			return fmt.Errorf("failed to reset contract %q: %w", id, err)
+		}
+	}
+	return nil
+}
+
 func proveContract(tx txn, id types.FileContractID, blockID int64) error {
 	var dbID int64
 	err := tx.QueryRow(`UPDATE active_contracts SET proof_block_id=$1 WHERE contract_id=$2 RETURNING id`, blockID, sqlHash256(id)).Scan(&dbID)
 	return err
 }
 
-func updateContractStats(tx txn, active, valid, missed int, revenue, payout stats.Values, timestamp time.Time) error {
-	if active == 0 && valid == 0 && missed == 0 {
+// resolveContract marks an active contract as resolved by the block and
+// archives it along with the revenue, its fee and revision split, payout and
+// burned siacoins calculated at resolution.
+func resolveContract(tx txn, id types.FileContractID, blockID int64, valid bool, revenue, fees, revisions, payout, burned stats.Values, usdRate, eurRate, btcRate decimal.Decimal) error {
+	var dbID int64
+	err := tx.QueryRow(`UPDATE active_contracts SET resolved_block_id=$1 WHERE contract_id=$2 RETURNING id`, blockID, sqlHash256(id)).Scan(&dbID)
+	if err != nil {
+		return fmt.Errorf("failed to resolve contract: %w", err)
+	}
+
+	const query = `INSERT INTO archived_contracts (contract_id, block_id, proof_block_id, resolved_block_id, host_address, valid,
+initial_valid_revenue, initial_missed_revenue, initial_valid_payout_value, initial_missed_payout_value,
+valid_payout_value, missed_payout_value, initial_void_payout_value, void_payout_value, initial_filesize, filesize, host_funds, host_funds_method, estimate_status, estimator_version, siafund_tax, expiration_height,
+payout_sc, payout_usd, payout_eur, payout_btc,
+estimated_revenue_sc, estimated_revenue_usd, estimated_revenue_eur, estimated_revenue_btc,
+fee_revenue_sc, fee_revenue_usd, fee_revenue_eur, fee_revenue_btc,
+revision_revenue_sc, revision_revenue_usd, revision_revenue_eur, revision_revenue_btc,
+burned_sc, burned_usd, burned_eur, burned_btc,
+usd_rate, eur_rate, btc_rate)
+SELECT contract_id, block_id, proof_block_id, resolved_block_id, host_address, $1,
+initial_valid_revenue, initial_missed_revenue, initial_valid_payout_value, initial_missed_payout_value,
+valid_payout_value, missed_payout_value, initial_void_payout_value, void_payout_value, initial_filesize, filesize, host_funds, host_funds_method, estimate_status, estimator_version, siafund_tax, expiration_height,
+$2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $24
+FROM active_contracts WHERE id=$25`
+	_, err = tx.Exec(query, valid,
+		sqlCurrency(payout.SC), payout.USD, payout.EUR, payout.BTC,
+		sqlCurrency(revenue.SC), revenue.USD, revenue.EUR, revenue.BTC,
+		sqlCurrency(fees.SC), fees.USD, fees.EUR, fees.BTC,
+		sqlCurrency(revisions.SC), revisions.USD, revisions.EUR, revisions.BTC,
+		sqlCurrency(burned.SC), burned.USD, burned.EUR, burned.BTC,
+		usdRate, eurRate, btcRate, dbID)
+	if err != nil {
+		return fmt.Errorf("failed to archive contract: %w", err)
+	}
+	return nil
+}
+
+// addAccrual adds an entry to a contract's accrual ledger.
+func addAccrual(tx txn, id types.FileContractID, blockID int64, kind string, revenue stats.Values) error {
+	const query = `INSERT INTO contract_accruals (contract_id, block_id, kind, revenue_sc, revenue_usd, revenue_eur, revenue_btc) VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	_, err := tx.Exec(query, sqlHash256(id), blockID, kind, sqlCurrency(revenue.SC), revenue.USD, revenue.EUR, revenue.BTC)
+	return err
+}
+
+// accrualTotal returns the sum of a contract's ledger entries of a kind.
+func accrualTotal(tx txn, id types.FileContractID, kind string) (total stats.Values, err error) {
+	rows, err := tx.Query(`SELECT revenue_sc, revenue_usd, revenue_eur, revenue_btc FROM contract_accruals WHERE contract_id=$1 AND kind=$2`, sqlHash256(id), kind)
+	if err != nil {
+		return stats.Values{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var v stats.Values
+		if err := rows.Scan((*sqlCurrency)(&v.SC), &v.USD, &v.EUR, &v.BTC); err != nil {
+			return stats.Values{}, fmt.Errorf("failed to scan accrual: %w", err)
+		}
+		total = total.Add(v)
+	}
+	return total, rows.Err()
+}
+
+// accruedRevenue returns the revenue accrued by a contract at formation and
+// by its revisions, valued at the time it was accrued.
+func accruedRevenue(tx txn, id types.FileContractID) (stats.Values, error) {
+	formation, err := accrualTotal(tx, id, stats.AccrualFormation)
+	if err != nil {
+		return stats.Values{}, err
+	}
+	revisions, err := accrualTotal(tx, id, stats.AccrualRevision)
+	if err != nil {
+		return stats.Values{}, err
+	}
+	return formation.Add(revisions), nil
+}
+
+func addBlockStats(tx txn, blockID int64, delta statDelta) error {
+	if delta.IsZero() {
 		return nil
 	}
 
+	query := `INSERT INTO block_contract_stats (block_id, ` + statColumns + `) VALUES ($1, ` + statPlaceholders(2) + `)`
+	_, err := tx.Exec(query, append([]any{blockID}, delta.args()...)...)
+	return err
+}
+
+// blockStats returns the stat delta added by a block. Blocks that did not
+// change the stats have no delta.
+func blockStats(tx txn, blockID int64) (delta statDelta, err error) {
+	const query = `SELECT ` + statColumns + ` FROM block_contract_stats WHERE block_id=$1`
+	err = tx.QueryRow(query, blockID).Scan(delta.dest()...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return statDelta{}, nil
+	}
+	return
+}
+
+// setContractState inserts or replaces the contract stats at the state's
+// timestamp.
+func setContractState(tx txn, state stats.ContractState) error {
+	query := `INSERT INTO hourly_contract_stats (date_created, ` + statColumns + `) VALUES ($1, ` + statPlaceholders(2) + `)
+ON CONFLICT (date_created) DO UPDATE SET ` + statUpdates
+	_, err := tx.Exec(query, append([]any{sqlTime(state.Timestamp)}, stateArgs(state)...)...)
+	return err
+}
+
+// updateContractStats adds the delta to the contract stats at the timestamp
+// and to every later row, since the stats are cumulative. If revert is true,
+// the delta is subtracted instead.
+func updateContractStats(tx txn, delta statDelta, timestamp time.Time, revert bool) error {
+	if delta.IsZero() {
+		return nil
+	}
+
+	// make sure there is a row at the timestamp, carrying forward the
+	// previous state
 	state, err := getMetrics(tx, timestamp)
 	if err != nil && !errors.Is(err, sql.ErrNoRows) {
 		return fmt.Errorf("failed to get contract stats: %w", err)
+	} else if state.Timestamp.Unix() != timestamp.Unix() {
+		state.Timestamp = timestamp
+		if err := setContractState(tx, state); err != nil {
+			return fmt.Errorf("failed to add contract stats: %w", err)
+		}
 	}
 
-	state.Active += active
-	state.Valid += valid
-	state.Missed += missed
-	state.Revenue = state.Revenue.Add(revenue)
-	state.Payout = state.Payout.Add(payout)
-
-	if state.Active < 0 {
-		return fmt.Errorf("invalid active contract count: %d", state.Active)
-	} else if state.Valid < 0 {
-		return fmt.Errorf("invalid valid contract count: %d", state.Valid)
-	} else if state.Missed < 0 {
-		return fmt.Errorf("invalid missed contract count: %d", state.Missed)
-	}
-
-	const upsertQuery = `INSERT INTO hourly_contract_stats (date_created, active_contracts, 
-valid_contracts, missed_contracts, total_payouts_sc, total_payouts_usd, total_payouts_eur, total_payouts_btc,
-estimated_revenue_sc, estimated_revenue_usd, estimated_revenue_eur, estimated_revenue_btc) 
-VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10,  $11, $12)
-ON CONFLICT (date_created) DO UPDATE SET active_contracts=EXCLUDED.active_contracts, valid_contracts=EXCLUDED.valid_contracts,
-missed_contracts=EXCLUDED.missed_contracts, total_payouts_sc=EXCLUDED.total_payouts_sc, total_payouts_usd=EXCLUDED.total_payouts_usd,
-total_payouts_eur=EXCLUDED.total_payouts_eur, total_payouts_btc=EXCLUDED.total_payouts_btc, estimated_revenue_sc=EXCLUDED.estimated_revenue_sc,
-estimated_revenue_usd=EXCLUDED.estimated_revenue_usd, estimated_revenue_eur=EXCLUDED.estimated_revenue_eur, estimated_revenue_btc=EXCLUDED.estimated_revenue_btc`
-
-	_, err = tx.Exec(upsertQuery, sqlTime(timestamp), state.Active, state.Valid, state.Missed,
-		sqlCurrency(state.Payout.SC),
-		state.Payout.USD,
-		state.Payout.EUR,
-		state.Payout.BTC,
-		sqlCurrency(state.Revenue.SC),
-		state.Revenue.USD,
-		state.Revenue.EUR,
-		state.Revenue.BTC)
-	return err
+	const query = `SELECT ` + statColumns + `, date_created FROM hourly_contract_stats WHERE date_created >= $1`
+	rows, err := tx.Query(query, sqlTime(timestamp))
+	if err != nil {
+		return fmt.Errorf("failed to query contract stats: %w", err)
+	}
+	defer rows.Close()
+
+	var states []stats.ContractState
+	for rows.Next() {
+		state, err := scanContractState(rows)
+		if err != nil {
+			return fmt.Errorf("failed to scan contract stats: %w", err)
+		}
+		states = append(states, state)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to query contract stats: %w", err)
+	}
+	rows.Close()
+
+	for _, state := range states {
+		var updated stats.ContractState
+		if revert {
+			updated, err = delta.Revert(state)
+		} else {
+			updated, err = delta.Apply(state)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to update contract stats at %v: %w", state.Timestamp, err)
+		} else if err := setContractState(tx, updated); err != nil {
+			return fmt.Errorf("failed to set contract stats at %v: %w", state.Timestamp, err)
+		}
+	}
+	return nil
 }
 
 func missedContracts(tx txn, height uint64) (contracts []stats.Contract, err error) {
 	const query = `SELECT c.contract_id, b.block_id, c.initial_valid_payout_value,
 c.initial_missed_payout_value, c.valid_payout_value, c.missed_payout_value,
-c.initial_valid_revenue, c.initial_missed_revenue, c.expiration_height, 0
+c.initial_valid_revenue, c.initial_missed_revenue, c.expiration_height, 0, c.host_address, c.filesize, c.host_funds, c.void_payout_value
 FROM active_contracts c
 INNER JOIN blocks b ON c.block_id=b.id
-WHERE c.expiration_height <= $1 AND c.proof_block_id IS NULL`
+WHERE c.expiration_height <= $1 AND c.proof_block_id IS NULL AND c.resolved_block_id IS NULL
+AND c.contract_id NOT IN (SELECT renewed_from FROM contract_renewals)`
 	rows, err := tx.Query(query, height)
 	if err != nil {
 		return nil, err
@@ -452,14 +970,19 @@ WHERE c.expiration_height <= $1 AND c.proof_block_id IS NULL`
 	return contracts, nil
 }
 
+// validContracts returns the contracts proven at or before the height and the
+// renewed contracts that expired at or before the height. The final revision
+// of a renewed contract sets its missed payouts to its valid payouts, so it
+// does not need a proof.
 func validContracts(tx txn, height uint64) (contracts []stats.Contract, err error) {
 	const query = `SELECT c.contract_id, b.block_id, c.initial_valid_payout_value,
 c.initial_missed_payout_value, c.valid_payout_value, c.missed_payout_value,
-c.initial_valid_revenue, c.initial_missed_revenue, c.expiration_height, 0
+c.initial_valid_revenue, c.initial_missed_revenue, c.expiration_height, 0, c.host_address, c.filesize, c.host_funds, c.void_payout_value
 FROM active_contracts c
 INNER JOIN blocks b ON c.block_id=b.id
-INNER JOIN blocks pb ON c.proof_block_id=pb.id
-WHERE pb.height <= $1`
+LEFT JOIN blocks pb ON c.proof_block_id=pb.id
+WHERE c.resolved_block_id IS NULL AND (pb.height <= $1 OR (c.proof_block_id IS NULL AND c.expiration_height <= $1
+AND c.contract_id IN (SELECT renewed_from FROM contract_renewals)))`
 	rows, err := tx.Query(query, height)
 	if err != nil {
 		return nil, err
@@ -481,7 +1004,7 @@ func scanContract(row scanner) (c stats.Contract, err error) {
 		(*sqlCurrency)(&c.InitialValid), (*sqlCurrency)(&c.InitialMissed),
 		(*sqlCurrency)(&c.FinalValid), (*sqlCurrency)(&c.FinalMissed),
 		(*sqlCurrency)(&c.InitialValidRevenue), (*sqlCurrency)(&c.InitialMissedRevenue),
-		&c.ExpirationHeight, &c.ProofHeight)
+		&c.ExpirationHeight, &c.ProofHeight, nullable((*sqlHash256)(&c.HostAddress)), (*sqlUint64)(&c.Filesize), (*sqlCurrency)(&c.HostFunds), (*sqlCurrency)(&c.VoidPayout))
 	return
 }
 
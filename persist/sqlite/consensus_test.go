@@ -1,16 +1,19 @@
 package sqlite_test
 
 import (
+	"errors"
 	"path/filepath"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/shopspring/decimal"
 	rhp2 "go.sia.tech/core/rhp/v2"
 	"go.sia.tech/core/types"
 	"go.sia.tech/host-revenue-api/internal/chain"
 	"go.sia.tech/host-revenue-api/internal/test"
 	"go.sia.tech/host-revenue-api/persist/sqlite"
+	"go.sia.tech/host-revenue-api/stats"
 	"go.sia.tech/siad/modules"
 	"go.sia.tech/siad/modules/consensus"
 	"go.sia.tech/siad/modules/gateway"
@@ -63,13 +66,15 @@ func TestIndexing(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	db, err := sqlite.OpenDatabase(filepath.Join(dir, "test.db"), log)
+	db, err := sqlite.OpenDatabase(filepath.Join(dir, "test.db"), sqlite.DefaultConfirmations, log)
 	if err != nil {
 		t.Fatal(err)
 	}
 	defer db.Close()
 
-	if err := cs.ConsensusSetSubscribe(db, modules.ConsensusChangeBeginning, nil); err != nil {
+	if err := db.AddMarketData(decimal.NewFromFloat(0.01), decimal.NewFromFloat(0.009), decimal.NewFromFloat(0.0000005), time.Now()); err != nil {
+		t.Fatal(err)
+	} else if err := cs.ConsensusSetSubscribe(db, modules.ConsensusChangeBeginning, nil); err != nil {
 		t.Fatal(err)
 	}
 
@@ -90,16 +95,19 @@ func TestIndexing(t *testing.T) {
 	endHeight := cm.TipState().Index.Height + 20
 	// minimal rhp2 settings for contract formation
 	hostSettings := rhp2.HostSettings{
+		Address:       hostKey.PublicKey().StandardAddress(),
 		WindowSize:    10,
 		ContractPrice: types.Siacoins(1).Div64(4),
 	}
 	fc := rhp2.PrepareContractFormation(renterKey.PublicKey(), hostKey.PublicKey(), types.Siacoins(100), types.Siacoins(200), endHeight, hostSettings, w.Address())
 	// add a contract
+	minerFee := types.Siacoins(1)
 	fc1Txn := types.Transaction{
 		FileContracts: []types.FileContract{fc},
+		MinerFees:     []types.Currency{minerFee},
 	}
 
-	toSign, release, err := w.FundTransaction(&fc1Txn, fc.Payout)
+	toSign, release, err := w.FundTransaction(&fc1Txn, fc.Payout.Add(minerFee))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -111,6 +119,8 @@ func TestIndexing(t *testing.T) {
 		t.Fatal(err)
 	}
 
+	expectedTax := cm.TipState().FileContractTax(fc)
+
 	// mine a block to confirm the contract
 	if err := miner.Mine(w.Address(), 1); err != nil {
 		t.Fatal(err)
@@ -118,19 +128,23 @@ func TestIndexing(t *testing.T) {
 	time.Sleep(time.Second) // sync time
 
 	// check the statistics were updated
-	stats, err := db.Metrics(time.Now())
+	metrics, err := db.Metrics(time.Now())
 	if err != nil {
 		t.Fatal(err)
-	} else if stats.Active != 1 {
-		t.Fatal("expected 1 active contracts, got", stats.Active)
-	} else if stats.Missed != 0 {
-		t.Fatal("expected 0 missed contracts, got", stats.Missed)
-	} else if stats.Valid != 0 {
-		t.Fatal("expected 0 valid contracts, got", stats.Valid)
-	} else if !stats.Payout.SC.IsZero() {
-		t.Fatal("expected payout to be zero, got", stats.Payout.SC)
-	} else if !stats.Revenue.SC.IsZero() {
-		t.Fatal("expected revenue to be zero, got", stats.Revenue.SC)
+	} else if metrics.Active != 1 {
+		t.Fatal("expected 1 active contracts, got", metrics.Active)
+	} else if metrics.Missed != 0 {
+		t.Fatal("expected 0 missed contracts, got", metrics.Missed)
+	} else if metrics.Valid != 0 {
+		t.Fatal("expected 0 valid contracts, got", metrics.Valid)
+	} else if !metrics.Payout.SC.IsZero() {
+		t.Fatal("expected payout to be zero, got", metrics.Payout.SC)
+	} else if !metrics.Revenue.SC.IsZero() {
+		t.Fatal("expected revenue to be zero, got", metrics.Revenue.SC)
+	} else if expectedTax.IsZero() || !metrics.SiafundTax.SC.Equals(expectedTax) {
+		t.Fatalf("expected siafund tax to be %d, got %d", expectedTax, metrics.SiafundTax.SC)
+	} else if !metrics.MinerFees.SC.Equals(minerFee) {
+		t.Fatalf("expected miner fees to be %d, got %d", minerFee, metrics.MinerFees.SC)
 	}
 
 	// add a second contract
@@ -154,6 +168,7 @@ func TestIndexing(t *testing.T) {
 	}
 
 	fc2ID := fc2Txn.FileContractID(0)
+	expectedTax = expectedTax.Add(cm.TipState().FileContractTax(fc2))
 
 	// mine a block to confirm the contract
 	if err := miner.Mine(w.Address(), 1); err != nil {
@@ -162,19 +177,21 @@ func TestIndexing(t *testing.T) {
 	time.Sleep(time.Second) // sync time
 
 	// check the statistics were updated
-	stats, err = db.Metrics(time.Now())
+	metrics, err = db.Metrics(time.Now())
 	if err != nil {
 		t.Fatal(err)
-	} else if stats.Active != 2 {
-		t.Fatal("expected 2 active contracts, got", stats.Active)
-	} else if stats.Missed != 0 {
-		t.Fatal("expected 0 missed contracts, got", stats.Missed)
-	} else if stats.Valid != 0 {
-		t.Fatal("expected 0 valid contracts, got", stats.Valid)
-	} else if !stats.Payout.SC.IsZero() {
-		t.Fatal("expected payout to be zero, got", stats.Payout.SC)
-	} else if !stats.Revenue.SC.IsZero() {
-		t.Fatal("expected revenue to be zero, got", stats.Revenue.SC)
+	} else if metrics.Active != 2 {
+		t.Fatal("expected 2 active contracts, got", metrics.Active)
+	} else if metrics.Missed != 0 {
+		t.Fatal("expected 0 missed contracts, got", metrics.Missed)
+	} else if metrics.Valid != 0 {
+		t.Fatal("expected 0 valid contracts, got", metrics.Valid)
+	} else if !metrics.Payout.SC.IsZero() {
+		t.Fatal("expected payout to be zero, got", metrics.Payout.SC)
+	} else if !metrics.Revenue.SC.IsZero() {
+		t.Fatal("expected revenue to be zero, got", metrics.Revenue.SC)
+	} else if !metrics.SiafundTax.SC.Equals(expectedTax) {
+		t.Fatalf("expected siafund tax to be %d, got %d", expectedTax, metrics.SiafundTax.SC)
 	}
 
 	// submit a revision transferring some of the renter funds from the second contract to the host
@@ -191,6 +208,7 @@ func TestIndexing(t *testing.T) {
 		FileContract: fc2,
 	}
 	revFC2.RevisionNumber = 1
+	revFC2.Filesize = 1 << 22
 	// transfer the funds to the host on success
 	revFC2.ValidProofOutputs[0].Value = revFC2.ValidProofOutputs[0].Value.Sub(transfer)
 	revFC2.ValidProofOutputs[1].Value = revFC2.ValidProofOutputs[1].Value.Add(transfer)
@@ -239,19 +257,27 @@ func TestIndexing(t *testing.T) {
 	expectedPayout := fc.MissedProofOutputs[1].Value
 
 	// check the statistics were updated
-	stats, err = db.Metrics(time.Now())
+	metrics, err = db.Metrics(time.Now())
 	if err != nil {
 		t.Fatal(err)
-	} else if stats.Active != 1 {
-		t.Fatal("expected 1 active contracts, got", stats.Active)
-	} else if stats.Missed != 1 {
-		t.Fatal("expected 1 missed contracts, got", stats.Missed)
-	} else if stats.Valid != 0 {
-		t.Fatal("expected 0 valid contracts, got", stats.Valid)
-	} else if !stats.Payout.SC.Equals(expectedPayout) {
-		t.Fatalf("expected payout to be %d, got %d", expectedPayout, stats.Payout.SC)
-	} else if !stats.Revenue.SC.IsZero() {
-		t.Fatal("expected revenue to be zero, got", stats.Revenue.SC)
+	} else if metrics.Active != 1 {
+		t.Fatal("expected 1 active contracts, got", metrics.Active)
+	} else if metrics.Stored != revFC2.Filesize {
+		t.Fatalf("expected %d stored bytes, got %d", revFC2.Filesize, metrics.Stored)
+	} else if risked := transfer.Add(collateral); !metrics.Collateral.Risked.Equals(risked) {
+		t.Fatalf("expected %d risked collateral, got %d", risked, metrics.Collateral.Risked)
+	} else if !metrics.Collateral.Burned.IsZero() {
+		t.Fatal("expected no burned collateral, got", metrics.Collateral.Burned)
+	} else if !metrics.Burned.IsZero() {
+		t.Fatal("expected nothing burned, got", metrics.Burned.SC)
+	} else if metrics.Missed != 1 {
+		t.Fatal("expected 1 missed contracts, got", metrics.Missed)
+	} else if metrics.Valid != 0 {
+		t.Fatal("expected 0 valid contracts, got", metrics.Valid)
+	} else if !metrics.Payout.SC.Equals(expectedPayout) {
+		t.Fatalf("expected payout to be %d, got %d", expectedPayout, metrics.Payout.SC)
+	} else if !metrics.Revenue.SC.IsZero() {
+		t.Fatal("expected revenue to be zero, got", metrics.Revenue.SC)
 	}
 
 	// mine until the second contract expires
@@ -263,19 +289,27 @@ func TestIndexing(t *testing.T) {
 
 	expectedPayout = expectedPayout.Add(revFC2.MissedProofOutputs[1].Value)
 	// check the statistics were updated
-	stats, err = db.Metrics(time.Now())
+	metrics, err = db.Metrics(time.Now())
 	if err != nil {
 		t.Fatal(err)
-	} else if stats.Active != 0 {
-		t.Fatal("expected 2 active contracts, got", stats.Active)
-	} else if stats.Missed != 2 {
-		t.Fatal("expected 2 missed contracts, got", stats.Missed)
-	} else if stats.Valid != 0 {
-		t.Fatal("expected 0 valid contracts, got", stats.Valid)
-	} else if !stats.Payout.SC.Equals(expectedPayout) {
-		t.Fatalf("expected payout to be %d, got %d", expectedPayout, stats.Payout.SC)
-	} else if !stats.Revenue.SC.IsZero() {
-		t.Fatal("expected revenue to be zero, got", stats.Revenue.SC)
+	} else if metrics.Active != 0 {
+		t.Fatal("expected 2 active contracts, got", metrics.Active)
+	} else if metrics.Stored != 0 {
+		t.Fatal("expected 0 stored bytes, got", metrics.Stored)
+	} else if !metrics.Collateral.Risked.IsZero() {
+		t.Fatal("expected no risked collateral, got", metrics.Collateral.Risked)
+	} else if !metrics.Collateral.Burned.Equals(collateral) {
+		t.Fatalf("expected %d burned collateral, got %d", collateral, metrics.Collateral.Burned)
+	} else if burned := revFC2.MissedProofOutputs[2].Value; !metrics.Burned.SC.Equals(burned) {
+		t.Fatalf("expected %d burned, got %d", burned, metrics.Burned.SC)
+	} else if metrics.Missed != 2 {
+		t.Fatal("expected 2 missed contracts, got", metrics.Missed)
+	} else if metrics.Valid != 0 {
+		t.Fatal("expected 0 valid contracts, got", metrics.Valid)
+	} else if !metrics.Payout.SC.Equals(expectedPayout) {
+		t.Fatalf("expected payout to be %d, got %d", expectedPayout, metrics.Payout.SC)
+	} else if !metrics.Revenue.SC.IsZero() {
+		t.Fatal("expected revenue to be zero, got", metrics.Revenue.SC)
 	}
 
 	// add a third contract
@@ -300,6 +334,7 @@ func TestIndexing(t *testing.T) {
 
 	fc3ID := fc3Txn.FileContractID(0)
 	fc3InitialPayout := fc3.ValidHostPayout()
+	expectedTax = expectedTax.Add(cm.TipState().FileContractTax(fc3))
 
 	// mine a block to confirm the contract
 	if err := miner.Mine(w.Address(), 1); err != nil {
@@ -308,19 +343,21 @@ func TestIndexing(t *testing.T) {
 	time.Sleep(time.Second) // sync time
 
 	// check the statistics were updated
-	stats, err = db.Metrics(time.Now())
+	metrics, err = db.Metrics(time.Now())
 	if err != nil {
 		t.Fatal(err)
-	} else if stats.Active != 1 {
-		t.Fatal("expected 1 active contracts, got", stats.Active)
-	} else if stats.Missed != 2 {
-		t.Fatal("expected 2 missed contracts, got", stats.Missed)
-	} else if stats.Valid != 0 {
-		t.Fatal("expected 0 valid contracts, got", stats.Valid)
-	} else if !stats.Payout.SC.Equals(expectedPayout) {
-		t.Fatalf("expected payout to be %d, got %d", expectedPayout, stats.Payout.SC)
-	} else if !stats.Revenue.SC.IsZero() {
-		t.Fatal("expected revenue to be zero, got", stats.Revenue.SC)
+	} else if metrics.Active != 1 {
+		t.Fatal("expected 1 active contracts, got", metrics.Active)
+	} else if metrics.Missed != 2 {
+		t.Fatal("expected 2 missed contracts, got", metrics.Missed)
+	} else if metrics.Valid != 0 {
+		t.Fatal("expected 0 valid contracts, got", metrics.Valid)
+	} else if !metrics.Payout.SC.Equals(expectedPayout) {
+		t.Fatalf("expected payout to be %d, got %d", expectedPayout, metrics.Payout.SC)
+	} else if !metrics.Revenue.SC.IsZero() {
+		t.Fatal("expected revenue to be zero, got", metrics.Revenue.SC)
+	} else if !metrics.SiafundTax.SC.Equals(expectedTax) {
+		t.Fatalf("expected siafund tax to be %d, got %d", expectedTax, metrics.SiafundTax.SC)
 	}
 
 	// submit a revision transferring some of the renter funds from the second contract to the host
@@ -405,19 +442,890 @@ func TestIndexing(t *testing.T) {
 	expectedRevenue := revFC3.ValidHostPayout().Sub(fc3InitialPayout)
 
 	// check the statistics were updated
-	stats, err = db.Metrics(time.Now())
+	metrics, err = db.Metrics(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	} else if metrics.Active != 0 {
+		t.Fatal("expected 0 active contracts, got", metrics.Active)
+	} else if metrics.Missed != 2 {
+		t.Fatal("expected 2 missed contracts, got", metrics.Missed)
+	} else if metrics.Valid != 1 {
+		t.Fatal("expected 1 valid contract, got", metrics.Valid)
+	} else if !metrics.Payout.SC.Equals(expectedPayout) {
+		t.Fatalf("expected payout to be %d, got %d", expectedPayout, metrics.Payout.SC)
+	} else if !metrics.Revenue.SC.Equals(expectedRevenue) {
+		t.Fatalf("expected revenue to be %d, got %d", expectedRevenue, metrics.Revenue.SC)
+	}
+
+	// check the lifecycle of the proven contract
+	contract, err := db.Contract(fc3ID)
+	if err != nil {
+		t.Fatal(err)
+	} else if contract.Status != stats.ContractStatusValid {
+		t.Fatalf("expected contract to be valid, got %q", contract.Status)
+	} else if contract.ProofBlockID == nil || contract.ResolutionBlockID == nil {
+		t.Fatal("expected proof and resolution blocks to be set")
+	} else if contract.ResolutionHeight-contract.ProofHeight != uint64(stypes.MaturityDelay) {
+		t.Fatalf("expected contract to resolve %d blocks after proof, got %d", stypes.MaturityDelay, contract.ResolutionHeight-contract.ProofHeight)
+	} else if len(contract.Revisions) != 1 {
+		t.Fatalf("expected 1 revision, got %d", len(contract.Revisions))
+	} else if !contract.Revisions[0].ValidPayout.Equals(revFC3.ValidHostPayout()) {
+		t.Fatalf("expected revision valid payout %d, got %d", revFC3.ValidHostPayout(), contract.Revisions[0].ValidPayout)
+	} else if !contract.Revenue.SC.Equals(expectedRevenue) {
+		t.Fatalf("expected contract revenue %d, got %d", expectedRevenue, contract.Revenue.SC)
+	} else if contract.HostAddress == nil || *contract.HostAddress != hostSettings.Address {
+		t.Fatalf("expected host address %v, got %v", hostSettings.Address, contract.HostAddress)
+	}
+
+	// all contracts were formed with the same host, so the host's stats
+	// should match the network
+	hostMetrics, err := db.HostMetrics(hostSettings.Address, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	} else if hostMetrics.Active != metrics.Active || hostMetrics.Valid != metrics.Valid || hostMetrics.Missed != metrics.Missed {
+		t.Fatalf("expected host contracts to match network, got %d/%d/%d", hostMetrics.Active, hostMetrics.Valid, hostMetrics.Missed)
+	} else if !hostMetrics.Payout.SC.Equals(metrics.Payout.SC) {
+		t.Fatalf("expected host payout to be %d, got %d", metrics.Payout.SC, hostMetrics.Payout.SC)
+	} else if !hostMetrics.Revenue.SC.Equals(metrics.Revenue.SC) {
+		t.Fatalf("expected host revenue to be %d, got %d", metrics.Revenue.SC, hostMetrics.Revenue.SC)
+	}
+
+	if _, err := db.HostMetrics(types.VoidAddress, time.Now()); !errors.Is(err, stats.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	// the host should be the only one on the leaderboard
+	hosts, err := db.Hosts(time.Now().Add(-24*time.Hour), time.Now().Add(time.Hour), stats.HostSortRevenue, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(hosts) != 1 {
+		t.Fatalf("expected 1 host, got %d", len(hosts))
+	} else if hosts[0].Address != hostSettings.Address {
+		t.Fatalf("expected host %v, got %v", hostSettings.Address, hosts[0].Address)
+	} else if hosts[0].Valid != metrics.Valid || hosts[0].Missed != metrics.Missed {
+		t.Fatalf("expected %d valid and %d missed contracts, got %d and %d", metrics.Valid, metrics.Missed, hosts[0].Valid, hosts[0].Missed)
+	} else if !hosts[0].Revenue.SC.Equals(metrics.Revenue.SC) {
+		t.Fatalf("expected host revenue %d, got %d", metrics.Revenue.SC, hosts[0].Revenue.SC)
+	} else if hosts[0].SuccessRatio != float64(metrics.Valid)/float64(metrics.Valid+metrics.Missed) {
+		t.Fatalf("expected success ratio %v, got %v", float64(metrics.Valid)/float64(metrics.Valid+metrics.Missed), hosts[0].SuccessRatio)
+	}
+
+	if hosts, err := db.Hosts(time.Now().Add(-24*time.Hour), time.Now().Add(time.Hour), stats.HostSortRevenue, 10, 1); err != nil {
+		t.Fatal(err)
+	} else if len(hosts) != 0 {
+		t.Fatalf("expected no hosts past the first page, got %d", len(hosts))
+	}
+
+	if _, err := db.Contract(types.FileContractID(frand.Entropy256())); !errors.Is(err, stats.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	// check the aggregates can be reproduced from the archive
+	archived, err := db.ArchivedTotals(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	} else if archived.Valid != metrics.Valid {
+		t.Fatalf("expected %d archived valid contracts, got %d", metrics.Valid, archived.Valid)
+	} else if archived.Missed != metrics.Missed {
+		t.Fatalf("expected %d archived missed contracts, got %d", metrics.Missed, archived.Missed)
+	} else if !archived.Payout.SC.Equals(metrics.Payout.SC) || !archived.Payout.USD.Equal(metrics.Payout.USD) {
+		t.Fatalf("expected archived payout to be %v, got %v", metrics.Payout, archived.Payout)
+	} else if !archived.Revenue.SC.Equals(metrics.Revenue.SC) || !archived.Revenue.USD.Equal(metrics.Revenue.USD) {
+		t.Fatalf("expected archived revenue to be %v, got %v", metrics.Revenue, archived.Revenue)
+	}
+
+	// only the second contract stored data
+	buckets, err := db.Distribution(stats.DistributionSize, time.Now().Add(-24*time.Hour), time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	} else if len(buckets) != 2 {
+		t.Fatalf("expected 2 size buckets, got %d", len(buckets))
+	} else if buckets[0].Min != 0 || buckets[0].Max != 1 {
+		t.Fatalf("expected bucket [0, 1), got [%d, %d)", buckets[0].Min, buckets[0].Max)
+	} else if buckets[0].Valid != 1 || buckets[0].Missed != 1 || buckets[0].Active != 0 {
+		t.Fatalf("expected 1 valid and 1 missed contract, got %d and %d", buckets[0].Valid, buckets[0].Missed)
+	} else if !buckets[0].Revenue.SC.Equals(metrics.Revenue.SC) {
+		t.Fatalf("expected bucket revenue %d, got %d", metrics.Revenue.SC, buckets[0].Revenue.SC)
+	} else if buckets[1].Min != revFC2.Filesize || buckets[1].Max != 2*revFC2.Filesize {
+		t.Fatalf("expected bucket [%d, %d), got [%d, %d)", revFC2.Filesize, 2*revFC2.Filesize, buckets[1].Min, buckets[1].Max)
+	} else if buckets[1].Missed != 1 {
+		t.Fatalf("expected 1 missed contract, got %d", buckets[1].Missed)
+	}
+
+	// every resolved contract is counted once in each distribution
+	for _, kind := range []string{stats.DistributionDuration, stats.DistributionPayout} {
+		buckets, err := db.Distribution(kind, time.Now().Add(-24*time.Hour), time.Now().Add(time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var contracts int
+		var revenue types.Currency
+		for _, b := range buckets {
+			contracts += b.Valid + b.Missed
+			revenue = revenue.Add(b.Revenue.SC)
+		}
+		if contracts != metrics.Valid+metrics.Missed {
+			t.Fatalf("expected %d %s contracts, got %d", metrics.Valid+metrics.Missed, kind, contracts)
+		} else if !revenue.Equals(metrics.Revenue.SC) {
+			t.Fatalf("expected %s revenue %d, got %d", kind, metrics.Revenue.SC, revenue)
+		}
+	}
+
+	// every contract matured in the last day, so the new contracts of each
+	// period should add up to the totals
+	networkProofs, err := db.ProofPeriods(time.Now().Add(-24*time.Hour), time.Now(), stats.PeriodHourly)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostProofs, err := db.HostProofPeriods(hostSettings.Address, time.Now().Add(-24*time.Hour), time.Now(), stats.PeriodHourly)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, proofs := range [][]stats.ProofPeriod{networkProofs, hostProofs} {
+		var valid, missed int
+		for _, p := range proofs {
+			valid += p.Valid
+			missed += p.Missed
+			if p.Valid+p.Missed > 0 && p.SuccessRatio != float64(p.Valid)/float64(p.Valid+p.Missed) {
+				t.Fatalf("expected success ratio %v, got %v", float64(p.Valid)/float64(p.Valid+p.Missed), p.SuccessRatio)
+			}
+		}
+		if valid != metrics.Valid || missed != metrics.Missed {
+			t.Fatalf("expected %d valid and %d missed contracts, got %d and %d", metrics.Valid, metrics.Missed, valid, missed)
+		}
+	}
+
+	// the valid contract did not store any data, so it does not imply a price
+	prices, err := db.StoragePrices(time.Now().Add(-24*time.Hour), time.Now(), stats.PeriodDaily)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(prices) == 0 {
+		t.Fatal("expected daily prices")
+	}
+	for _, p := range prices {
+		if p.Contracts != 0 {
+			t.Fatalf("expected no priced contracts, got %d", p.Contracts)
+		}
+	}
+}
+
+func TestRenewal(t *testing.T) {
+	log := zaptest.NewLogger(t)
+	dir := t.TempDir()
+
+	g, err := gateway.New(":0", false, filepath.Join(dir, "gateway"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+
+	cs, errCh := consensus.New(g, false, filepath.Join(dir, "consensus"))
+	select {
+	case err := <-errCh:
+		if err != nil {
+			t.Fatal(err)
+		}
+	default:
+		go func() {
+			if err := <-errCh; err != nil && !strings.Contains(err.Error(), "ThreadGroup already stopped") {
+				panic(err)
+			}
+		}()
+	}
+	defer cs.Close()
+
+	cm, err := chain.NewManager(cs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cm.Close()
+
+	stp, err := transactionpool.New(cs, g, filepath.Join(dir, "tpool"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stp.Close()
+	tp := chain.NewTPool(stp)
+
+	w := test.NewWallet()
+	if err := cs.ConsensusSetSubscribe(w, modules.ConsensusChangeBeginning, nil); err != nil {
+		t.Fatal(err)
+	}
+	// the host funds its collateral from its own wallet
+	hw := test.NewWallet()
+	if err := cs.ConsensusSetSubscribe(hw, modules.ConsensusChangeBeginning, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := sqlite.OpenDatabase(filepath.Join(dir, "test.db"), sqlite.DefaultConfirmations, log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := db.AddMarketData(decimal.NewFromFloat(0.01), decimal.NewFromFloat(0.009), decimal.NewFromFloat(0.0000005), time.Now()); err != nil {
+		t.Fatal(err)
+	} else if err := cs.ConsensusSetSubscribe(db, modules.ConsensusChangeBeginning, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	miner := test.NewMiner(cm)
+	if err := cs.ConsensusSetSubscribe(miner, modules.ConsensusChangeBeginning, nil); err != nil {
+		t.Fatal(err)
+	}
+	tp.Subscribe(miner)
+
+	// mine until both wallets have funds and all forks have been resolved
+	if err := miner.Mine(hw.Address(), 1); err != nil {
+		t.Fatal(err)
+	} else if err := miner.Mine(w.Address(), int(stypes.MaturityDelay)*4); err != nil {
+		t.Fatal(err)
+	}
+
+	renterKey := types.NewPrivateKeyFromSeed(frand.Bytes(32))
+	hostKey := types.NewPrivateKeyFromSeed(frand.Bytes(32))
+	hostSettings := rhp2.HostSettings{
+		Address:       hw.Address(),
+		WindowSize:    10,
+		ContractPrice: types.Siacoins(1).Div64(4),
+		StoragePrice:  types.Siacoins(1).Div64(1 << 22),
+		Collateral:    types.Siacoins(2).Div64(1 << 22),
+	}
+
+	// fundContract funds the renter's side of a contract from the renter
+	// wallet and the host's collateral from the host wallet
+	fundContract := func(txn *types.Transaction, payout, hostFunds types.Currency) {
+		t.Helper()
+		renterToSign, release, err := w.FundTransaction(txn, payout.Sub(hostFunds))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(release)
+		hostToSign, release, err := hw.FundTransaction(txn, hostFunds)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(release)
+
+		cf := types.CoveredFields{WholeTransaction: true}
+		if err := w.Sign(txn, cm.TipState(), renterToSign, cf); err != nil {
+			t.Fatal(err)
+		} else if err := hw.Sign(txn, cm.TipState(), hostToSign, cf); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// form a contract
+	collateral := types.Siacoins(200)
+	fc := rhp2.PrepareContractFormation(renterKey.PublicKey(), hostKey.PublicKey(), types.Siacoins(100), collateral, cm.TipState().Index.Height+20, hostSettings, w.Address())
+	formationTxn := types.Transaction{
+		FileContracts: []types.FileContract{fc},
+	}
+	fundContract(&formationTxn, fc.Payout, collateral)
+	if err := tp.AcceptTransactionSet([]types.Transaction{formationTxn}); err != nil {
+		t.Fatal(err)
+	} else if err := miner.Mine(w.Address(), 1); err != nil {
+		t.Fatal(err)
+	}
+	fcID := formationTxn.FileContractID(0)
+
+	// renew the contract, transferring some of the renter funds to the host
+	// in the final revision. The renewal carries over the contract's data, so
+	// the host adds collateral for it.
+	transfer := types.Siacoins(20)
+	finalRev := types.FileContractRevision{
+		ParentID: fcID,
+		UnlockConditions: types.UnlockConditions{
+			PublicKeys: []types.UnlockKey{
+				renterKey.PublicKey().UnlockKey(),
+				hostKey.PublicKey().UnlockKey(),
+			},
+			SignaturesRequired: 2,
+		},
+		FileContract: fc,
+	}
+	finalRev.RevisionNumber = types.MaxRevisionNumber
+	finalRev.Filesize = 1 << 22
+	finalRev.ValidProofOutputs = append([]types.SiacoinOutput(nil), fc.ValidProofOutputs...)
+	finalRev.ValidProofOutputs[0].Value = finalRev.ValidProofOutputs[0].Value.Sub(transfer)
+	finalRev.ValidProofOutputs[1].Value = finalRev.ValidProofOutputs[1].Value.Add(transfer)
+	finalRev.MissedProofOutputs = append([]types.SiacoinOutput(nil), finalRev.ValidProofOutputs...)
+
+	renewal, basePrice := rhp2.PrepareContractRenewal(finalRev, w.Address(), types.Siacoins(100), collateral, hostSettings, cm.TipState().Index.Height+40)
+	// the host funds the carried over and new collateral, only the contract
+	// fee and the storage cost of the carried over data are revenue
+	renewalHostFunds := renewal.ValidHostPayout().Sub(hostSettings.ContractPrice).Sub(basePrice)
+	if renewalHostFunds.Cmp(collateral) <= 0 {
+		t.Fatal("expected the renewal to carry over collateral")
+	}
+	renewalTxn := types.Transaction{
+		FileContracts:         []types.FileContract{renewal},
+		FileContractRevisions: []types.FileContractRevision{finalRev},
+		Signatures: []types.TransactionSignature{
+			{
+				ParentID:       types.Hash256(fcID),
+				CoveredFields:  types.CoveredFields{FileContractRevisions: []uint64{0}},
+				PublicKeyIndex: 0,
+			},
+			{
+				ParentID:       types.Hash256(fcID),
+				CoveredFields:  types.CoveredFields{FileContractRevisions: []uint64{0}},
+				PublicKeyIndex: 1,
+			},
+		},
+	}
+	sigHash := cm.TipState().PartialSigHash(renewalTxn, types.CoveredFields{FileContractRevisions: []uint64{0}})
+	renterSig, hostSig := renterKey.SignHash(sigHash), hostKey.SignHash(sigHash)
+	renewalTxn.Signatures[0].Signature = renterSig[:]
+	renewalTxn.Signatures[1].Signature = hostSig[:]
+
+	fundContract(&renewalTxn, renewal.Payout, renewalHostFunds)
+	if err := tp.AcceptTransactionSet([]types.Transaction{renewalTxn}); err != nil {
+		t.Fatal(err)
+	} else if err := miner.Mine(w.Address(), 1); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Second) // sync time
+	renewalID := renewalTxn.FileContractID(0)
+
+	// both contracts should report the same chain
+	for _, id := range []types.FileContractID{fcID, renewalID} {
+		renewals, err := db.ContractRenewals(id)
+		if err != nil {
+			t.Fatal(err)
+		} else if len(renewals) != 1 {
+			t.Fatalf("expected 1 renewal, got %d", len(renewals))
+		} else if renewals[0].RenewedFrom != fcID || renewals[0].RenewedTo != renewalID {
+			t.Fatalf("expected renewal %v -> %v, got %v -> %v", fcID, renewalID, renewals[0].RenewedFrom, renewals[0].RenewedTo)
+		}
+	}
+
+	if _, err := db.ContractRenewals(types.FileContractID(frand.Entropy256())); !errors.Is(err, stats.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	// the initial revenue of the renewal must not include the collateral
+	// carried over from the renewed contract
+	renewalRevenue := hostSettings.ContractPrice.Add(basePrice)
+	contract, err := db.Contract(renewalID)
+	if err != nil {
+		t.Fatal(err)
+	} else if !contract.HostFunds.Equals(renewalHostFunds) {
+		t.Fatalf("expected renewal host funds %d, got %d", renewalHostFunds, contract.HostFunds)
+	} else if !contract.InitialValidRevenue.Equals(renewalRevenue) {
+		t.Fatalf("expected renewal initial revenue %d, got %d", renewalRevenue, contract.InitialValidRevenue)
+	}
+
+	// the transfer and the initial revenue of both contracts are pending
+	// until they are resolved. Together they are what the host is paid less
+	// what it funded.
+	expectedPending := finalRev.ValidHostPayout().Add(renewal.ValidHostPayout()).Sub(collateral).Sub(renewalHostFunds)
+	if expected := hostSettings.ContractPrice.Add(transfer).Add(renewalRevenue); !expectedPending.Equals(expected) {
+		t.Fatalf("expected pending revenue %d, got %d", expected, expectedPending)
+	}
+
+	pending, err := db.PendingRevenue()
+	if err != nil {
+		t.Fatal(err)
+	} else if pending.Active != 2 {
+		t.Fatalf("expected 2 pending contracts, got %d", pending.Active)
+	} else if !pending.Revenue.SC.Equals(expectedPending) {
+		t.Fatalf("expected pending revenue %d, got %d", expectedPending, pending.Revenue.SC)
+	}
+
+	// both contracts expire within the forecast
+	forecast, err := db.RevenueForecast(30)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(forecast) != 30 {
+		t.Fatalf("expected 30 days, got %d", len(forecast))
+	}
+	var forecastContracts int
+	var forecastRevenue types.Currency
+	for _, day := range forecast {
+		forecastContracts += day.Contracts
+		forecastRevenue = forecastRevenue.Add(day.Revenue.SC)
+	}
+	if forecastContracts != 2 {
+		t.Fatalf("expected 2 forecast contracts, got %d", forecastContracts)
+	} else if !forecastRevenue.Equals(expectedPending) {
+		t.Fatalf("expected forecast revenue %d, got %d", expectedPending, forecastRevenue)
+	}
+
+	// mine until the renewed contract expires without a proof
+	expirationHeight := int(fc.WindowEnd-cm.TipState().Index.Height+uint64(stypes.MaturityDelay)) + 1
+	if err := miner.Mine(w.Address(), expirationHeight); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Second) // sync time
+
+	contract, err = db.Contract(fcID)
+	if err != nil {
+		t.Fatal(err)
+	} else if contract.RenewedTo == nil || *contract.RenewedTo != renewalID {
+		t.Fatalf("expected contract to be renewed to %v, got %v", renewalID, contract.RenewedTo)
+	} else if contract.Status != stats.ContractStatusValid {
+		t.Fatalf("expected renewed contract to be valid, got %q", contract.Status)
+	} else if expected := transfer.Add(hostSettings.ContractPrice); !contract.Revenue.SC.Equals(expected) {
+		t.Fatalf("expected revenue %d, got %d", expected, contract.Revenue.SC)
+	}
+	expectedFees := hostSettings.ContractPrice
+
+	contract, err = db.Contract(renewalID)
+	if err != nil {
+		t.Fatal(err)
+	} else if contract.RenewedFrom == nil || *contract.RenewedFrom != fcID {
+		t.Fatalf("expected contract to be renewed from %v, got %v", fcID, contract.RenewedFrom)
+	} else if contract.Status != stats.ContractStatusActive {
+		t.Fatalf("expected renewal to be active, got %q", contract.Status)
+	} else if contract.EstimateStatus != stats.EstimateStatusEstimated || contract.HostFundsMethod != stats.FundsEstimateAddress {
+		t.Fatalf("expected renewal to be estimated by address, got %q %q", contract.EstimateStatus, contract.HostFundsMethod)
+	}
+
+	// the renewed contract should not count as missed
+	metrics, err := db.Metrics(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	} else if metrics.Active != 1 {
+		t.Fatal("expected 1 active contract, got", metrics.Active)
+	} else if metrics.Valid != 1 {
+		t.Fatal("expected 1 valid contract, got", metrics.Valid)
+	} else if metrics.Missed != 0 {
+		t.Fatal("expected 0 missed contracts, got", metrics.Missed)
+	} else if !metrics.Collateral.Burned.IsZero() {
+		t.Fatal("expected no burned collateral, got", metrics.Collateral.Burned)
+	} else if metrics.Estimates != (stats.EstimateCoverage{Estimated: 2}) {
+		// the host funds both contracts from its payout address
+		t.Fatalf("expected both contracts to be estimated, got %+v", metrics.Estimates)
+	} else if !metrics.Accrued.SC.Equals(expectedPending) {
+		// revenue is recognized as the contracts are formed and revised
+		t.Fatalf("expected accrued revenue %d, got %d", expectedPending, metrics.Accrued.SC)
+	} else if !metrics.Reversed.SC.IsZero() {
+		t.Fatalf("expected no reversed revenue, got %d", metrics.Reversed.SC)
+	} else if !metrics.FeeRevenue.SC.Equals(expectedFees) {
+		t.Fatalf("expected fee revenue %d, got %d", expectedFees, metrics.FeeRevenue.SC)
+	} else if !metrics.RevisionRevenue.SC.Equals(transfer) {
+		t.Fatalf("expected revision revenue %d, got %d", transfer, metrics.RevisionRevenue.SC)
+	} else if !metrics.FeeRevenue.Add(metrics.RevisionRevenue).SC.Equals(metrics.Revenue.SC) {
+		t.Fatalf("expected fee and revision revenue to sum to %d", metrics.Revenue.SC)
+	} else if expected := decimal.NewFromBigInt(metrics.Revenue.SC.Big(), -24).Mul(decimal.NewFromFloat(0.0000005)); !metrics.Revenue.BTC.Equal(expected) {
+		t.Fatalf("expected revenue %s BTC, got %s BTC", expected, metrics.Revenue.BTC)
+	}
+
+	// periods after the last stats carry the latest state forward
+	periods, err := db.Periods(time.Now().Add(time.Hour), time.Now().Add(3*time.Hour), stats.PeriodHourly)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(periods) != 3 {
+		t.Fatalf("expected 3 periods, got %d", len(periods))
+	}
+	for _, period := range periods {
+		if period.Valid != metrics.Valid || !period.Revenue.SC.Equals(metrics.Revenue.SC) {
+			t.Fatalf("expected period %v to carry forward %d valid contracts and %d revenue, got %d and %d", period.Timestamp, metrics.Valid, metrics.Revenue.SC, period.Valid, period.Revenue.SC)
+		}
+	}
+}
+
+func TestReorg(t *testing.T) {
+	log := zaptest.NewLogger(t)
+	dir := t.TempDir()
+
+	g, err := gateway.New(":0", false, filepath.Join(dir, "gateway"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+
+	cs, errCh := consensus.New(g, false, filepath.Join(dir, "consensus"))
+	select {
+	case err := <-errCh:
+		if err != nil {
+			t.Fatal(err)
+		}
+	default:
+		go func() {
+			if err := <-errCh; err != nil && !strings.Contains(err.Error(), "ThreadGroup already stopped") {
+				panic(err)
+			}
+		}()
+	}
+	defer cs.Close()
+
+	cm, err := chain.NewManager(cs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cm.Close()
+
+	stp, err := transactionpool.New(cs, g, filepath.Join(dir, "tpool"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stp.Close()
+	tp := chain.NewTPool(stp)
+
+	w := test.NewWallet()
+	if err := cs.ConsensusSetSubscribe(w, modules.ConsensusChangeBeginning, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := sqlite.OpenDatabase(filepath.Join(dir, "test.db"), sqlite.DefaultConfirmations, log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := db.AddMarketData(decimal.NewFromFloat(0.01), decimal.NewFromFloat(0.009), decimal.NewFromFloat(0.0000005), time.Now()); err != nil {
+		t.Fatal(err)
+	} else if err := cs.ConsensusSetSubscribe(db, modules.ConsensusChangeBeginning, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	miner := test.NewMiner(cm)
+	if err := cs.ConsensusSetSubscribe(miner, modules.ConsensusChangeBeginning, nil); err != nil {
+		t.Fatal(err)
+	}
+	tp.Subscribe(miner)
+
+	// create a second consensus set to mine the fork on
+	g2, err := gateway.New(":0", false, filepath.Join(dir, "gateway2"))
 	if err != nil {
 		t.Fatal(err)
-	} else if stats.Active != 0 {
-		t.Fatal("expected 0 active contracts, got", stats.Active)
-	} else if stats.Missed != 2 {
-		t.Fatal("expected 2 missed contracts, got", stats.Missed)
-	} else if stats.Valid != 1 {
-		t.Fatal("expected 1 valid contract, got", stats.Valid)
-	} else if !stats.Payout.SC.Equals(expectedPayout) {
-		t.Fatalf("expected payout to be %d, got %d", expectedPayout, stats.Payout.SC)
-	} else if !stats.Revenue.SC.Equals(expectedRevenue) {
-		t.Fatalf("expected revenue to be %d, got %d", expectedRevenue, stats.Revenue.SC)
 	}
+	defer g2.Close()
+
+	cs2, errCh := consensus.New(g2, false, filepath.Join(dir, "consensus2"))
+	select {
+	case err := <-errCh:
+		if err != nil {
+			t.Fatal(err)
+		}
+	default:
+		go func() {
+			if err := <-errCh; err != nil && !strings.Contains(err.Error(), "ThreadGroup already stopped") {
+				panic(err)
+			}
+		}()
+	}
+	defer cs2.Close()
+
+	cm2, err := chain.NewManager(cs2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cm2.Close()
+
+	miner2 := test.NewMiner(cm2)
+	if err := cs2.ConsensusSetSubscribe(miner2, modules.ConsensusChangeBeginning, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// mine until the wallet has funds and all forks have been resolved
+	if err := miner.Mine(w.Address(), int(stypes.MaturityDelay)*4); err != nil {
+		t.Fatal(err)
+	}
+
+	renterKey := types.NewPrivateKeyFromSeed(frand.Bytes(32))
+	hostKey := types.NewPrivateKeyFromSeed(frand.Bytes(32))
+	// minimal rhp2 settings for contract formation
+	hostSettings := rhp2.HostSettings{
+		Address:       hostKey.PublicKey().StandardAddress(),
+		WindowSize:    10,
+		ContractPrice: types.Siacoins(1).Div64(4),
+	}
+
+	formContract := func(duration uint64) (types.FileContractID, types.FileContract) {
+		t.Helper()
+
+		fc := rhp2.PrepareContractFormation(renterKey.PublicKey(), hostKey.PublicKey(), types.Siacoins(100), types.Siacoins(200), cm.TipState().Index.Height+duration, hostSettings, w.Address())
+		txn := types.Transaction{
+			FileContracts: []types.FileContract{fc},
+		}
+
+		// the inputs are not released so that contracts formed in the same
+		// block do not spend the same outputs
+		toSign, _, err := w.FundTransaction(&txn, fc.Payout)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := w.Sign(&txn, cm.TipState(), toSign, types.CoveredFields{WholeTransaction: true}); err != nil {
+			t.Fatal(err)
+		} else if err := tp.AcceptTransactionSet([]types.Transaction{txn}); err != nil {
+			t.Fatal(err)
+		}
+		return txn.FileContractID(0), fc
+	}
+
+	reviseContract := func(id types.FileContractID, fc types.FileContract, transfer types.Currency) types.FileContractRevision {
+		t.Helper()
 
+		rev := types.FileContractRevision{
+			ParentID: id,
+			UnlockConditions: types.UnlockConditions{
+				PublicKeys: []types.UnlockKey{
+					renterKey.PublicKey().UnlockKey(),
+					hostKey.PublicKey().UnlockKey(),
+				},
+				SignaturesRequired: 2,
+			},
+			FileContract: fc,
+		}
+		rev.RevisionNumber++
+		rev.ValidProofOutputs = append([]types.SiacoinOutput(nil), fc.ValidProofOutputs...)
+		rev.MissedProofOutputs = append([]types.SiacoinOutput(nil), fc.MissedProofOutputs...)
+		rev.ValidProofOutputs[0].Value = rev.ValidProofOutputs[0].Value.Sub(transfer)
+		rev.ValidProofOutputs[1].Value = rev.ValidProofOutputs[1].Value.Add(transfer)
+		rev.MissedProofOutputs[0].Value = rev.MissedProofOutputs[0].Value.Sub(transfer)
+		rev.MissedProofOutputs[2].Value = rev.MissedProofOutputs[2].Value.Add(transfer)
+
+		txn := types.Transaction{
+			FileContractRevisions: []types.FileContractRevision{rev},
+			Signatures: []types.TransactionSignature{
+				{
+					ParentID:       types.Hash256(id),
+					CoveredFields:  types.CoveredFields{FileContractRevisions: []uint64{0}},
+					PublicKeyIndex: 0,
+				},
+				{
+					ParentID:       types.Hash256(id),
+					CoveredFields:  types.CoveredFields{FileContractRevisions: []uint64{0}},
+					PublicKeyIndex: 1,
+				},
+			},
+		}
+		sigHash := cm.TipState().PartialSigHash(txn, types.CoveredFields{FileContractRevisions: []uint64{0}})
+		renterSig, hostSig := renterKey.SignHash(sigHash), hostKey.SignHash(sigHash)
+		txn.Signatures[0].Signature = renterSig[:]
+		txn.Signatures[1].Signature = hostSig[:]
+
+		if err := tp.AcceptTransactionSet([]types.Transaction{txn}); err != nil {
+			t.Fatal(err)
+		}
+		return rev
+	}
+
+	// form a contract that will stay active through the fork
+	activeID, active := formContract(200)
+	if err := miner.Mine(w.Address(), 1); err != nil {
+		t.Fatal(err)
+	}
+
+	// sync the second consensus set
+	forkHeight := cm.TipState().Index.Height
+	for height := uint64(1); height <= forkHeight; height++ {
+		b, ok := cm.BlockAtHeight(height)
+		if !ok {
+			t.Fatalf("missing block at height %d", height)
+		} else if err := cm2.AcceptBlock(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	time.Sleep(time.Second) // sync time
+
+	preFork, err := db.Metrics(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	} else if preFork.Active != 1 {
+		t.Fatal("expected 1 active contract, got", preFork.Active)
+	}
+
+	// revise the active contract, form a contract that will miss its proof,
+	// and a contract that will be proven on the original chain
+	reviseContract(activeID, active, types.Siacoins(10))
+	formContract(5)
+	provenID, proven := formContract(10)
+	if err := miner.Mine(w.Address(), 1); err != nil {
+		t.Fatal(err)
+	}
+
+	// mine until the proof window of the second contract
+	if err := miner.Mine(w.Address(), int(proven.WindowStart-cm.TipState().Index.Height)+1); err != nil {
+		t.Fatal(err)
+	}
+
+	// since there is no data an empty proof is valid
+	proofTxn := types.Transaction{
+		StorageProofs: []types.StorageProof{{ParentID: provenID}},
+	}
+	if err := tp.AcceptTransactionSet([]types.Transaction{proofTxn}); err != nil {
+		t.Fatal(err)
+	}
+
+	// mine until both contracts have matured
+	if err := miner.Mine(w.Address(), int(proven.WindowEnd-cm.TipState().Index.Height+uint64(stypes.MaturityDelay))+1); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Second) // sync time
+
+	state, err := db.Metrics(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	} else if state.Active != 1 {
+		t.Fatal("expected 1 active contract, got", state.Active)
+	} else if state.Valid != 1 {
+		t.Fatal("expected 1 valid contract, got", state.Valid)
+	} else if state.Missed != 1 {
+		t.Fatal("expected 1 missed contract, got", state.Missed)
+	} else if state.Payout.SC.IsZero() {
+		t.Fatal("expected non-zero payout")
+	}
+
+	contract, err := db.Contract(activeID)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(contract.Revisions) != 1 {
+		t.Fatalf("expected 1 revision, got %d", len(contract.Revisions))
+	}
+
+	// the block summaries should list the proof and resolution
+	contract, err = db.Contract(provenID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proofBlock, err := db.BlockAtHeight(contract.ProofHeight)
+	if err != nil {
+		t.Fatal(err)
+	} else if proofBlock.ID != *contract.ProofBlockID {
+		t.Fatalf("expected block %v, got %v", *contract.ProofBlockID, proofBlock.ID)
+	} else if len(proofBlock.Proven) != 1 || proofBlock.Proven[0] != provenID {
+		t.Fatalf("expected contract %v to be proven, got %v", provenID, proofBlock.Proven)
+	}
+
+	resolutionBlock, err := db.Block(*contract.ResolutionBlockID)
+	if err != nil {
+		t.Fatal(err)
+	} else if resolutionBlock.Height != contract.ResolutionHeight {
+		t.Fatalf("expected height %d, got %d", contract.ResolutionHeight, resolutionBlock.Height)
+	} else if len(resolutionBlock.MaturedValid) != 1 || resolutionBlock.MaturedValid[0] != provenID {
+		t.Fatalf("expected contract %v to mature valid, got %v", provenID, resolutionBlock.MaturedValid)
+	} else if !resolutionBlock.Payout.SC.Equals(contract.Payout.SC) {
+		t.Fatalf("expected payout %d, got %d", contract.Payout.SC, resolutionBlock.Payout.SC)
+	}
+
+	// the stats at a height should only include the blocks up to it, even
+	// if later blocks share its timestamp
+	for height, valid := range map[uint64]int{contract.ResolutionHeight - 1: 0, contract.ResolutionHeight: 1} {
+		state, err := db.MetricsAtHeight(height)
+		if err != nil {
+			t.Fatal(err)
+		} else if state.Valid != valid {
+			t.Fatalf("expected %d valid contracts at height %d, got %d", valid, height, state.Valid)
+		}
+	}
+	if _, err := db.MetricsAtHeight(cm.TipState().Index.Height + 1); !errors.Is(err, stats.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	// mine a longer fork on the second consensus set
+	if err := miner2.Mine(types.VoidAddress, int(cm.TipState().Index.Height-forkHeight)+5); err != nil {
+		t.Fatal(err)
+	}
+
+	// reorg the first consensus set onto the fork
+	for height := forkHeight + 1; height <= cm2.TipState().Index.Height; height++ {
+		b, ok := cm2.BlockAtHeight(height)
+		if !ok {
+			t.Fatalf("missing block at height %d", height)
+		} else if err := cm.AcceptBlock(b); err != nil && !errors.Is(err, modules.ErrNonExtendingBlock) {
+			t.Fatal(err)
+		}
+	}
+	time.Sleep(time.Second) // sync time
+
+	if cm.TipState().Index != cm2.TipState().Index {
+		t.Fatalf("expected tip %v, got %v", cm2.TipState().Index, cm.TipState().Index)
+	}
+
+	// the stats should be back to their pre-fork values
+	state, err = db.Metrics(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	} else if state.Active != preFork.Active {
+		t.Fatalf("expected %d active contracts, got %d", preFork.Active, state.Active)
+	} else if state.Valid != preFork.Valid {
+		t.Fatalf("expected %d valid contracts, got %d", preFork.Valid, state.Valid)
+	} else if state.Missed != preFork.Missed {
+		t.Fatalf("expected %d missed contracts, got %d", preFork.Missed, state.Missed)
+	} else if !state.Payout.SC.Equals(preFork.Payout.SC) {
+		t.Fatalf("expected payout %d, got %d", preFork.Payout.SC, state.Payout.SC)
+	} else if !state.Payout.USD.Equal(preFork.Payout.USD) {
+		t.Fatalf("expected payout %s USD, got %s USD", preFork.Payout.USD, state.Payout.USD)
+	} else if !state.Revenue.SC.Equals(preFork.Revenue.SC) {
+		t.Fatalf("expected revenue %d, got %d", preFork.Revenue.SC, state.Revenue.SC)
+	}
+
+	// the host's stats should also be reverted
+	hostState, err := db.HostMetrics(hostSettings.Address, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	} else if hostState.Active != preFork.Active || hostState.Valid != preFork.Valid || hostState.Missed != preFork.Missed {
+		t.Fatalf("expected host contracts to match pre-fork stats, got %d/%d/%d", hostState.Active, hostState.Valid, hostState.Missed)
+	} else if !hostState.Revenue.SC.Equals(preFork.Revenue.SC) {
+		t.Fatalf("expected host revenue %d, got %d", preFork.Revenue.SC, hostState.Revenue.SC)
+	}
+
+	// the revision on the original chain should be reverted
+	contract, err = db.Contract(activeID)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(contract.Revisions) != 0 {
+		t.Fatalf("expected no revisions, got %d", len(contract.Revisions))
+	} else if !contract.ValidPayout.Equals(active.ValidHostPayout()) {
+		t.Fatalf("expected valid payout %d, got %d", active.ValidHostPayout(), contract.ValidPayout)
+	}
+
+	// the contracts formed on the original chain should no longer exist
+	if _, err := db.Contract(provenID); !errors.Is(err, stats.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	// the event feed keeps the original chain's events and records the
+	// reorg
+	var events []stats.ContractEvent
+	var cursor uint64
+	for {
+		page, err := db.Events(cursor, 10)
+		if err != nil {
+			t.Fatal(err)
+		} else if len(page) == 0 {
+			break
+		}
+		for _, event := range page {
+			if event.ID <= cursor {
+				t.Fatalf("expected event ID greater than %d, got %d", cursor, event.ID)
+			}
+			cursor = event.ID
+		}
+		events = append(events, page...)
+	}
+
+	kinds := make(map[string]int)
+	for _, event := range events {
+		kinds[event.Kind]++
+		if event.Kind == stats.EventMaturedValid && (event.ContractID == nil || *event.ContractID != provenID) {
+			t.Fatalf("expected contract %v to mature valid, got %v", provenID, event.ContractID)
+		} else if event.Kind == stats.EventProofReverted && (event.ContractID == nil || *event.ContractID != provenID) {
+			t.Fatalf("expected proof of contract %v to be reverted, got %v", provenID, event.ContractID)
+		}
+	}
+	if kinds[stats.EventProofSubmitted] != 1 || kinds[stats.EventProofReverted] != 1 {
+		t.Fatalf("expected 1 submitted and 1 reverted proof, got %d and %d", kinds[stats.EventProofSubmitted], kinds[stats.EventProofReverted])
+	} else if kinds[stats.EventMaturedValid] != 1 || kinds[stats.EventMaturedMissed] != 1 {
+		t.Fatalf("expected 1 valid and 1 missed contract, got %d and %d", kinds[stats.EventMaturedValid], kinds[stats.EventMaturedMissed])
+	} else if kinds[stats.EventContractRevised] != 1 {
+		t.Fatalf("expected 1 revision, got %d", kinds[stats.EventContractRevised])
+	} else if kinds[stats.EventBlockReverted] == 0 {
+		t.Fatal("expected reverted blocks")
+	}
+
+	// the contracts resolved on the original chain should be removed from
+	// the archive
+	archived, err := db.ArchivedTotals(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	} else if archived.Valid != 0 || archived.Missed != 0 {
+		t.Fatalf("expected no archived contracts, got %d valid and %d missed", archived.Valid, archived.Missed)
+	}
 }
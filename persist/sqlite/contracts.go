@@ -1,34 +1,20 @@
 package sqlite
 
 import (
+	"database/sql"
+	"errors"
 	"fmt"
 	"time"
 
+	"go.sia.tech/core/types"
 	"go.sia.tech/host-revenue-api/stats"
 )
 
-func scanContractState(row scanner) (state stats.ContractState, err error) {
-	err = row.Scan(&state.Active, &state.Valid, &state.Missed,
-		(*sqlCurrency)(&state.Payout.SC),
-		&state.Payout.USD,
-		&state.Payout.EUR,
-		&state.Payout.BTC,
-		(*sqlCurrency)(&state.Revenue.SC),
-		&state.Revenue.USD,
-		&state.Revenue.EUR,
-		&state.Revenue.BTC,
-		(*sqlTime)(&state.Timestamp))
-	return
-}
-
 func getMetrics(tx txn, timestamp time.Time) (stats.ContractState, error) {
-	const query = `SELECT active_contracts, valid_contracts, missed_contracts, 
-total_payouts_sc, total_payouts_usd, total_payouts_eur, total_payouts_btc,
-estimated_revenue_sc, estimated_revenue_usd, estimated_revenue_eur, estimated_revenue_btc,
-date_created 
-FROM hourly_contract_stats 
-WHERE date_created <= $1 
-ORDER BY date_created DESC 
+	const query = `SELECT ` + statColumns + `, date_created
+FROM hourly_contract_stats
+WHERE date_created <= $1
+ORDER BY date_created DESC
 LIMIT 1`
 
 	row := tx.QueryRow(query, sqlTime(timestamp))
@@ -41,34 +27,136 @@ func (s *Store) Metrics(timestamp time.Time) (state stats.ContractState, err err
 		state, err = getMetrics(tx, timestamp)
 		return err
 	})
+	state.Confirmations = s.confirmations
+	return
+}
+
+// getMetricsAtHeight returns the contract stats as of the block at the height.
+// The stats are stored by timestamp and block timestamps are not strictly
+// increasing, so the state at the block's timestamp is corrected with the
+// deltas of the blocks that are out of order.
+func getMetricsAtHeight(tx txn, height uint64) (state stats.ContractState, err error) {
+	var timestamp time.Time
+	err = tx.QueryRow(`SELECT date_created FROM blocks WHERE height=$1`, height).Scan((*sqlTime)(&timestamp))
+	if errors.Is(err, sql.ErrNoRows) {
+		return stats.ContractState{}, stats.ErrNotFound
+	} else if err != nil {
+		return stats.ContractState{}, fmt.Errorf("failed to get block: %w", err)
+	}
+
+	state, err = getMetrics(tx, timestamp)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return stats.ContractState{}, fmt.Errorf("failed to get contract stats: %w", err)
+	}
+
+	deltas := func(where string) ([]statDelta, error) {
+		rows, err := tx.Query(`SELECT `+statColumns+` FROM block_contract_stats s
+INNER JOIN blocks b ON s.block_id=b.id
+WHERE `+where, height, sqlTime(timestamp))
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		var deltas []statDelta
+		for rows.Next() {
+			var delta statDelta
+			if err := rows.Scan(delta.dest()...); err != nil {
+				return nil, fmt.Errorf("failed to scan block stats: %w", err)
+			}
+			deltas = append(deltas, delta)
+		}
+		return deltas, rows.Err()
+	}
+
+	// later blocks with an earlier or equal timestamp are included in the
+	// state, earlier blocks with a later timestamp are not
+	later, err := deltas(`b.height > $1 AND b.date_created <= $2`)
+	if err != nil {
+		return stats.ContractState{}, fmt.Errorf("failed to get later block stats: %w", err)
+	}
+	for _, delta := range later {
+		if state, err = delta.Revert(state); err != nil {
+			return stats.ContractState{}, fmt.Errorf("failed to revert block stats: %w", err)
+		}
+	}
+	earlier, err := deltas(`b.height <= $1 AND b.date_created > $2`)
+	if err != nil {
+		return stats.ContractState{}, fmt.Errorf("failed to get earlier block stats: %w", err)
+	}
+	for _, delta := range earlier {
+		if state, err = delta.Apply(state); err != nil {
+			return stats.ContractState{}, fmt.Errorf("failed to apply block stats: %w", err)
+		}
+	}
+	state.Timestamp = timestamp
+	return state, nil
+}
+
+// MetricsAtHeight returns the contract stats as of the block at the height.
+func (s *Store) MetricsAtHeight(height uint64) (state stats.ContractState, err error) {
+	err = s.transaction(func(tx txn) error {
+		state, err = getMetricsAtHeight(tx, height)
+		return err
+	})
+	state.Confirmations = s.confirmations
+	return
+}
+
+// ArchivedTotals returns the number of resolved contracts and their revenue
+// and payout summed from the contract archive as of the timestamp. Contracts
+// resolved before the archive was added are not included.
+func (s *Store) ArchivedTotals(timestamp time.Time) (state stats.ContractState, err error) {
+	err = s.transaction(func(tx txn) error {
+		const query = `SELECT c.valid, c.payout_sc, c.payout_usd, c.payout_eur, c.payout_btc,
+c.estimated_revenue_sc, c.estimated_revenue_usd, c.estimated_revenue_eur, c.estimated_revenue_btc
+FROM archived_contracts c
+INNER JOIN blocks b ON c.resolved_block_id=b.id
+WHERE b.date_created <= $1`
+		rows, err := tx.Query(query, sqlTime(timestamp))
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var valid bool
+			var revenue, payout stats.Values
+			err := rows.Scan(&valid, (*sqlCurrency)(&payout.SC), &payout.USD, &payout.EUR, &payout.BTC,
+				(*sqlCurrency)(&revenue.SC), &revenue.USD, &revenue.EUR, &revenue.BTC)
+			if err != nil {
+				return fmt.Errorf("failed to scan archived contract: %w", err)
+			}
+
+			if valid {
+				state.Valid++
+			} else {
+				state.Missed++
+			}
+			state.Revenue = state.Revenue.Add(revenue)
+			state.Payout = state.Payout.Add(payout)
+		}
+		return rows.Err()
+	})
+	state.Timestamp = timestamp
 	return
 }
 
 func (s *Store) Periods(start, end time.Time, period string) (state []stats.ContractState, err error) {
+	var initial stats.ContractState
 	values := make(map[int64]stats.ContractState)
+	start, end = periodRange(start, end, period)
 	err = s.transaction(func(tx txn) error {
-		const query = `SELECT active_contracts, valid_contracts, missed_contracts, 
-total_payouts_sc, total_payouts_usd, total_payouts_eur, total_payouts_btc,
-estimated_revenue_sc, estimated_revenue_usd, estimated_revenue_eur, estimated_revenue_btc,
-date_created
+		// periods without stats carry forward the state before start
+		initial, err = getMetrics(tx, start.Add(-time.Second))
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("failed to get initial state: %w", err)
+		}
+
+		const query = `SELECT ` + statColumns + `, date_created
 FROM hourly_contract_stats
 WHERE date_created BETWEEN $1 AND $2
 ORDER BY date_created ASC`
-		start = stats.NormalizePeriod(start, period)
-		end = stats.NormalizePeriod(end, period)
-
-		switch period {
-		case stats.PeriodHourly: // end of the hour
-			end = end.Add(time.Hour)
-		case stats.PeriodDaily: // end of the day
-			end = end.AddDate(0, 0, 1)
-		case stats.PeriodWeekly: // end of the week
-			end = end.AddDate(0, 0, 7-int(end.Weekday()))
-		case stats.PeriodMonthly: // end of the month
-			end = end.AddDate(0, 1, 0)
-		default:
-			panic("invalid period")
-		}
 
 		rows, err := tx.Query(query, sqlTime(start), sqlTime(end))
 		if err != nil {
@@ -83,13 +171,76 @@ ORDER BY date_created ASC`
 			}
 
 			state.Timestamp = stats.NormalizePeriod(state.Timestamp.In(start.Location()), period)
+			state.Confirmations = s.confirmations
 			values[state.Timestamp.Unix()] = state
 		}
 		return nil
 	})
+	initial.Confirmations = s.confirmations
+	return fillPeriods(initial, values, start, end, period), err
+}
 
-	// build the array
-	var prev stats.ContractState
+// ProofPeriods returns the contracts that matured valid or missed in each
+// period between start and end.
+func (s *Store) ProofPeriods(start, end time.Time, period string) ([]stats.ProofPeriod, error) {
+	// the period before start is the baseline of the first period
+	states, err := s.Periods(prevPeriod(stats.NormalizePeriod(start, period), period), end, period)
+	if err != nil {
+		return nil, err
+	}
+	return proofPeriods(states), nil
+}
+
+// proofPeriods returns the difference between each cumulative state and the
+// state of the previous period. The first state is only used as the baseline.
+func proofPeriods(states []stats.ContractState) []stats.ProofPeriod {
+	if len(states) == 0 {
+		return nil
+	}
+
+	periods := make([]stats.ProofPeriod, 0, len(states)-1)
+	for i := 1; i < len(states); i++ {
+		p := stats.ProofPeriod{
+			Valid:         states[i].Valid - states[i-1].Valid,
+			Missed:        states[i].Missed - states[i-1].Missed,
+			Confirmations: states[i].Confirmations,
+			Timestamp:     states[i].Timestamp,
+		}
+		if matured := p.Valid + p.Missed; matured > 0 {
+			p.SuccessRatio = float64(p.Valid) / float64(matured)
+		}
+		periods = append(periods, p)
+	}
+	return periods
+}
+
+// periodRange normalizes start to the beginning of its period and end to the
+// end of its period.
+func periodRange(start, end time.Time, period string) (time.Time, time.Time) {
+	start = stats.NormalizePeriod(start, period)
+	end = stats.NormalizePeriod(end, period)
+
+	switch period {
+	case stats.PeriodHourly: // end of the hour
+		end = end.Add(time.Hour)
+	case stats.PeriodDaily: // end of the day
+		end = end.AddDate(0, 0, 1)
+	case stats.PeriodWeekly: // end of the week
+		end = end.AddDate(0, 0, 7-int(end.Weekday()))
+	case stats.PeriodMonthly: // end of the month
+		end = end.AddDate(0, 1, 0)
+	default:
+		panic("invalid period")
+	}
+	return start, end
+}
+
+// fillPeriods builds the array of states for each period between start and
+// end from the states keyed by their normalized timestamp. The stats are
+// cumulative, so periods without a state carry forward the previous period's
+// state, starting from the initial state.
+func fillPeriods(initial stats.ContractState, values map[int64]stats.ContractState, start, end time.Time, period string) (state []stats.ContractState) {
+	prev := initial
 	for t := start; t.Before(end); t = nextPeriod(t, period) {
 		v, ok := values[t.Unix()]
 		if !ok {
@@ -97,10 +248,26 @@ ORDER BY date_created ASC`
 		}
 		v.Timestamp = t
 		state = append(state, v)
+		prev = v
 	}
 	return
 }
 
+func prevPeriod(timestamp time.Time, period string) time.Time {
+	switch period {
+	case stats.PeriodHourly:
+		return timestamp.Add(-time.Hour)
+	case stats.PeriodDaily:
+		return timestamp.AddDate(0, 0, -1)
+	case stats.PeriodWeekly:
+		return timestamp.AddDate(0, 0, -7)
+	case stats.PeriodMonthly:
+		return timestamp.AddDate(0, -1, 0)
+	default:
+		panic("invalid period")
+	}
+}
+
 func nextPeriod(timestamp time.Time, period string) time.Time {
 	switch period {
 	case stats.PeriodHourly:
@@ -115,3 +282,196 @@ func nextPeriod(timestamp time.Time, period string) time.Time {
 		panic("invalid period")
 	}
 }
+
+func contractRevisions(tx txn, id types.FileContractID) (revisions []stats.ContractRevision, err error) {
+	const query = `SELECT r.revision_number, b.block_id, b.height, r.valid_payout_value, r.missed_payout_value, r.void_payout_value, r.filesize
+FROM contract_revisions r
+INNER JOIN blocks b ON r.block_id=b.id
+WHERE r.contract_id=$1
+ORDER BY r.id ASC`
+	rows, err := tx.Query(query, sqlHash256(id))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var rev stats.ContractRevision
+		err := rows.Scan((*sqlUint64)(&rev.RevisionNumber), (*sqlHash256)(&rev.BlockID), &rev.Height, (*sqlCurrency)(&rev.ValidPayout), (*sqlCurrency)(&rev.MissedPayout), (*sqlCurrency)(&rev.VoidPayout), (*sqlUint64)(&rev.Filesize))
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan revision: %w", err)
+		}
+		revisions = append(revisions, rev)
+	}
+	return revisions, rows.Err()
+}
+
+// scanContractLifecycle scans the common contract columns followed by any
+// additional destinations.
+func scanContractLifecycle(row scanner, extra ...any) (c stats.ContractLifecycle, err error) {
+	var proofBlockID, resolutionBlockID types.BlockID
+	proofID, resolutionID := nullable((*sqlHash256)(&proofBlockID)), nullable((*sqlHash256)(&resolutionBlockID))
+	var proofHeight, resolutionHeight sql.NullInt64
+	var hostAddr types.Address
+	hostID := nullable((*sqlHash256)(&hostAddr))
+	dest := []any{(*sqlHash256)(&c.ID), (*sqlHash256)(&c.FormationBlockID), &c.FormationHeight, &c.ExpirationHeight,
+		proofID, &proofHeight, resolutionID, &resolutionHeight, hostID,
+		(*sqlCurrency)(&c.InitialValidPayout), (*sqlCurrency)(&c.InitialMissedPayout),
+		(*sqlCurrency)(&c.InitialValidRevenue), (*sqlCurrency)(&c.InitialMissedRevenue), (*sqlCurrency)(&c.HostFunds), &c.HostFundsMethod, &c.EstimateStatus, &c.EstimatorVersion, (*sqlCurrency)(&c.SiafundTax),
+		(*sqlCurrency)(&c.ValidPayout), (*sqlCurrency)(&c.MissedPayout), (*sqlCurrency)(&c.VoidPayout),
+		(*sqlUint64)(&c.InitialFilesize), (*sqlUint64)(&c.Filesize)}
+	err = row.Scan(append(dest, extra...)...)
+	if err != nil {
+		return
+	}
+
+	c.Status = stats.ContractStatusActive
+	if hostID.Valid {
+		c.HostAddress = &hostAddr
+	}
+	if proofID.Valid {
+		c.ProofBlockID = &proofBlockID
+		c.ProofHeight = uint64(proofHeight.Int64)
+	}
+	if resolutionID.Valid {
+		c.ResolutionBlockID = &resolutionBlockID
+		c.ResolutionHeight = uint64(resolutionHeight.Int64)
+	}
+	return
+}
+
+func archivedContract(tx txn, id types.FileContractID) (stats.ContractLifecycle, error) {
+	const query = `SELECT c.contract_id, b.block_id, b.height, c.expiration_height,
+pb.block_id, pb.height, rb.block_id, rb.height, c.host_address,
+c.initial_valid_payout_value, c.initial_missed_payout_value,
+c.initial_valid_revenue, c.initial_missed_revenue, c.host_funds, c.host_funds_method, c.estimate_status, c.estimator_version, c.siafund_tax,
+c.valid_payout_value, c.missed_payout_value, c.void_payout_value,
+c.initial_filesize, c.filesize,
+c.valid, c.payout_sc, c.payout_usd, c.payout_eur, c.payout_btc,
+c.estimated_revenue_sc, c.estimated_revenue_usd, c.estimated_revenue_eur, c.estimated_revenue_btc,
+c.burned_sc, c.burned_usd, c.burned_eur, c.burned_btc
+FROM archived_contracts c
+INNER JOIN blocks b ON c.block_id=b.id
+INNER JOIN blocks rb ON c.resolved_block_id=rb.id
+LEFT JOIN blocks pb ON c.proof_block_id=pb.id
+WHERE c.contract_id=$1`
+
+	var valid bool
+	var revenue, payout, burned stats.Values
+	c, err := scanContractLifecycle(tx.QueryRow(query, sqlHash256(id)), &valid,
+		(*sqlCurrency)(&payout.SC), &payout.USD, &payout.EUR, &payout.BTC,
+		(*sqlCurrency)(&revenue.SC), &revenue.USD, &revenue.EUR, &revenue.BTC,
+		(*sqlCurrency)(&burned.SC), &burned.USD, &burned.EUR, &burned.BTC)
+	if err != nil {
+		return stats.ContractLifecycle{}, err
+	}
+
+	c.Status = stats.ContractStatusMissed
+	if valid {
+		c.Status = stats.ContractStatusValid
+	}
+	c.Revenue, c.Payout, c.Burned = &revenue, &payout, &burned
+	return c, nil
+}
+
+func activeContract(tx txn, id types.FileContractID) (stats.ContractLifecycle, error) {
+	const query = `SELECT c.contract_id, b.block_id, b.height, c.expiration_height,
+pb.block_id, pb.height, NULL, NULL, c.host_address,
+c.initial_valid_payout_value, c.initial_missed_payout_value,
+c.initial_valid_revenue, c.initial_missed_revenue, c.host_funds, c.host_funds_method, c.estimate_status, c.estimator_version, c.siafund_tax,
+c.valid_payout_value, c.missed_payout_value, c.void_payout_value,
+c.initial_filesize, c.filesize
+FROM active_contracts c
+INNER JOIN blocks b ON c.block_id=b.id
+LEFT JOIN blocks pb ON c.proof_block_id=pb.id
+WHERE c.contract_id=$1`
+	return scanContractLifecycle(tx.QueryRow(query, sqlHash256(id)))
+}
+
+// Contract returns the lifecycle of a file contract. Resolved contracts are
+// read from the archive.
+func (s *Store) Contract(id types.FileContractID) (c stats.ContractLifecycle, err error) {
+	err = s.transaction(func(tx txn) error {
+		c, err = archivedContract(tx, id)
+		if errors.Is(err, sql.ErrNoRows) {
+			c, err = activeContract(tx, id)
+		}
+		if errors.Is(err, sql.ErrNoRows) {
+			return stats.ErrNotFound
+		} else if err != nil {
+			return fmt.Errorf("failed to get contract: %w", err)
+		}
+
+		c.Revisions, err = contractRevisions(tx, id)
+		if err != nil {
+			return fmt.Errorf("failed to get revisions: %w", err)
+		}
+
+		if r, err := contractRenewal(tx, `renewed_to=$1`, id); err == nil {
+			c.RenewedFrom = &r.RenewedFrom
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("failed to get renewal: %w", err)
+		}
+		if r, err := contractRenewal(tx, `renewed_from=$1`, id); err == nil {
+			c.RenewedTo = &r.RenewedTo
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("failed to get renewal: %w", err)
+		}
+		return nil
+	})
+	return
+}
+
+func contractRenewal(tx txn, where string, id types.FileContractID) (r stats.ContractRenewal, err error) {
+	query := `SELECT r.renewed_from, r.renewed_to, b.block_id, b.height
+FROM contract_renewals r
+INNER JOIN blocks b ON r.block_id=b.id
+WHERE ` + where
+	err = tx.QueryRow(query, sqlHash256(id)).Scan((*sqlHash256)(&r.RenewedFrom), (*sqlHash256)(&r.RenewedTo), (*sqlHash256)(&r.BlockID), &r.Height)
+	return
+}
+
+// ContractRenewals returns the renewal chain containing the contract, oldest
+// first. Contracts that were never renewed return an empty chain.
+func (s *Store) ContractRenewals(id types.FileContractID) (renewals []stats.ContractRenewal, err error) {
+	err = s.transaction(func(tx txn) error {
+		var exists bool
+		const existsQuery = `SELECT EXISTS (SELECT 1 FROM active_contracts WHERE contract_id=$1) OR EXISTS (SELECT 1 FROM archived_contracts WHERE contract_id=$1)`
+		if err := tx.QueryRow(existsQuery, sqlHash256(id)).Scan(&exists); err != nil {
+			return fmt.Errorf("failed to check contract: %w", err)
+		} else if !exists {
+			return stats.ErrNotFound
+		}
+
+		// walk back to the first contract in the chain
+		var chain []stats.ContractRenewal
+		for current := id; ; {
+			r, err := contractRenewal(tx, `renewed_to=$1`, current)
+			if errors.Is(err, sql.ErrNoRows) {
+				break
+			} else if err != nil {
+				return fmt.Errorf("failed to get renewal: %w", err)
+			}
+			chain = append([]stats.ContractRenewal{r}, chain...)
+			current = r.RenewedFrom
+		}
+
+		// walk forward to the latest renewal
+		for current := id; ; {
+			r, err := contractRenewal(tx, `renewed_from=$1`, current)
+			if errors.Is(err, sql.ErrNoRows) {
+				break
+			} else if err != nil {
+				return fmt.Errorf("failed to get renewal: %w", err)
+			}
+			chain = append(chain, r)
+			current = r.RenewedTo
+		}
+		renewals = chain
+		return nil
+	})
+	if renewals == nil && err == nil {
+		renewals = []stats.ContractRenewal{}
+	}
+	return
+}
@@ -0,0 +1,143 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+	"sort"
+	"time"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/host-revenue-api/stats"
+)
+
+// distributionBucket returns the power of two bucket containing v.
+func distributionBucket(v uint64) (lower, upper uint64) {
+	if v == 0 {
+		return 0, 1
+	}
+	lower = 1 << (bits.Len64(v) - 1)
+	if lower == 1<<63 {
+		return lower, math.MaxUint64
+	}
+	return lower, lower << 1
+}
+
+// distributionValue returns the value of a contract that is bucketed for the
+// kind. Payouts are bucketed in whole siacoins.
+func distributionValue(kind string, formationHeight, expirationHeight, filesize uint64, payout types.Currency) uint64 {
+	switch kind {
+	case stats.DistributionDuration:
+		if expirationHeight < formationHeight {
+			return 0
+		}
+		return expirationHeight - formationHeight
+	case stats.DistributionSize:
+		return filesize
+	case stats.DistributionPayout:
+		return payout.Div(types.Siacoins(1)).Big().Uint64()
+	default:
+		panic("invalid distribution kind")
+	}
+}
+
+// Distribution returns the active contracts and the archived contracts
+// resolved between start and end bucketed by the kind. Only buckets with
+// contracts are returned.
+func (s *Store) Distribution(kind string, start, end time.Time) (buckets []stats.DistributionBucket, err error) {
+	switch kind {
+	case stats.DistributionDuration, stats.DistributionSize, stats.DistributionPayout:
+	default:
+		return nil, fmt.Errorf("invalid distribution kind %q", kind)
+	}
+
+	values := make(map[uint64]*stats.DistributionBucket)
+	bucket := func(v uint64) *stats.DistributionBucket {
+		lower, upper := distributionBucket(v)
+		b, ok := values[lower]
+		if !ok {
+			b = &stats.DistributionBucket{Min: lower, Max: upper, Confirmations: s.confirmations}
+			values[lower] = b
+		}
+		return b
+	}
+
+	err = s.transaction(func(tx txn) error {
+		const query = `SELECT fb.height, c.expiration_height, c.filesize, c.valid, c.payout_sc,
+c.estimated_revenue_sc, c.estimated_revenue_usd, c.estimated_revenue_eur, c.estimated_revenue_btc
+FROM archived_contracts c
+INNER JOIN blocks fb ON c.block_id=fb.id
+INNER JOIN blocks rb ON c.resolved_block_id=rb.id
+WHERE rb.date_created BETWEEN $1 AND $2`
+		rows, err := tx.Query(query, sqlTime(start), sqlTime(end))
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var formationHeight, expirationHeight, filesize uint64
+			var valid bool
+			var payout types.Currency
+			var revenue stats.Values
+			err := rows.Scan(&formationHeight, &expirationHeight, &filesize, &valid, (*sqlCurrency)(&payout),
+				(*sqlCurrency)(&revenue.SC), &revenue.USD, &revenue.EUR, &revenue.BTC)
+			if err != nil {
+				return fmt.Errorf("failed to scan archived contract: %w", err)
+			}
+
+			b := bucket(distributionValue(kind, formationHeight, expirationHeight, filesize, payout))
+			if valid {
+				b.Valid++
+			} else {
+				b.Missed++
+			}
+			b.Revenue = b.Revenue.Add(revenue)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		height, _, err := chainTip(tx)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("failed to get chain tip: %w", err)
+		}
+
+		contracts, err := pendingContracts(tx, height)
+		if err != nil {
+			return fmt.Errorf("failed to get pending contracts: %w", err)
+		} else if len(contracts) == 0 {
+			return nil
+		}
+
+		usdRate, eurRate, btcRate, err := getExchangeRate(tx, time.Now())
+		if err != nil && !errors.Is(err, errNoExchangeRate) {
+			return fmt.Errorf("failed to get exchange rate: %w", err)
+		}
+
+		pending := make(map[uint64]types.Currency)
+		for _, c := range contracts {
+			b := bucket(distributionValue(kind, c.FormationHeight, c.ExpirationHeight, c.Filesize, c.Payout))
+			b.Active++
+			pending[b.Min] = pending[b.Min].Add(c.Revenue)
+		}
+		for lower, revenue := range pending {
+			values[lower].PendingRevenue = fiatValues(revenue, usdRate, eurRate, btcRate)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	buckets = make([]stats.DistributionBucket, 0, len(values))
+	for _, b := range values {
+		buckets = append(buckets, *b)
+	}
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i].Min < buckets[j].Min })
+	return buckets, nil
+}
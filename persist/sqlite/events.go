@@ -0,0 +1,88 @@
+package sqlite
+
+import (
+	"fmt"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/host-revenue-api/stats"
+)
+
+// addContractEvent appends an event to the contract event feed.
+func addContractEvent(tx txn, event stats.ContractEvent) error {
+	var contractID any
+	if event.ContractID != nil {
+		contractID = sqlHash256(*event.ContractID)
+	}
+
+	const query = `INSERT INTO contract_events (kind, contract_id, block_id, height, date_created, valid_payout_value, missed_payout_value,
+revenue_sc, revenue_usd, revenue_eur, revenue_btc, payout_sc, payout_usd, payout_eur, payout_btc)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)`
+	_, err := tx.Exec(query, event.Kind, contractID, sqlHash256(event.BlockID), event.Height, sqlTime(event.Timestamp),
+		sqlCurrency(event.ValidPayout), sqlCurrency(event.MissedPayout),
+		sqlCurrency(event.Revenue.SC), event.Revenue.USD, event.Revenue.EUR, event.Revenue.BTC,
+		sqlCurrency(event.Payout.SC), event.Payout.USD, event.Payout.EUR, event.Payout.BTC)
+	return err
+}
+
+// blockProofs returns the contracts with a storage proof event in the block
+// since the block was last reverted. The events are used instead of the
+// contracts since resolved contracts are pruned.
+func blockProofs(tx txn, blockID types.BlockID) (ids []types.FileContractID, err error) {
+	const query = `SELECT contract_id FROM contract_events
+WHERE block_id=$1 AND kind=$2 AND id > COALESCE((SELECT MAX(id) FROM contract_events WHERE block_id=$1 AND kind=$3), 0)
+ORDER BY id ASC`
+	rows, err := tx.Query(query, sqlHash256(blockID), stats.EventProofSubmitted, stats.EventBlockReverted)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id types.FileContractID
+		if err := rows.Scan((*sqlHash256)(&id)); err != nil {
+			return nil, fmt.Errorf("failed to scan contract id: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// Events returns up to limit contract events recorded after the cursor, in the
+// order they were recorded.
+func (s *Store) Events(since uint64, limit int) (events []stats.ContractEvent, err error) {
+	events = []stats.ContractEvent{}
+	err = s.transaction(func(tx txn) error {
+		const query = `SELECT id, kind, contract_id, block_id, height, date_created, valid_payout_value, missed_payout_value,
+revenue_sc, revenue_usd, revenue_eur, revenue_btc, payout_sc, payout_usd, payout_eur, payout_btc
+FROM contract_events
+WHERE id > $1
+ORDER BY id ASC
+LIMIT $2`
+
+		rows, err := tx.Query(query, since, limit)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var event stats.ContractEvent
+			var contractID types.FileContractID
+			id := nullable((*sqlHash256)(&contractID))
+			err := rows.Scan(&event.ID, &event.Kind, id, (*sqlHash256)(&event.BlockID), &event.Height, (*sqlTime)(&event.Timestamp),
+				(*sqlCurrency)(&event.ValidPayout), (*sqlCurrency)(&event.MissedPayout),
+				(*sqlCurrency)(&event.Revenue.SC), &event.Revenue.USD, &event.Revenue.EUR, &event.Revenue.BTC,
+				(*sqlCurrency)(&event.Payout.SC), &event.Payout.USD, &event.Payout.EUR, &event.Payout.BTC)
+			if err != nil {
+				return fmt.Errorf("failed to scan event: %w", err)
+			}
+			event.Confirmations = s.confirmations
+			if id.Valid {
+				event.ContractID = &contractID
+			}
+			events = append(events, event)
+		}
+		return rows.Err()
+	})
+	return
+}
@@ -0,0 +1,90 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/mattn/go-sqlite3"
+	"github.com/shopspring/decimal"
+	"go.sia.tech/core/types"
+)
+
+// driverName is the name of the sqlite driver with the store's functions
+// registered.
+const driverName = "sqlite3_revenue"
+
+type (
+	// currencySum sums currency columns.
+	currencySum struct {
+		sum types.Currency
+		err error
+	}
+
+	// decimalSum sums decimal columns.
+	decimalSum struct {
+		sum decimal.Decimal
+		err error
+	}
+)
+
+func (cs *currencySum) Step(buf []byte) {
+	var c sqlCurrency
+	if cs.err != nil {
+		return
+	} else if cs.err = c.Scan(buf); cs.err != nil {
+		return
+	}
+	var overflow bool
+	if cs.sum, overflow = cs.sum.AddWithOverflow(types.Currency(c)); overflow {
+		cs.err = errors.New("currency sum overflows")
+	}
+}
+
+func (cs *currencySum) Done() ([]byte, error) {
+	if cs.err != nil {
+		return nil, cs.err
+	}
+	v, _ := sqlCurrency(cs.sum).Value()
+	return v.([]byte), nil
+}
+
+func (ds *decimalSum) Step(s string) {
+	if ds.err != nil {
+		return
+	}
+	d, err := decimal.NewFromString(s)
+	if err != nil {
+		ds.err = err
+		return
+	}
+	ds.sum = ds.sum.Add(d)
+}
+
+func (ds *decimalSum) Done() (string, error) {
+	return ds.sum.String(), ds.err
+}
+
+// currencyKey returns a key of a currency column that sorts in the same order
+// as the values.
+func currencyKey(buf []byte) []byte {
+	key := make([]byte, len(buf))
+	for i, b := range buf {
+		key[len(buf)-1-i] = b
+	}
+	return key
+}
+
+// registerFunctions registers the functions used by the store's queries on a
+// new connection.
+func registerFunctions(conn *sqlite3.SQLiteConn) error {
+	if err := conn.RegisterAggregator("currency_sum", func() *currencySum { return new(currencySum) }, true); err != nil {
+		return err
+	} else if err := conn.RegisterAggregator("decimal_sum", func() *decimalSum { return new(decimalSum) }, true); err != nil {
+		return err
+	}
+	return conn.RegisterFunc("currency_key", currencyKey, true)
+}
+
+func init() {
+	sql.Register(driverName, &sqlite3.SQLiteDriver{ConnectHook: registerFunctions})
+}
@@ -0,0 +1,154 @@
+package sqlite
+
+import (
+	"go.sia.tech/core/types"
+	"go.sia.tech/host-revenue-api/stats"
+)
+
+// estimatorVersion is the version of the host funds estimator. It is stored
+// with each contract and must be incremented whenever the estimation
+// heuristics change so that Recompute re-estimates existing contracts.
+// Version 1 only separated the renter and host funds by position. Version 2
+// bounded the host funds by the missed payout, which rejected renewals carrying
+// over collateral. Version 3 rejected transactions with inputs or outputs from
+// any address other than the host's payout and the renter's refund address.
+// Version 4 attributed every input to the renter when the host funded the
+// contract from another address.
+const estimatorVersion = 5
+
+// A siacoinElement is a siacoin input or output of a transaction.
+type siacoinElement struct {
+	Value   types.Currency
+	Address types.Address
+}
+
+// A fundsEstimate is the outcome of estimating the host funds of a contract
+// and the initial revenue derived from them.
+type fundsEstimate struct {
+	Status               string
+	Method               string
+	HostFunds            types.Currency
+	InitialValidRevenue  types.Currency
+	InitialMissedRevenue types.Currency
+}
+
+func sum(values []siacoinElement) (t types.Currency) {
+	for _, v := range values {
+		t = t.Add(v.Value)
+	}
+	return
+}
+
+// validHostFunds returns true if the net renter and host funds are consistent
+// with the contract. The renter's net funds must exceed the miner fees and
+// renter valid payout since the renter also pays the contract fee and initial
+// revenue to the host. The host's net funds must be less than the host valid
+// payout since the renter includes the contract fee.
+func validHostFunds(renterInput, renterOutput, hostInput, hostOutput, renterTarget, hostTarget types.Currency) bool {
+	if renterInput.Cmp(renterOutput) < 0 || hostInput.Cmp(hostOutput) < 0 {
+		return false
+	}
+	return renterInput.Sub(renterOutput).Cmp(renterTarget) > 0 && hostInput.Sub(hostOutput).Cmp(hostTarget) < 0
+}
+
+// estimateHostFundsByAddress attributes the inputs and outputs to the host by
+// its payout address. Inputs spent from the payout address less the change
+// returned to it are the host's funds. Everything else, including the renter's
+// change to a new address, belongs to the renter. The split is only trusted if
+// the host's payout address funds the contract, otherwise the host's inputs
+// can't be told apart from the renter's.
+func estimateHostFundsByAddress(inputs, outputs []siacoinElement, hostAddr, renterAddr types.Address, renterTarget, hostTarget types.Currency) (types.Currency, bool) {
+	if hostAddr == renterAddr {
+		return types.ZeroCurrency, false
+	}
+
+	var renterInput, renterOutput, hostInput, hostOutput types.Currency
+	var hostFunded bool
+	for _, sce := range inputs {
+		if sce.Address == hostAddr {
+			hostInput = hostInput.Add(sce.Value)
+			hostFunded = true
+		} else {
+			renterInput = renterInput.Add(sce.Value)
+		}
+	}
+	if !hostFunded {
+		return types.ZeroCurrency, false
+	}
+	for _, sce := range outputs {
+		if sce.Address == hostAddr {
+			hostOutput = hostOutput.Add(sce.Value)
+		} else {
+			renterOutput = renterOutput.Add(sce.Value)
+		}
+	}
+
+	if !validHostFunds(renterInput, renterOutput, hostInput, hostOutput, renterTarget, hostTarget) {
+		return types.ZeroCurrency, false
+	}
+	return hostInput.Sub(hostOutput), true
+}
+
+// estimateHostFundsByPosition attempts to separate the renter and host inputs
+// and outputs by assuming the renter's come first. Every split is tried, using
+// the estimated funding amounts for each party as a guide.
+func estimateHostFundsByPosition(inputs, outputs []siacoinElement, renterTarget, hostTarget types.Currency) (types.Currency, bool) {
+	for i := range inputs {
+		renterInput, hostInput := sum(inputs[:i]), sum(inputs[i:])
+
+		for j := len(outputs); j >= 0; j-- {
+			renterOutput, hostOutput := sum(outputs[:j]), sum(outputs[j:])
+
+			if validHostFunds(renterInput, renterOutput, hostInput, hostOutput, renterTarget, hostTarget) {
+				return hostInput.Sub(hostOutput), true
+			}
+		}
+	}
+	return types.ZeroCurrency, false
+}
+
+// estimateHostFunds estimates the siacoins the host added to a contract from
+// the inputs and outputs of the transaction that formed it. It returns the
+// estimation method used, or false if the funds could not be estimated.
+func estimateHostFunds(fc types.FileContract, inputs, outputs []siacoinElement, fees types.Currency) (types.Currency, string, bool) {
+	if len(fc.ValidProofOutputs) < 2 || len(fc.MissedProofOutputs) < 2 {
+		return types.ZeroCurrency, "", false
+	}
+
+	// a renewal's missed payout sends the cost and collateral of the data
+	// carried over from the renewed contract to the void. The host still
+	// funds that collateral, so the host's funds are bounded by the valid
+	// payout instead.
+	renterTarget := fc.ValidRenterPayout().Add(fees)
+	hostTarget := fc.ValidHostPayout()
+	if funds, ok := estimateHostFundsByAddress(inputs, outputs, fc.ValidHostOutput().Address, fc.ValidRenterOutput().Address, renterTarget, hostTarget); ok {
+		return funds, stats.FundsEstimateAddress, true
+	} else if funds, ok := estimateHostFundsByPosition(inputs, outputs, renterTarget, hostTarget); ok {
+		return funds, stats.FundsEstimatePositional, true
+	}
+	return types.ZeroCurrency, "", false
+}
+
+// estimateContract estimates the host funds and initial revenue of a contract
+// formed by a transaction containing count contracts. The initial revenue is
+// not guaranteed to be correct, but it's better than nothing.
+func estimateContract(fc types.FileContract, inputs, outputs []siacoinElement, fees types.Currency, count int) fundsEstimate {
+	// ignore weird transactions with multiple contracts
+	if count != 1 {
+		return fundsEstimate{Status: stats.EstimateStatusSkipped}
+	}
+
+	funds, method, ok := estimateHostFunds(fc, inputs, outputs, fees)
+	if !ok {
+		return fundsEstimate{Status: stats.EstimateStatusFailed}
+	}
+
+	estimate := fundsEstimate{Status: stats.EstimateStatusEstimated, Method: method, HostFunds: funds}
+	if v, underflow := fc.ValidHostPayout().SubWithUnderflow(funds); !underflow {
+		estimate.InitialValidRevenue = v
+	}
+	if v, underflow := fc.MissedHostPayout().SubWithUnderflow(funds); !underflow {
+		estimate.InitialMissedRevenue = v
+	}
+	return estimate
+}
@@ -0,0 +1,146 @@
+package sqlite
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/host-revenue-api/stats"
+)
+
+type (
+	jsonSiacoinOutput struct {
+		UnlockHash types.Address  `json:"unlock_hash"`
+		Value      types.Currency `json:"value"`
+	}
+
+	jsonStorageContract struct {
+		ValidProofOutputs  []jsonSiacoinOutput `json:"valid_proof_outputs"`
+		MissedProofOutputs []jsonSiacoinOutput `json:"missed_proof_outputs"`
+	}
+
+	// jsonTransaction is a formation transaction in the explorer format read
+	// by cmd/test.
+	jsonTransaction struct {
+		Fees             types.Currency        `json:"fees"`
+		SiacoinInputs    []jsonSiacoinOutput   `json:"siacoin_inputs"`
+		SiacoinOutputs   []jsonSiacoinOutput   `json:"siacoin_outputs"`
+		StorageContracts []jsonStorageContract `json:"storage_contracts"`
+	}
+)
+
+// loadFormation loads a formation transaction from the testdata directory.
+func loadFormation(t *testing.T, name string) (fc types.FileContract, inputs, outputs []siacoinElement, fees types.Currency) {
+	t.Helper()
+
+	f, err := os.Open(filepath.Join("testdata", "formation-"+name+".json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var txn jsonTransaction
+	if err := json.NewDecoder(f).Decode(&txn); err != nil {
+		t.Fatal(err)
+	} else if len(txn.StorageContracts) != 1 {
+		t.Fatalf("expected 1 contract, got %d", len(txn.StorageContracts))
+	}
+
+	for _, sco := range txn.StorageContracts[0].ValidProofOutputs {
+		fc.ValidProofOutputs = append(fc.ValidProofOutputs, types.SiacoinOutput{Address: sco.UnlockHash, Value: sco.Value})
+	}
+	for _, sco := range txn.StorageContracts[0].MissedProofOutputs {
+		fc.MissedProofOutputs = append(fc.MissedProofOutputs, types.SiacoinOutput{Address: sco.UnlockHash, Value: sco.Value})
+	}
+	for _, sci := range txn.SiacoinInputs {
+		inputs = append(inputs, siacoinElement{Address: sci.UnlockHash, Value: sci.Value})
+	}
+	for _, sco := range txn.SiacoinOutputs {
+		outputs = append(outputs, siacoinElement{Address: sco.UnlockHash, Value: sco.Value})
+	}
+	return fc, inputs, outputs, txn.Fees
+}
+
+func TestEstimateHostFunds(t *testing.T) {
+	// each formation pays 500 SC to the renter's refund address and a 0.2 SC
+	// contract fee to the host. The renter sends its change to a new address.
+	tests := []struct {
+		name   string
+		funds  types.Currency
+		method string
+		ok     bool
+	}{
+		{
+			// the host spends from and returns change to its payout address
+			name:   "renter-change",
+			funds:  types.Siacoins(1000),
+			method: stats.FundsEstimateAddress,
+			ok:     true,
+		},
+		{
+			name:   "host-inputs-first",
+			funds:  types.Siacoins(1000),
+			method: stats.FundsEstimateAddress,
+			ok:     true,
+		},
+		{
+			// the host's change can't be told apart from the renter's
+			name:   "host-change-fresh-address",
+			funds:  types.Siacoins(1000),
+			method: stats.FundsEstimatePositional,
+			ok:     true,
+		},
+		{
+			// the host funds the contract from another wallet address
+			name:   "host-wallet-address",
+			funds:  types.Siacoins(1000),
+			method: stats.FundsEstimatePositional,
+			ok:     true,
+		},
+		{
+			// the renter spends from its refund address and the host from
+			// another wallet address
+			name:   "host-wallet-renter-refund",
+			funds:  types.Siacoins(1000),
+			method: stats.FundsEstimatePositional,
+			ok:     true,
+		},
+		{
+			// without inputs from the host's payout address the host may
+			// have funded the contract from any of them
+			name: "no-collateral",
+			ok:   false,
+		},
+		{
+			name: "insufficient-renter-funds",
+			ok:   false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fc, inputs, outputs, fees := loadFormation(t, test.name)
+			funds, method, ok := estimateHostFunds(fc, inputs, outputs, fees)
+			if ok != test.ok {
+				t.Fatalf("expected ok %v, got %v", test.ok, ok)
+			} else if !ok {
+				return
+			} else if method != test.method {
+				t.Fatalf("expected method %q, got %q", test.method, method)
+			} else if !funds.Equals(test.funds) {
+				t.Fatalf("expected funds %d, got %d", test.funds, funds)
+			}
+		})
+	}
+
+	t.Run("missing host output", func(t *testing.T) {
+		fc, inputs, outputs, fees := loadFormation(t, "renter-change")
+		fc.ValidProofOutputs = fc.ValidProofOutputs[:1]
+		fc.MissedProofOutputs = fc.MissedProofOutputs[:1]
+		if _, _, ok := estimateHostFunds(fc, inputs, outputs, fees); ok {
+			t.Fatal("expected estimate to fail")
+		}
+	})
+}
@@ -0,0 +1,234 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/host-revenue-api/stats"
+)
+
+func addBlockHostStats(tx txn, blockID int64, addr types.Address, delta statDelta) error {
+	if delta.IsZero() {
+		return nil
+	}
+
+	query := `INSERT INTO block_host_stats (block_id, host_address, ` + statColumns + `) VALUES ($1, $2, ` + statPlaceholders(3) + `)`
+	_, err := tx.Exec(query, append([]any{blockID, sqlHash256(addr)}, delta.args()...)...)
+	return err
+}
+
+// blockHostStats returns the stat deltas added by a block keyed by host
+// address.
+func blockHostStats(tx txn, blockID int64) (map[types.Address]statDelta, error) {
+	const query = `SELECT host_address, ` + statColumns + ` FROM block_host_stats WHERE block_id=$1`
+	rows, err := tx.Query(query, blockID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deltas := make(map[types.Address]statDelta)
+	for rows.Next() {
+		var addr types.Address
+		var delta statDelta
+		if err := rows.Scan(append([]any{(*sqlHash256)(&addr)}, delta.dest()...)...); err != nil {
+			return nil, fmt.Errorf("failed to scan host stats: %w", err)
+		}
+		deltas[addr] = delta
+	}
+	return deltas, rows.Err()
+}
+
+// setHostState inserts or replaces the host's contract stats at the state's
+// timestamp.
+func setHostState(tx txn, addr types.Address, state stats.ContractState) error {
+	query := `INSERT INTO hourly_host_stats (host_address, date_created, ` + statColumns + `) VALUES ($1, $2, ` + statPlaceholders(3) + `)
+ON CONFLICT (host_address, date_created) DO UPDATE SET ` + statUpdates
+	_, err := tx.Exec(query, append([]any{sqlHash256(addr), sqlTime(state.Timestamp)}, stateArgs(state)...)...)
+	return err
+}
+
+// updateHostStats adds the delta to the host's stats at the timestamp and to
+// every later row. If revert is true, the delta is subtracted instead.
+func updateHostStats(tx txn, addr types.Address, delta statDelta, timestamp time.Time, revert bool) error {
+	if delta.IsZero() {
+		return nil
+	}
+
+	// make sure there is a row at the timestamp, carrying forward the
+	// previous state
+	state, err := getHostMetrics(tx, addr, timestamp)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("failed to get host stats: %w", err)
+	} else if state.Timestamp.Unix() != timestamp.Unix() {
+		state.Timestamp = timestamp
+		if err := setHostState(tx, addr, state); err != nil {
+			return fmt.Errorf("failed to add host stats: %w", err)
+		}
+	}
+
+	const query = `SELECT ` + statColumns + `, date_created
+FROM hourly_host_stats
+WHERE host_address=$1 AND date_created >= $2`
+	rows, err := tx.Query(query, sqlHash256(addr), sqlTime(timestamp))
+	if err != nil {
+		return fmt.Errorf("failed to query host stats: %w", err)
+	}
+	defer rows.Close()
+
+	var states []stats.ContractState
+	for rows.Next() {
+		state, err := scanContractState(rows)
+		if err != nil {
+			return fmt.Errorf("failed to scan host stats: %w", err)
+		}
+		states = append(states, state)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to query host stats: %w", err)
+	}
+	rows.Close()
+
+	for _, state := range states {
+		var updated stats.ContractState
+		if revert {
+			updated, err = delta.Revert(state)
+		} else {
+			updated, err = delta.Apply(state)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to update host stats at %v: %w", state.Timestamp, err)
+		} else if err := setHostState(tx, addr, updated); err != nil {
+			return fmt.Errorf("failed to set host stats at %v: %w", state.Timestamp, err)
+		}
+	}
+	return nil
+}
+
+func getHostMetrics(tx txn, addr types.Address, timestamp time.Time) (stats.ContractState, error) {
+	const query = `SELECT ` + statColumns + `, date_created
+FROM hourly_host_stats
+WHERE host_address=$1 AND date_created <= $2
+ORDER BY date_created DESC
+LIMIT 1`
+
+	return scanContractState(tx.QueryRow(query, sqlHash256(addr), sqlTime(timestamp)))
+}
+
+// HostMetrics returns the contract stats of the host with the payout address
+// at the timestamp.
+func (s *Store) HostMetrics(addr types.Address, timestamp time.Time) (state stats.ContractState, err error) {
+	err = s.transaction(func(tx txn) error {
+		state, err = getHostMetrics(tx, addr, timestamp)
+		if errors.Is(err, sql.ErrNoRows) {
+			return stats.ErrNotFound
+		}
+		return err
+	})
+	state.Confirmations = s.confirmations
+	return
+}
+
+// HostPeriods returns the contract stats of the host with the payout address
+// for each period between start and end.
+func (s *Store) HostPeriods(addr types.Address, start, end time.Time, period string) (state []stats.ContractState, err error) {
+	var initial stats.ContractState
+	values := make(map[int64]stats.ContractState)
+	start, end = periodRange(start, end, period)
+	err = s.transaction(func(tx txn) error {
+		// periods without stats carry forward the state before start
+		initial, err = getHostMetrics(tx, addr, start.Add(-time.Second))
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("failed to get initial state: %w", err)
+		}
+
+		const query = `SELECT ` + statColumns + `, date_created
+FROM hourly_host_stats
+WHERE host_address=$1 AND date_created BETWEEN $2 AND $3
+ORDER BY date_created ASC`
+
+		rows, err := tx.Query(query, sqlHash256(addr), sqlTime(start), sqlTime(end))
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			state, err := scanContractState(rows)
+			if err != nil {
+				return fmt.Errorf("failed to scan host stats: %w", err)
+			}
+
+			state.Timestamp = stats.NormalizePeriod(state.Timestamp.In(start.Location()), period)
+			state.Confirmations = s.confirmations
+			values[state.Timestamp.Unix()] = state
+		}
+		return nil
+	})
+	initial.Confirmations = s.confirmations
+	return fillPeriods(initial, values, start, end, period), err
+}
+
+// HostProofPeriods returns the contracts of the host with the payout address
+// that matured valid or missed in each period between start and end.
+func (s *Store) HostProofPeriods(addr types.Address, start, end time.Time, period string) ([]stats.ProofPeriod, error) {
+	states, err := s.HostPeriods(addr, prevPeriod(stats.NormalizePeriod(start, period), period), end, period)
+	if err != nil {
+		return nil, err
+	}
+	return proofPeriods(states), nil
+}
+
+// Hosts returns the hosts ranked by their earnings from the archived contracts
+// resolved between start and end.
+func (s *Store) Hosts(start, end time.Time, sortBy string, limit, offset int) (hosts []stats.HostRevenue, err error) {
+	// highest first, breaking ties by address so pages are stable
+	var order string
+	switch sortBy {
+	case stats.HostSortRevenue:
+		order = `currency_key(revenue_sc) DESC`
+	case stats.HostSortContracts:
+		order = `valid + missed DESC`
+	case stats.HostSortSuccessRatio:
+		order = `CAST(valid AS REAL) / (valid + missed) DESC, valid + missed DESC`
+	default:
+		return nil, fmt.Errorf("invalid sort %q", sortBy)
+	}
+
+	hosts = []stats.HostRevenue{}
+	err = s.transaction(func(tx txn) error {
+		query := `SELECT host_address, valid, missed, revenue_sc, revenue_usd, revenue_eur, revenue_btc FROM (
+	SELECT c.host_address, SUM(c.valid) AS valid, SUM(NOT c.valid) AS missed,
+	currency_sum(c.estimated_revenue_sc) AS revenue_sc, decimal_sum(c.estimated_revenue_usd) AS revenue_usd,
+	decimal_sum(c.estimated_revenue_eur) AS revenue_eur, decimal_sum(c.estimated_revenue_btc) AS revenue_btc
+	FROM archived_contracts c
+	INNER JOIN blocks b ON c.resolved_block_id=b.id
+	WHERE c.host_address IS NOT NULL AND b.date_created BETWEEN $1 AND $2
+	GROUP BY c.host_address
+)
+ORDER BY ` + order + `, host_address ASC
+LIMIT $3 OFFSET $4`
+		rows, err := tx.Query(query, sqlTime(start), sqlTime(end), limit, offset)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			host := stats.HostRevenue{Confirmations: s.confirmations}
+			if err := rows.Scan((*sqlHash256)(&host.Address), &host.Valid, &host.Missed, (*sqlCurrency)(&host.Revenue.SC), &host.Revenue.USD, &host.Revenue.EUR, &host.Revenue.BTC); err != nil {
+				return fmt.Errorf("failed to scan host: %w", err)
+			}
+			host.SuccessRatio = float64(host.Valid) / float64(host.Valid+host.Missed)
+			hosts = append(hosts, host)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return hosts, nil
+}
@@ -0,0 +1,112 @@
+package sqlite
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"go.sia.tech/core/types"
+	"go.sia.tech/host-revenue-api/stats"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestHosts(t *testing.T) {
+	db, err := OpenDatabase(filepath.Join(t.TempDir(), "test.db"), DefaultConfirmations, zaptest.NewLogger(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	hostA, hostB, hostC, hostD := types.Address{1}, types.Address{2}, types.Address{3}, types.Address{4}
+	contracts := []struct {
+		host    types.Address
+		valid   bool
+		revenue uint32
+	}{
+		{hostA, true, 10},
+		{hostA, true, 10},
+		{hostB, true, 30},
+		{hostB, false, 0},
+		{hostC, true, 5},
+		{hostC, true, 5},
+		{hostC, true, 5},
+		{hostD, true, 20},
+	}
+
+	usdRate, eurRate, btcRate := decimal.NewFromFloat(0.01), decimal.NewFromFloat(0.009), decimal.NewFromFloat(0.0000005)
+	resolved := time.Now().Add(-time.Hour).Truncate(time.Second)
+	err = db.transaction(func(tx txn) error {
+		formationID, err := addBlock(tx, types.BlockID{1}, 1, resolved.Add(-time.Hour))
+		if err != nil {
+			return err
+		}
+		resolutionID, err := addBlock(tx, types.BlockID{2}, 2, resolved)
+		if err != nil {
+			return err
+		}
+
+		for i, c := range contracts {
+			fc := types.FileContract{
+				ValidProofOutputs:  []types.SiacoinOutput{{}, {Address: c.host}},
+				MissedProofOutputs: []types.SiacoinOutput{{}, {Address: c.host}, {Address: types.VoidAddress}},
+			}
+			id := types.FileContractID{byte(i + 1)}
+			revenue := fiatValues(types.Siacoins(c.revenue), usdRate, eurRate, btcRate)
+			if err := addActiveContract(tx, id, fc, formationID, fundsEstimate{Status: stats.EstimateStatusSkipped}, types.ZeroCurrency); err != nil {
+				return err
+			} else if err := resolveContract(tx, id, resolutionID, c.valid, revenue, revenue, stats.Values{}, stats.Values{}, stats.Values{}, usdRate, eurRate, btcRate); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		sort          string
+		limit, offset int
+		hosts         []types.Address
+	}{
+		{stats.HostSortRevenue, 10, 0, []types.Address{hostB, hostA, hostD, hostC}},
+		{stats.HostSortContracts, 10, 0, []types.Address{hostC, hostA, hostB, hostD}},
+		{stats.HostSortSuccessRatio, 10, 0, []types.Address{hostC, hostA, hostD, hostB}},
+		{stats.HostSortRevenue, 2, 1, []types.Address{hostA, hostD}},
+		{stats.HostSortRevenue, 10, 4, []types.Address{}},
+	}
+	for _, test := range tests {
+		hosts, err := db.Hosts(resolved.Add(-time.Minute), time.Now(), test.sort, test.limit, test.offset)
+		if err != nil {
+			t.Fatal(err)
+		} else if len(hosts) != len(test.hosts) {
+			t.Fatalf("%s: expected %d hosts, got %d", test.sort, len(test.hosts), len(hosts))
+		}
+		for i, host := range hosts {
+			if host.Address != test.hosts[i] {
+				t.Fatalf("%s: expected host %d to be %v, got %v", test.sort, i, test.hosts[i], host.Address)
+			}
+		}
+	}
+
+	// the totals are exact
+	hosts, err := db.Hosts(resolved.Add(-time.Minute), time.Now(), stats.HostSortRevenue, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := fiatValues(types.Siacoins(20), usdRate, eurRate, btcRate)
+	host := hosts[0]
+	if host.Valid != 2 || host.Missed != 0 || host.SuccessRatio != 1 {
+		t.Fatalf("expected 2 valid contracts, got %d valid and %d missed", host.Valid, host.Missed)
+	} else if !host.Revenue.SC.Equals(expected.SC) || !host.Revenue.USD.Equal(expected.USD) || !host.Revenue.EUR.Equal(expected.EUR) || !host.Revenue.BTC.Equal(expected.BTC) {
+		t.Fatalf("expected revenue %+v, got %+v", expected, host.Revenue)
+	}
+
+	// contracts resolved outside the window are excluded
+	if hosts, err := db.Hosts(resolved.Add(time.Minute), time.Now(), stats.HostSortRevenue, 10, 0); err != nil {
+		t.Fatal(err)
+	} else if len(hosts) != 0 {
+		t.Fatalf("expected no hosts, got %d", len(hosts))
+	}
+}
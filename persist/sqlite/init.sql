@@ -10,7 +10,94 @@ CREATE TABLE hourly_contract_stats (
 	estimated_revenue_sc BLOB NOT NULL,
 	estimated_revenue_usd TEXT NOT NULL,
 	estimated_revenue_eur TEXT NOT NULL,
-	estimated_revenue_btc TEXT NOT NULL
+	estimated_revenue_btc TEXT NOT NULL,
+	stored_bytes INTEGER NOT NULL,
+	locked_collateral BLOB NOT NULL,
+	risked_collateral BLOB NOT NULL,
+	burned_collateral BLOB NOT NULL,
+	burned_sc BLOB NOT NULL,
+	burned_usd TEXT NOT NULL,
+	burned_eur TEXT NOT NULL,
+	burned_btc TEXT NOT NULL,
+	siafund_tax_sc BLOB NOT NULL,
+	siafund_tax_usd TEXT NOT NULL,
+	siafund_tax_eur TEXT NOT NULL,
+	siafund_tax_btc TEXT NOT NULL,
+	miner_fees_sc BLOB NOT NULL,
+	miner_fees_usd TEXT NOT NULL,
+	miner_fees_eur TEXT NOT NULL,
+	miner_fees_btc TEXT NOT NULL,
+	estimates_estimated INTEGER NOT NULL,
+	estimates_skipped INTEGER NOT NULL,
+	estimates_failed INTEGER NOT NULL,
+	accrued_revenue_sc BLOB NOT NULL,
+	accrued_revenue_usd TEXT NOT NULL,
+	accrued_revenue_eur TEXT NOT NULL,
+	accrued_revenue_btc TEXT NOT NULL,
+	reversed_revenue_sc BLOB NOT NULL,
+	reversed_revenue_usd TEXT NOT NULL,
+	reversed_revenue_eur TEXT NOT NULL,
+	reversed_revenue_btc TEXT NOT NULL,
+	fee_revenue_sc BLOB NOT NULL,
+	fee_revenue_usd TEXT NOT NULL,
+	fee_revenue_eur TEXT NOT NULL,
+	fee_revenue_btc TEXT NOT NULL,
+	revision_revenue_sc BLOB NOT NULL,
+	revision_revenue_usd TEXT NOT NULL,
+	revision_revenue_eur TEXT NOT NULL,
+	revision_revenue_btc TEXT NOT NULL
+);
+
+CREATE TABLE hourly_host_stats (
+	host_address BLOB NOT NULL,
+	date_created INTEGER NOT NULL,
+	active_contracts INTEGER NOT NULL,
+	valid_contracts INTEGER NOT NULL,
+	missed_contracts INTEGER NOT NULL,
+	total_payouts_sc BLOB NOT NULL,
+	total_payouts_usd TEXT NOT NULL,
+	total_payouts_eur TEXT NOT NULL,
+	total_payouts_btc TEXT NOT NULL,
+	estimated_revenue_sc BLOB NOT NULL,
+	estimated_revenue_usd TEXT NOT NULL,
+	estimated_revenue_eur TEXT NOT NULL,
+	estimated_revenue_btc TEXT NOT NULL,
+	stored_bytes INTEGER NOT NULL,
+	locked_collateral BLOB NOT NULL,
+	risked_collateral BLOB NOT NULL,
+	burned_collateral BLOB NOT NULL,
+	burned_sc BLOB NOT NULL,
+	burned_usd TEXT NOT NULL,
+	burned_eur TEXT NOT NULL,
+	burned_btc TEXT NOT NULL,
+	siafund_tax_sc BLOB NOT NULL,
+	siafund_tax_usd TEXT NOT NULL,
+	siafund_tax_eur TEXT NOT NULL,
+	siafund_tax_btc TEXT NOT NULL,
+	miner_fees_sc BLOB NOT NULL,
+	miner_fees_usd TEXT NOT NULL,
+	miner_fees_eur TEXT NOT NULL,
+	miner_fees_btc TEXT NOT NULL,
+	estimates_estimated INTEGER NOT NULL,
+	estimates_skipped INTEGER NOT NULL,
+	estimates_failed INTEGER NOT NULL,
+	accrued_revenue_sc BLOB NOT NULL,
+	accrued_revenue_usd TEXT NOT NULL,
+	accrued_revenue_eur TEXT NOT NULL,
+	accrued_revenue_btc TEXT NOT NULL,
+	reversed_revenue_sc BLOB NOT NULL,
+	reversed_revenue_usd TEXT NOT NULL,
+	reversed_revenue_eur TEXT NOT NULL,
+	reversed_revenue_btc TEXT NOT NULL,
+	fee_revenue_sc BLOB NOT NULL,
+	fee_revenue_usd TEXT NOT NULL,
+	fee_revenue_eur TEXT NOT NULL,
+	fee_revenue_btc TEXT NOT NULL,
+	revision_revenue_sc BLOB NOT NULL,
+	revision_revenue_usd TEXT NOT NULL,
+	revision_revenue_eur TEXT NOT NULL,
+	revision_revenue_btc TEXT NOT NULL,
+	PRIMARY KEY (host_address, date_created)
 );
 
 CREATE TABLE blocks (
@@ -19,6 +106,7 @@ CREATE TABLE blocks (
 	height INTEGER UNIQUE NOT NULL,
 	date_created DATETIME NOT NULL
 );
+CREATE INDEX blocks_date_created ON blocks (date_created);
 
 CREATE TABLE market_data (
 	date_created INTEGER PRIMARY KEY,
@@ -37,16 +125,255 @@ CREATE TABLE active_contracts (
 	initial_missed_payout_value BLOB NOT NULL,
 	valid_payout_value BLOB NOT NULL,
 	missed_payout_value BLOB NOT NULL,
+	initial_void_payout_value BLOB NOT NULL,
+	void_payout_value BLOB NOT NULL,
 	expiration_height INTEGER NOT NULL,
-	proof_block_id INTEGER REFERENCES blocks (id)
+	proof_block_id INTEGER REFERENCES blocks (id),
+	resolved_block_id INTEGER REFERENCES blocks (id),
+	host_address BLOB,
+	initial_filesize INTEGER NOT NULL,
+	filesize INTEGER NOT NULL,
+	host_funds BLOB NOT NULL,
+	host_funds_method TEXT NOT NULL,
+	estimate_status TEXT NOT NULL,
+	estimator_version INTEGER NOT NULL,
+	siafund_tax BLOB NOT NULL
 );
 CREATE INDEX active_contracts_expiration_height_proof_block_id ON active_contracts (expiration_height, proof_block_id);
+CREATE INDEX active_contracts_resolved_block_id ON active_contracts (resolved_block_id);
+
+CREATE TABLE contract_revisions (
+	id INTEGER PRIMARY KEY,
+	contract_id BLOB NOT NULL,
+	block_id INTEGER NOT NULL REFERENCES blocks (id),
+	revision_number INTEGER NOT NULL,
+	valid_payout_value BLOB NOT NULL,
+	missed_payout_value BLOB NOT NULL,
+	void_payout_value BLOB NOT NULL,
+	filesize INTEGER NOT NULL
+);
+CREATE INDEX contract_revisions_contract_id ON contract_revisions (contract_id);
+CREATE INDEX contract_revisions_block_id ON contract_revisions (block_id);
+
+CREATE TABLE archived_contracts (
+	id INTEGER PRIMARY KEY,
+	contract_id BLOB UNIQUE NOT NULL,
+	block_id INTEGER NOT NULL REFERENCES blocks (id),
+	proof_block_id INTEGER REFERENCES blocks (id),
+	resolved_block_id INTEGER NOT NULL REFERENCES blocks (id),
+	host_address BLOB,
+	valid BOOLEAN NOT NULL,
+	initial_valid_revenue BLOB NOT NULL,
+	initial_missed_revenue BLOB NOT NULL,
+	initial_valid_payout_value BLOB NOT NULL,
+	initial_missed_payout_value BLOB NOT NULL,
+	valid_payout_value BLOB NOT NULL,
+	missed_payout_value BLOB NOT NULL,
+	initial_void_payout_value BLOB NOT NULL,
+	void_payout_value BLOB NOT NULL,
+	initial_filesize INTEGER NOT NULL,
+	filesize INTEGER NOT NULL,
+	host_funds BLOB NOT NULL,
+	host_funds_method TEXT NOT NULL,
+	estimate_status TEXT NOT NULL,
+	estimator_version INTEGER NOT NULL,
+	siafund_tax BLOB NOT NULL,
+	expiration_height INTEGER NOT NULL,
+	payout_sc BLOB NOT NULL,
+	payout_usd TEXT NOT NULL,
+	payout_eur TEXT NOT NULL,
+	payout_btc TEXT NOT NULL,
+	estimated_revenue_sc BLOB NOT NULL,
+	estimated_revenue_usd TEXT NOT NULL,
+	estimated_revenue_eur TEXT NOT NULL,
+	estimated_revenue_btc TEXT NOT NULL,
+	fee_revenue_sc BLOB NOT NULL,
+	fee_revenue_usd TEXT NOT NULL,
+	fee_revenue_eur TEXT NOT NULL,
+	fee_revenue_btc TEXT NOT NULL,
+	revision_revenue_sc BLOB NOT NULL,
+	revision_revenue_usd TEXT NOT NULL,
+	revision_revenue_eur TEXT NOT NULL,
+	revision_revenue_btc TEXT NOT NULL,
+	burned_sc BLOB NOT NULL,
+	burned_usd TEXT NOT NULL,
+	burned_eur TEXT NOT NULL,
+	burned_btc TEXT NOT NULL,
+	usd_rate TEXT NOT NULL,
+	eur_rate TEXT NOT NULL,
+	btc_rate TEXT NOT NULL
+);
+CREATE INDEX archived_contracts_resolved_block_id_host_address ON archived_contracts (resolved_block_id, host_address);
+CREATE INDEX archived_contracts_host_address ON archived_contracts (host_address);
+
+CREATE TABLE contract_renewals (
+	id INTEGER PRIMARY KEY,
+	renewed_from BLOB UNIQUE NOT NULL,
+	renewed_to BLOB UNIQUE NOT NULL,
+	block_id INTEGER NOT NULL REFERENCES blocks (id)
+);
+CREATE INDEX contract_renewals_block_id ON contract_renewals (block_id);
+
+CREATE TABLE contract_formations (
+	id INTEGER PRIMARY KEY,
+	contract_id BLOB UNIQUE NOT NULL,
+	block_id INTEGER NOT NULL REFERENCES blocks (id),
+	file_contract BLOB NOT NULL,
+	miner_fees BLOB NOT NULL,
+	contract_count INTEGER NOT NULL
+);
+CREATE INDEX contract_formations_block_id ON contract_formations (block_id);
+
+CREATE TABLE contract_formation_elements (
+	id INTEGER PRIMARY KEY,
+	formation_id INTEGER NOT NULL REFERENCES contract_formations (id),
+	output BOOLEAN NOT NULL,
+	address BLOB NOT NULL,
+	value BLOB NOT NULL
+);
+CREATE INDEX contract_formation_elements_formation_id ON contract_formation_elements (formation_id);
+
+CREATE TABLE contract_accruals (
+	id INTEGER PRIMARY KEY,
+	contract_id BLOB NOT NULL,
+	block_id INTEGER NOT NULL REFERENCES blocks (id),
+	kind TEXT NOT NULL,
+	revenue_sc BLOB NOT NULL,
+	revenue_usd TEXT NOT NULL,
+	revenue_eur TEXT NOT NULL,
+	revenue_btc TEXT NOT NULL
+);
+CREATE INDEX contract_accruals_contract_id ON contract_accruals (contract_id);
+CREATE INDEX contract_accruals_block_id ON contract_accruals (block_id);
+
+CREATE TABLE contract_events (
+	id INTEGER PRIMARY KEY AUTOINCREMENT, -- the feed cursor, never reused
+	kind TEXT NOT NULL,
+	contract_id BLOB,
+	block_id BLOB NOT NULL, -- not a reference, events outlive reverted blocks
+	height INTEGER NOT NULL,
+	date_created INTEGER NOT NULL,
+	valid_payout_value BLOB NOT NULL,
+	missed_payout_value BLOB NOT NULL,
+	revenue_sc BLOB NOT NULL,
+	revenue_usd TEXT NOT NULL,
+	revenue_eur TEXT NOT NULL,
+	revenue_btc TEXT NOT NULL,
+	payout_sc BLOB NOT NULL,
+	payout_usd TEXT NOT NULL,
+	payout_eur TEXT NOT NULL,
+	payout_btc TEXT NOT NULL
+);
+CREATE INDEX contract_events_block_id ON contract_events (block_id);
+
+CREATE TABLE block_contract_stats (
+	block_id INTEGER PRIMARY KEY REFERENCES blocks (id),
+	active_contracts INTEGER NOT NULL,
+	valid_contracts INTEGER NOT NULL,
+	missed_contracts INTEGER NOT NULL,
+	total_payouts_sc BLOB NOT NULL,
+	total_payouts_usd TEXT NOT NULL,
+	total_payouts_eur TEXT NOT NULL,
+	total_payouts_btc TEXT NOT NULL,
+	estimated_revenue_sc BLOB NOT NULL,
+	estimated_revenue_usd TEXT NOT NULL,
+	estimated_revenue_eur TEXT NOT NULL,
+	estimated_revenue_btc TEXT NOT NULL,
+	stored_bytes INTEGER NOT NULL,
+	locked_collateral TEXT NOT NULL,
+	risked_collateral TEXT NOT NULL,
+	burned_collateral BLOB NOT NULL,
+	burned_sc BLOB NOT NULL,
+	burned_usd TEXT NOT NULL,
+	burned_eur TEXT NOT NULL,
+	burned_btc TEXT NOT NULL,
+	siafund_tax_sc BLOB NOT NULL,
+	siafund_tax_usd TEXT NOT NULL,
+	siafund_tax_eur TEXT NOT NULL,
+	siafund_tax_btc TEXT NOT NULL,
+	miner_fees_sc BLOB NOT NULL,
+	miner_fees_usd TEXT NOT NULL,
+	miner_fees_eur TEXT NOT NULL,
+	miner_fees_btc TEXT NOT NULL,
+	estimates_estimated INTEGER NOT NULL,
+	estimates_skipped INTEGER NOT NULL,
+	estimates_failed INTEGER NOT NULL,
+	accrued_revenue_sc BLOB NOT NULL,
+	accrued_revenue_usd TEXT NOT NULL,
+	accrued_revenue_eur TEXT NOT NULL,
+	accrued_revenue_btc TEXT NOT NULL,
+	reversed_revenue_sc BLOB NOT NULL,
+	reversed_revenue_usd TEXT NOT NULL,
+	reversed_revenue_eur TEXT NOT NULL,
+	reversed_revenue_btc TEXT NOT NULL,
+	fee_revenue_sc BLOB NOT NULL,
+	fee_revenue_usd TEXT NOT NULL,
+	fee_revenue_eur TEXT NOT NULL,
+	fee_revenue_btc TEXT NOT NULL,
+	revision_revenue_sc BLOB NOT NULL,
+	revision_revenue_usd TEXT NOT NULL,
+	revision_revenue_eur TEXT NOT NULL,
+	revision_revenue_btc TEXT NOT NULL
+);
+
+CREATE TABLE block_host_stats (
+	block_id INTEGER NOT NULL REFERENCES blocks (id),
+	host_address BLOB NOT NULL,
+	active_contracts INTEGER NOT NULL,
+	valid_contracts INTEGER NOT NULL,
+	missed_contracts INTEGER NOT NULL,
+	total_payouts_sc BLOB NOT NULL,
+	total_payouts_usd TEXT NOT NULL,
+	total_payouts_eur TEXT NOT NULL,
+	total_payouts_btc TEXT NOT NULL,
+	estimated_revenue_sc BLOB NOT NULL,
+	estimated_revenue_usd TEXT NOT NULL,
+	estimated_revenue_eur TEXT NOT NULL,
+	estimated_revenue_btc TEXT NOT NULL,
+	stored_bytes INTEGER NOT NULL,
+	locked_collateral TEXT NOT NULL,
+	risked_collateral TEXT NOT NULL,
+	burned_collateral BLOB NOT NULL,
+	burned_sc BLOB NOT NULL,
+	burned_usd TEXT NOT NULL,
+	burned_eur TEXT NOT NULL,
+	burned_btc TEXT NOT NULL,
+	siafund_tax_sc BLOB NOT NULL,
+	siafund_tax_usd TEXT NOT NULL,
+	siafund_tax_eur TEXT NOT NULL,
+	siafund_tax_btc TEXT NOT NULL,
+	miner_fees_sc BLOB NOT NULL,
+	miner_fees_usd TEXT NOT NULL,
+	miner_fees_eur TEXT NOT NULL,
+	miner_fees_btc TEXT NOT NULL,
+	estimates_estimated INTEGER NOT NULL,
+	estimates_skipped INTEGER NOT NULL,
+	estimates_failed INTEGER NOT NULL,
+	accrued_revenue_sc BLOB NOT NULL,
+	accrued_revenue_usd TEXT NOT NULL,
+	accrued_revenue_eur TEXT NOT NULL,
+	accrued_revenue_btc TEXT NOT NULL,
+	reversed_revenue_sc BLOB NOT NULL,
+	reversed_revenue_usd TEXT NOT NULL,
+	reversed_revenue_eur TEXT NOT NULL,
+	reversed_revenue_btc TEXT NOT NULL,
+	fee_revenue_sc BLOB NOT NULL,
+	fee_revenue_usd TEXT NOT NULL,
+	fee_revenue_eur TEXT NOT NULL,
+	fee_revenue_btc TEXT NOT NULL,
+	revision_revenue_sc BLOB NOT NULL,
+	revision_revenue_usd TEXT NOT NULL,
+	revision_revenue_eur TEXT NOT NULL,
+	revision_revenue_btc TEXT NOT NULL,
+	PRIMARY KEY (block_id, host_address)
+);
 
 CREATE TABLE global_settings (
 	id INTEGER PRIMARY KEY NOT NULL DEFAULT 0 CHECK (id = 0), -- enforce a single row
 	db_version INTEGER NOT NULL, -- used for migrations
 	contracts_last_processed_change BLOB, -- last processed consensus change for the contract manager
-	contracts_height INTEGER -- height of the contract manager as of the last processed change
+	contracts_height INTEGER, -- height of the contract manager as of the last processed change
+	confirmations INTEGER -- number of confirmations payouts are recognized at
 );
 
 -- initialize the global settings table
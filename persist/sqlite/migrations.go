@@ -1,3 +1,941 @@
 package sqlite
 
-var migrations = []func(txn) error{}
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"go.sia.tech/core/types"
+	"go.sia.tech/host-revenue-api/stats"
+)
+
+// migrateVersion2 adds the per-block contract stat deltas and tracks the block
+// that resolved each contract so that reorgs can be reverted.
+func migrateVersion2(tx txn) error {
+	const query = `CREATE TABLE block_contract_stats (
+	block_id INTEGER PRIMARY KEY REFERENCES blocks (id),
+	active_contracts INTEGER NOT NULL,
+	valid_contracts INTEGER NOT NULL,
+	missed_contracts INTEGER NOT NULL,
+	total_payouts_sc BLOB NOT NULL,
+	total_payouts_usd TEXT NOT NULL,
+	total_payouts_eur TEXT NOT NULL,
+	total_payouts_btc TEXT NOT NULL,
+	estimated_revenue_sc BLOB NOT NULL,
+	estimated_revenue_usd TEXT NOT NULL,
+	estimated_revenue_eur TEXT NOT NULL,
+	estimated_revenue_btc TEXT NOT NULL
+);
+ALTER TABLE active_contracts ADD COLUMN resolved_block_id INTEGER REFERENCES blocks (id);
+CREATE INDEX active_contracts_resolved_block_id ON active_contracts (resolved_block_id);`
+	_, err := tx.Exec(query)
+	return err
+}
+
+// migrateVersion3 adds the archive of resolved contracts.
+func migrateVersion3(tx txn) error {
+	const query = `CREATE TABLE archived_contracts (
+	id INTEGER PRIMARY KEY,
+	contract_id BLOB UNIQUE NOT NULL,
+	block_id INTEGER NOT NULL REFERENCES blocks (id),
+	proof_block_id INTEGER REFERENCES blocks (id),
+	resolved_block_id INTEGER NOT NULL REFERENCES blocks (id),
+	valid BOOLEAN NOT NULL,
+	initial_valid_revenue BLOB NOT NULL,
+	initial_missed_revenue BLOB NOT NULL,
+	initial_valid_payout_value BLOB NOT NULL,
+	initial_missed_payout_value BLOB NOT NULL,
+	valid_payout_value BLOB NOT NULL,
+	missed_payout_value BLOB NOT NULL,
+	expiration_height INTEGER NOT NULL,
+	payout_sc BLOB NOT NULL,
+	payout_usd TEXT NOT NULL,
+	payout_eur TEXT NOT NULL,
+	payout_btc TEXT NOT NULL,
+	estimated_revenue_sc BLOB NOT NULL,
+	estimated_revenue_usd TEXT NOT NULL,
+	estimated_revenue_eur TEXT NOT NULL,
+	estimated_revenue_btc TEXT NOT NULL,
+	usd_rate TEXT NOT NULL,
+	eur_rate TEXT NOT NULL,
+	btc_rate TEXT NOT NULL
+);
+CREATE INDEX archived_contracts_resolved_block_id ON archived_contracts (resolved_block_id);`
+	_, err := tx.Exec(query)
+	return err
+}
+
+// migrateVersion4 adds the history of confirmed contract revisions.
+func migrateVersion4(tx txn) error {
+	const query = `CREATE TABLE contract_revisions (
+	id INTEGER PRIMARY KEY,
+	contract_id BLOB NOT NULL,
+	block_id INTEGER NOT NULL REFERENCES blocks (id),
+	revision_number INTEGER NOT NULL,
+	valid_payout_value BLOB NOT NULL,
+	missed_payout_value BLOB NOT NULL
+);
+CREATE INDEX contract_revisions_contract_id ON contract_revisions (contract_id);
+CREATE INDEX contract_revisions_block_id ON contract_revisions (block_id);`
+	_, err := tx.Exec(query)
+	return err
+}
+
+// migrateVersion5 indexes the host payout address of each contract and adds
+// the per-host stats.
+func migrateVersion5(tx txn) error {
+	const query = `ALTER TABLE active_contracts ADD COLUMN host_address BLOB;
+ALTER TABLE archived_contracts ADD COLUMN host_address BLOB;
+CREATE INDEX archived_contracts_host_address ON archived_contracts (host_address);
+
+CREATE TABLE hourly_host_stats (
+	host_address BLOB NOT NULL,
+	date_created INTEGER NOT NULL,
+	active_contracts INTEGER NOT NULL,
+	valid_contracts INTEGER NOT NULL,
+	missed_contracts INTEGER NOT NULL,
+	total_payouts_sc BLOB NOT NULL,
+	total_payouts_usd TEXT NOT NULL,
+	total_payouts_eur TEXT NOT NULL,
+	total_payouts_btc TEXT NOT NULL,
+	estimated_revenue_sc BLOB NOT NULL,
+	estimated_revenue_usd TEXT NOT NULL,
+	estimated_revenue_eur TEXT NOT NULL,
+	estimated_revenue_btc TEXT NOT NULL,
+	PRIMARY KEY (host_address, date_created)
+);
+
+CREATE TABLE block_host_stats (
+	block_id INTEGER NOT NULL REFERENCES blocks (id),
+	host_address BLOB NOT NULL,
+	active_contracts INTEGER NOT NULL,
+	valid_contracts INTEGER NOT NULL,
+	missed_contracts INTEGER NOT NULL,
+	total_payouts_sc BLOB NOT NULL,
+	total_payouts_usd TEXT NOT NULL,
+	total_payouts_eur TEXT NOT NULL,
+	total_payouts_btc TEXT NOT NULL,
+	estimated_revenue_sc BLOB NOT NULL,
+	estimated_revenue_usd TEXT NOT NULL,
+	estimated_revenue_eur TEXT NOT NULL,
+	estimated_revenue_btc TEXT NOT NULL,
+	PRIMARY KEY (block_id, host_address)
+);`
+	_, err := tx.Exec(query)
+	return err
+}
+
+// migrateVersion6 indexes blocks by timestamp to find the contracts resolved
+// in a time window.
+func migrateVersion6(tx txn) error {
+	_, err := tx.Exec(`CREATE INDEX blocks_date_created ON blocks (date_created);`)
+	return err
+}
+
+// migrateVersion7 adds the contract filesize and the stored bytes stat.
+// Contracts indexed before the migration are treated as empty.
+func migrateVersion7(tx txn) error {
+	const query = `ALTER TABLE active_contracts ADD COLUMN initial_filesize INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE active_contracts ADD COLUMN filesize INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE contract_revisions ADD COLUMN filesize INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE archived_contracts ADD COLUMN initial_filesize INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE archived_contracts ADD COLUMN filesize INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE hourly_contract_stats ADD COLUMN stored_bytes INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE hourly_host_stats ADD COLUMN stored_bytes INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE block_contract_stats ADD COLUMN stored_bytes INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE block_host_stats ADD COLUMN stored_bytes INTEGER NOT NULL DEFAULT 0;`
+	_, err := tx.Exec(query)
+	return err
+}
+
+// migrateVersion8 adds the host collateral stats. Contracts indexed before the
+// migration have no known host funds, so they are not included in the locked
+// collateral. The risked collateral of unresolved contracts and the burned
+// collateral of archived contracts are backfilled.
+func migrateVersion8(tx txn) error {
+	const query = `ALTER TABLE active_contracts ADD COLUMN host_funds BLOB NOT NULL DEFAULT X'00000000000000000000000000000000';
+ALTER TABLE archived_contracts ADD COLUMN host_funds BLOB NOT NULL DEFAULT X'00000000000000000000000000000000';
+ALTER TABLE hourly_contract_stats ADD COLUMN locked_collateral BLOB NOT NULL DEFAULT X'00000000000000000000000000000000';
+ALTER TABLE hourly_contract_stats ADD COLUMN risked_collateral BLOB NOT NULL DEFAULT X'00000000000000000000000000000000';
+ALTER TABLE hourly_contract_stats ADD COLUMN burned_collateral BLOB NOT NULL DEFAULT X'00000000000000000000000000000000';
+ALTER TABLE hourly_host_stats ADD COLUMN locked_collateral BLOB NOT NULL DEFAULT X'00000000000000000000000000000000';
+ALTER TABLE hourly_host_stats ADD COLUMN risked_collateral BLOB NOT NULL DEFAULT X'00000000000000000000000000000000';
+ALTER TABLE hourly_host_stats ADD COLUMN burned_collateral BLOB NOT NULL DEFAULT X'00000000000000000000000000000000';
+ALTER TABLE block_contract_stats ADD COLUMN locked_collateral TEXT NOT NULL DEFAULT '0';
+ALTER TABLE block_contract_stats ADD COLUMN risked_collateral TEXT NOT NULL DEFAULT '0';
+ALTER TABLE block_contract_stats ADD COLUMN burned_collateral BLOB NOT NULL DEFAULT X'00000000000000000000000000000000';
+ALTER TABLE block_host_stats ADD COLUMN locked_collateral TEXT NOT NULL DEFAULT '0';
+ALTER TABLE block_host_stats ADD COLUMN risked_collateral TEXT NOT NULL DEFAULT '0';
+ALTER TABLE block_host_stats ADD COLUMN burned_collateral BLOB NOT NULL DEFAULT X'00000000000000000000000000000000';`
+	if _, err := tx.Exec(query); err != nil {
+		return err
+	}
+
+	type backfill struct {
+		blockID   int64
+		timestamp time.Time
+		host      *sqlNullable[*sqlHash256]
+		addr      types.Address
+		value     types.Currency
+	}
+
+	collect := func(query string, value func(a, b types.Currency) types.Currency) ([]backfill, error) {
+		rows, err := tx.Query(query)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		var backfills []backfill
+		for rows.Next() {
+			var b backfill
+			var v1, v2 types.Currency
+			b.host = nullable((*sqlHash256)(&b.addr))
+			if err := rows.Scan(&b.blockID, (*sqlTime)(&b.timestamp), b.host, (*sqlCurrency)(&v1), (*sqlCurrency)(&v2)); err != nil {
+				return nil, err
+			}
+			if b.value = value(v1, v2); !b.value.IsZero() {
+				backfills = append(backfills, b)
+			}
+		}
+		return backfills, rows.Err()
+	}
+
+	apply := func(column string, backfills []backfill) error {
+		for _, b := range backfills {
+			// every block that formed or resolved a contract has a delta row
+			if err := migrateAddCurrency(tx, "block_contract_stats", column, "block_id=$1", b.value, b.blockID); err != nil {
+				return fmt.Errorf("failed to update block stats: %w", err)
+			} else if err := migrateAddCurrency(tx, "hourly_contract_stats", column, "date_created >= $1", b.value, sqlTime(b.timestamp)); err != nil {
+				return fmt.Errorf("failed to update contract stats: %w", err)
+			} else if !b.host.Valid {
+				continue
+			} else if err := migrateAddCurrency(tx, "block_host_stats", column, "block_id=$1 AND host_address=$2", b.value, b.blockID, sqlHash256(b.addr)); err != nil {
+				return fmt.Errorf("failed to update block host stats: %w", err)
+			} else if err := migrateAddCurrency(tx, "hourly_host_stats", column, "host_address=$1 AND date_created >= $2", b.value, sqlHash256(b.addr), sqlTime(b.timestamp)); err != nil {
+				return fmt.Errorf("failed to update host stats: %w", err)
+			}
+		}
+		return nil
+	}
+
+	difference := func(a, b types.Currency) types.Currency {
+		v, underflow := a.SubWithUnderflow(b)
+		if underflow {
+			return types.ZeroCurrency
+		}
+		return v
+	}
+
+	risked, err := collect(`SELECT c.block_id, b.date_created, c.host_address, c.valid_payout_value, c.missed_payout_value
+FROM active_contracts c
+INNER JOIN blocks b ON c.block_id=b.id
+WHERE c.resolved_block_id IS NULL`, difference)
+	if err != nil {
+		return fmt.Errorf("failed to get active contracts: %w", err)
+	} else if err := apply("risked_collateral", risked); err != nil {
+		return fmt.Errorf("failed to backfill risked collateral: %w", err)
+	}
+
+	burned, err := collect(`SELECT c.resolved_block_id, b.date_created, c.host_address, c.initial_missed_payout_value, c.missed_payout_value
+FROM archived_contracts c
+INNER JOIN blocks b ON c.resolved_block_id=b.id
+WHERE NOT c.valid`, difference)
+	if err != nil {
+		return fmt.Errorf("failed to get archived contracts: %w", err)
+	} else if err := apply("burned_collateral", burned); err != nil {
+		return fmt.Errorf("failed to backfill burned collateral: %w", err)
+	}
+	return nil
+}
+
+// migrateVersion9 adds the void payout to contracts and the burned siacoins to
+// the stats. The void outputs of existing contracts were not stored, so
+// contracts indexed before this migration are treated as burning nothing.
+func migrateVersion9(tx txn) error {
+	const query = `ALTER TABLE active_contracts ADD COLUMN initial_void_payout_value BLOB NOT NULL DEFAULT X'00000000000000000000000000000000';
+ALTER TABLE active_contracts ADD COLUMN void_payout_value BLOB NOT NULL DEFAULT X'00000000000000000000000000000000';
+ALTER TABLE contract_revisions ADD COLUMN void_payout_value BLOB NOT NULL DEFAULT X'00000000000000000000000000000000';
+ALTER TABLE archived_contracts ADD COLUMN initial_void_payout_value BLOB NOT NULL DEFAULT X'00000000000000000000000000000000';
+ALTER TABLE archived_contracts ADD COLUMN void_payout_value BLOB NOT NULL DEFAULT X'00000000000000000000000000000000';
+ALTER TABLE archived_contracts ADD COLUMN burned_sc BLOB NOT NULL DEFAULT X'00000000000000000000000000000000';
+ALTER TABLE archived_contracts ADD COLUMN burned_usd TEXT NOT NULL DEFAULT '0';
+ALTER TABLE archived_contracts ADD COLUMN burned_eur TEXT NOT NULL DEFAULT '0';
+ALTER TABLE archived_contracts ADD COLUMN burned_btc TEXT NOT NULL DEFAULT '0';
+ALTER TABLE hourly_contract_stats ADD COLUMN burned_sc BLOB NOT NULL DEFAULT X'00000000000000000000000000000000';
+ALTER TABLE hourly_contract_stats ADD COLUMN burned_usd TEXT NOT NULL DEFAULT '0';
+ALTER TABLE hourly_contract_stats ADD COLUMN burned_eur TEXT NOT NULL DEFAULT '0';
+ALTER TABLE hourly_contract_stats ADD COLUMN burned_btc TEXT NOT NULL DEFAULT '0';
+ALTER TABLE hourly_host_stats ADD COLUMN burned_sc BLOB NOT NULL DEFAULT X'00000000000000000000000000000000';
+ALTER TABLE hourly_host_stats ADD COLUMN burned_usd TEXT NOT NULL DEFAULT '0';
+ALTER TABLE hourly_host_stats ADD COLUMN burned_eur TEXT NOT NULL DEFAULT '0';
+ALTER TABLE hourly_host_stats ADD COLUMN burned_btc TEXT NOT NULL DEFAULT '0';
+ALTER TABLE block_contract_stats ADD COLUMN burned_sc BLOB NOT NULL DEFAULT X'00000000000000000000000000000000';
+ALTER TABLE block_contract_stats ADD COLUMN burned_usd TEXT NOT NULL DEFAULT '0';
+ALTER TABLE block_contract_stats ADD COLUMN burned_eur TEXT NOT NULL DEFAULT '0';
+ALTER TABLE block_contract_stats ADD COLUMN burned_btc TEXT NOT NULL DEFAULT '0';
+ALTER TABLE block_host_stats ADD COLUMN burned_sc BLOB NOT NULL DEFAULT X'00000000000000000000000000000000';
+ALTER TABLE block_host_stats ADD COLUMN burned_usd TEXT NOT NULL DEFAULT '0';
+ALTER TABLE block_host_stats ADD COLUMN burned_eur TEXT NOT NULL DEFAULT '0';
+ALTER TABLE block_host_stats ADD COLUMN burned_btc TEXT NOT NULL DEFAULT '0';`
+	_, err := tx.Exec(query)
+	return err
+}
+
+// migrateVersion10 adds the siafund tax to contracts and the stats. The total
+// payout of existing contracts was not stored, so contracts indexed before
+// this migration are treated as paying no tax.
+func migrateVersion10(tx txn) error {
+	const query = `ALTER TABLE active_contracts ADD COLUMN siafund_tax BLOB NOT NULL DEFAULT X'00000000000000000000000000000000';
+ALTER TABLE archived_contracts ADD COLUMN siafund_tax BLOB NOT NULL DEFAULT X'00000000000000000000000000000000';
+ALTER TABLE hourly_contract_stats ADD COLUMN siafund_tax_sc BLOB NOT NULL DEFAULT X'00000000000000000000000000000000';
+ALTER TABLE hourly_contract_stats ADD COLUMN siafund_tax_usd TEXT NOT NULL DEFAULT '0';
+ALTER TABLE hourly_contract_stats ADD COLUMN siafund_tax_eur TEXT NOT NULL DEFAULT '0';
+ALTER TABLE hourly_contract_stats ADD COLUMN siafund_tax_btc TEXT NOT NULL DEFAULT '0';
+ALTER TABLE hourly_host_stats ADD COLUMN siafund_tax_sc BLOB NOT NULL DEFAULT X'00000000000000000000000000000000';
+ALTER TABLE hourly_host_stats ADD COLUMN siafund_tax_usd TEXT NOT NULL DEFAULT '0';
+ALTER TABLE hourly_host_stats ADD COLUMN siafund_tax_eur TEXT NOT NULL DEFAULT '0';
+ALTER TABLE hourly_host_stats ADD COLUMN siafund_tax_btc TEXT NOT NULL DEFAULT '0';
+ALTER TABLE block_contract_stats ADD COLUMN siafund_tax_sc BLOB NOT NULL DEFAULT X'00000000000000000000000000000000';
+ALTER TABLE block_contract_stats ADD COLUMN siafund_tax_usd TEXT NOT NULL DEFAULT '0';
+ALTER TABLE block_contract_stats ADD COLUMN siafund_tax_eur TEXT NOT NULL DEFAULT '0';
+ALTER TABLE block_contract_stats ADD COLUMN siafund_tax_btc TEXT NOT NULL DEFAULT '0';
+ALTER TABLE block_host_stats ADD COLUMN siafund_tax_sc BLOB NOT NULL DEFAULT X'00000000000000000000000000000000';
+ALTER TABLE block_host_stats ADD COLUMN siafund_tax_usd TEXT NOT NULL DEFAULT '0';
+ALTER TABLE block_host_stats ADD COLUMN siafund_tax_eur TEXT NOT NULL DEFAULT '0';
+ALTER TABLE block_host_stats ADD COLUMN siafund_tax_btc TEXT NOT NULL DEFAULT '0';`
+	_, err := tx.Exec(query)
+	return err
+}
+
+// migrateVersion11 adds the miner fees paid by contract transactions to the
+// stats. Transactions are not stored, so the fees of contracts indexed before
+// this migration are not included.
+func migrateVersion11(tx txn) error {
+	const query = `ALTER TABLE hourly_contract_stats ADD COLUMN miner_fees_sc BLOB NOT NULL DEFAULT X'00000000000000000000000000000000';
+ALTER TABLE hourly_contract_stats ADD COLUMN miner_fees_usd TEXT NOT NULL DEFAULT '0';
+ALTER TABLE hourly_contract_stats ADD COLUMN miner_fees_eur TEXT NOT NULL DEFAULT '0';
+ALTER TABLE hourly_contract_stats ADD COLUMN miner_fees_btc TEXT NOT NULL DEFAULT '0';
+ALTER TABLE hourly_host_stats ADD COLUMN miner_fees_sc BLOB NOT NULL DEFAULT X'00000000000000000000000000000000';
+ALTER TABLE hourly_host_stats ADD COLUMN miner_fees_usd TEXT NOT NULL DEFAULT '0';
+ALTER TABLE hourly_host_stats ADD COLUMN miner_fees_eur TEXT NOT NULL DEFAULT '0';
+ALTER TABLE hourly_host_stats ADD COLUMN miner_fees_btc TEXT NOT NULL DEFAULT '0';
+ALTER TABLE block_contract_stats ADD COLUMN miner_fees_sc BLOB NOT NULL DEFAULT X'00000000000000000000000000000000';
+ALTER TABLE block_contract_stats ADD COLUMN miner_fees_usd TEXT NOT NULL DEFAULT '0';
+ALTER TABLE block_contract_stats ADD COLUMN miner_fees_eur TEXT NOT NULL DEFAULT '0';
+ALTER TABLE block_contract_stats ADD COLUMN miner_fees_btc TEXT NOT NULL DEFAULT '0';
+ALTER TABLE block_host_stats ADD COLUMN miner_fees_sc BLOB NOT NULL DEFAULT X'00000000000000000000000000000000';
+ALTER TABLE block_host_stats ADD COLUMN miner_fees_usd TEXT NOT NULL DEFAULT '0';
+ALTER TABLE block_host_stats ADD COLUMN miner_fees_eur TEXT NOT NULL DEFAULT '0';
+ALTER TABLE block_host_stats ADD COLUMN miner_fees_btc TEXT NOT NULL DEFAULT '0';`
+	_, err := tx.Exec(query)
+	return err
+}
+
+// migrateVersion12 adds the contract_renewals table. Transactions are not
+// stored, so renewals indexed before this migration are not linked.
+func migrateVersion12(tx txn) error {
+	const query = `CREATE TABLE contract_renewals (
+	id INTEGER PRIMARY KEY,
+	renewed_from BLOB UNIQUE NOT NULL,
+	renewed_to BLOB UNIQUE NOT NULL,
+	block_id INTEGER NOT NULL REFERENCES blocks (id)
+);
+CREATE INDEX contract_renewals_block_id ON contract_renewals (block_id);`
+	_, err := tx.Exec(query)
+	return err
+}
+
+// migrateVersion13 records how the host funds of each contract were estimated.
+// Existing contracts with host funds were estimated by position.
+func migrateVersion13(tx txn) error {
+	const query = `ALTER TABLE active_contracts ADD COLUMN host_funds_method TEXT NOT NULL DEFAULT '';
+ALTER TABLE archived_contracts ADD COLUMN host_funds_method TEXT NOT NULL DEFAULT '';
+UPDATE active_contracts SET host_funds_method='positional' WHERE host_funds != X'00000000000000000000000000000000';
+UPDATE archived_contracts SET host_funds_method='positional' WHERE host_funds != X'00000000000000000000000000000000';`
+	_, err := tx.Exec(query)
+	return err
+}
+
+// migrateVersion14 records whether the initial revenue of each contract was
+// estimated and adds the estimate coverage to the stats. Existing contracts
+// with an estimation method were estimated. Whether the others were skipped or
+// failed is unknown, so contracts formed before this migration are not counted
+// in the stats.
+func migrateVersion14(tx txn) error {
+	const query = `ALTER TABLE active_contracts ADD COLUMN estimate_status TEXT NOT NULL DEFAULT '';
+ALTER TABLE archived_contracts ADD COLUMN estimate_status TEXT NOT NULL DEFAULT '';
+UPDATE active_contracts SET estimate_status='estimated' WHERE host_funds_method != '';
+UPDATE archived_contracts SET estimate_status='estimated' WHERE host_funds_method != '';
+ALTER TABLE hourly_contract_stats ADD COLUMN estimates_estimated INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE hourly_contract_stats ADD COLUMN estimates_skipped INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE hourly_contract_stats ADD COLUMN estimates_failed INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE hourly_host_stats ADD COLUMN estimates_estimated INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE hourly_host_stats ADD COLUMN estimates_skipped INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE hourly_host_stats ADD COLUMN estimates_failed INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE block_contract_stats ADD COLUMN estimates_estimated INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE block_contract_stats ADD COLUMN estimates_skipped INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE block_contract_stats ADD COLUMN estimates_failed INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE block_host_stats ADD COLUMN estimates_estimated INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE block_host_stats ADD COLUMN estimates_skipped INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE block_host_stats ADD COLUMN estimates_failed INTEGER NOT NULL DEFAULT 0;`
+	_, err := tx.Exec(query)
+	return err
+}
+
+// migrateVersion15 adds the estimator version to contracts and stores the
+// transactions that formed them. The transactions of existing contracts are
+// not available, so they cannot be re-estimated. Contracts estimated by
+// address must have used the second estimator, the rest are assumed to have
+// used the first.
+func migrateVersion15(tx txn) error {
+	const query = `ALTER TABLE active_contracts ADD COLUMN estimator_version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE archived_contracts ADD COLUMN estimator_version INTEGER NOT NULL DEFAULT 1;
+UPDATE active_contracts SET estimator_version=2 WHERE host_funds_method='address';
+UPDATE archived_contracts SET estimator_version=2 WHERE host_funds_method='address';
+
+CREATE TABLE contract_formations (
+	id INTEGER PRIMARY KEY,
+	contract_id BLOB UNIQUE NOT NULL,
+	block_id INTEGER NOT NULL REFERENCES blocks (id),
+	file_contract BLOB NOT NULL,
+	miner_fees BLOB NOT NULL,
+	contract_count INTEGER NOT NULL
+);
+CREATE INDEX contract_formations_block_id ON contract_formations (block_id);
+
+CREATE TABLE contract_formation_elements (
+	id INTEGER PRIMARY KEY,
+	formation_id INTEGER NOT NULL REFERENCES contract_formations (id),
+	output BOOLEAN NOT NULL,
+	address BLOB NOT NULL,
+	value BLOB NOT NULL
+);
+CREATE INDEX contract_formation_elements_formation_id ON contract_formation_elements (formation_id);`
+	_, err := tx.Exec(query)
+	return err
+}
+
+// migrateVersion16 adds the accrual ledger and the accrued and reversed
+// revenue stats. Revenue is only accrued for blocks indexed after the
+// migration since the exchange rates of past revisions were not recorded.
+func migrateVersion16(tx txn) error {
+	const query = `ALTER TABLE hourly_contract_stats ADD COLUMN accrued_revenue_sc BLOB NOT NULL DEFAULT X'00000000000000000000000000000000';
+ALTER TABLE hourly_contract_stats ADD COLUMN accrued_revenue_usd TEXT NOT NULL DEFAULT '0';
+ALTER TABLE hourly_contract_stats ADD COLUMN accrued_revenue_eur TEXT NOT NULL DEFAULT '0';
+ALTER TABLE hourly_contract_stats ADD COLUMN accrued_revenue_btc TEXT NOT NULL DEFAULT '0';
+ALTER TABLE hourly_contract_stats ADD COLUMN reversed_revenue_sc BLOB NOT NULL DEFAULT X'00000000000000000000000000000000';
+ALTER TABLE hourly_contract_stats ADD COLUMN reversed_revenue_usd TEXT NOT NULL DEFAULT '0';
+ALTER TABLE hourly_contract_stats ADD COLUMN reversed_revenue_eur TEXT NOT NULL DEFAULT '0';
+ALTER TABLE hourly_contract_stats ADD COLUMN reversed_revenue_btc TEXT NOT NULL DEFAULT '0';
+ALTER TABLE hourly_host_stats ADD COLUMN accrued_revenue_sc BLOB NOT NULL DEFAULT X'00000000000000000000000000000000';
+ALTER TABLE hourly_host_stats ADD COLUMN accrued_revenue_usd TEXT NOT NULL DEFAULT '0';
+ALTER TABLE hourly_host_stats ADD COLUMN accrued_revenue_eur TEXT NOT NULL DEFAULT '0';
+ALTER TABLE hourly_host_stats ADD COLUMN accrued_revenue_btc TEXT NOT NULL DEFAULT '0';
+ALTER TABLE hourly_host_stats ADD COLUMN reversed_revenue_sc BLOB NOT NULL DEFAULT X'00000000000000000000000000000000';
+ALTER TABLE hourly_host_stats ADD COLUMN reversed_revenue_usd TEXT NOT NULL DEFAULT '0';
+ALTER TABLE hourly_host_stats ADD COLUMN reversed_revenue_eur TEXT NOT NULL DEFAULT '0';
+ALTER TABLE hourly_host_stats ADD COLUMN reversed_revenue_btc TEXT NOT NULL DEFAULT '0';
+ALTER TABLE block_contract_stats ADD COLUMN accrued_revenue_sc BLOB NOT NULL DEFAULT X'00000000000000000000000000000000';
+ALTER TABLE block_contract_stats ADD COLUMN accrued_revenue_usd TEXT NOT NULL DEFAULT '0';
+ALTER TABLE block_contract_stats ADD COLUMN accrued_revenue_eur TEXT NOT NULL DEFAULT '0';
+ALTER TABLE block_contract_stats ADD COLUMN accrued_revenue_btc TEXT NOT NULL DEFAULT '0';
+ALTER TABLE block_contract_stats ADD COLUMN reversed_revenue_sc BLOB NOT NULL DEFAULT X'00000000000000000000000000000000';
+ALTER TABLE block_contract_stats ADD COLUMN reversed_revenue_usd TEXT NOT NULL DEFAULT '0';
+ALTER TABLE block_contract_stats ADD COLUMN reversed_revenue_eur TEXT NOT NULL DEFAULT '0';
+ALTER TABLE block_contract_stats ADD COLUMN reversed_revenue_btc TEXT NOT NULL DEFAULT '0';
+ALTER TABLE block_host_stats ADD COLUMN accrued_revenue_sc BLOB NOT NULL DEFAULT X'00000000000000000000000000000000';
+ALTER TABLE block_host_stats ADD COLUMN accrued_revenue_usd TEXT NOT NULL DEFAULT '0';
+ALTER TABLE block_host_stats ADD COLUMN accrued_revenue_eur TEXT NOT NULL DEFAULT '0';
+ALTER TABLE block_host_stats ADD COLUMN accrued_revenue_btc TEXT NOT NULL DEFAULT '0';
+ALTER TABLE block_host_stats ADD COLUMN reversed_revenue_sc BLOB NOT NULL DEFAULT X'00000000000000000000000000000000';
+ALTER TABLE block_host_stats ADD COLUMN reversed_revenue_usd TEXT NOT NULL DEFAULT '0';
+ALTER TABLE block_host_stats ADD COLUMN reversed_revenue_eur TEXT NOT NULL DEFAULT '0';
+ALTER TABLE block_host_stats ADD COLUMN reversed_revenue_btc TEXT NOT NULL DEFAULT '0';
+
+CREATE TABLE contract_accruals (
+	id INTEGER PRIMARY KEY,
+	contract_id BLOB NOT NULL,
+	block_id INTEGER NOT NULL REFERENCES blocks (id),
+	kind TEXT NOT NULL,
+	revenue_sc BLOB NOT NULL,
+	revenue_usd TEXT NOT NULL,
+	revenue_eur TEXT NOT NULL,
+	revenue_btc TEXT NOT NULL
+);
+CREATE INDEX contract_accruals_contract_id ON contract_accruals (contract_id);
+CREATE INDEX contract_accruals_block_id ON contract_accruals (block_id);`
+	_, err := tx.Exec(query)
+	return err
+}
+
+// migrateVersion17 splits revenue into contract fee and revision revenue. The
+// split of archived contracts is backfilled at the exchange rates of their
+// resolution. The stats of contracts resolved before the migration are not
+// split.
+func migrateVersion17(tx txn) error {
+	const query = `ALTER TABLE hourly_contract_stats ADD COLUMN fee_revenue_sc BLOB NOT NULL DEFAULT X'00000000000000000000000000000000';
+ALTER TABLE hourly_contract_stats ADD COLUMN fee_revenue_usd TEXT NOT NULL DEFAULT '0';
+ALTER TABLE hourly_contract_stats ADD COLUMN fee_revenue_eur TEXT NOT NULL DEFAULT '0';
+ALTER TABLE hourly_contract_stats ADD COLUMN fee_revenue_btc TEXT NOT NULL DEFAULT '0';
+ALTER TABLE hourly_contract_stats ADD COLUMN revision_revenue_sc BLOB NOT NULL DEFAULT X'00000000000000000000000000000000';
+ALTER TABLE hourly_contract_stats ADD COLUMN revision_revenue_usd TEXT NOT NULL DEFAULT '0';
+ALTER TABLE hourly_contract_stats ADD COLUMN revision_revenue_eur TEXT NOT NULL DEFAULT '0';
+ALTER TABLE hourly_contract_stats ADD COLUMN revision_revenue_btc TEXT NOT NULL DEFAULT '0';
+ALTER TABLE hourly_host_stats ADD COLUMN fee_revenue_sc BLOB NOT NULL DEFAULT X'00000000000000000000000000000000';
+ALTER TABLE hourly_host_stats ADD COLUMN fee_revenue_usd TEXT NOT NULL DEFAULT '0';
+ALTER TABLE hourly_host_stats ADD COLUMN fee_revenue_eur TEXT NOT NULL DEFAULT '0';
+ALTER TABLE hourly_host_stats ADD COLUMN fee_revenue_btc TEXT NOT NULL DEFAULT '0';
+ALTER TABLE hourly_host_stats ADD COLUMN revision_revenue_sc BLOB NOT NULL DEFAULT X'00000000000000000000000000000000';
+ALTER TABLE hourly_host_stats ADD COLUMN revision_revenue_usd TEXT NOT NULL DEFAULT '0';
+ALTER TABLE hourly_host_stats ADD COLUMN revision_revenue_eur TEXT NOT NULL DEFAULT '0';
+ALTER TABLE hourly_host_stats ADD COLUMN revision_revenue_btc TEXT NOT NULL DEFAULT '0';
+ALTER TABLE block_contract_stats ADD COLUMN fee_revenue_sc BLOB NOT NULL DEFAULT X'00000000000000000000000000000000';
+ALTER TABLE block_contract_stats ADD COLUMN fee_revenue_usd TEXT NOT NULL DEFAULT '0';
+ALTER TABLE block_contract_stats ADD COLUMN fee_revenue_eur TEXT NOT NULL DEFAULT '0';
+ALTER TABLE block_contract_stats ADD COLUMN fee_revenue_btc TEXT NOT NULL DEFAULT '0';
+ALTER TABLE block_contract_stats ADD COLUMN revision_revenue_sc BLOB NOT NULL DEFAULT X'00000000000000000000000000000000';
+ALTER TABLE block_contract_stats ADD COLUMN revision_revenue_usd TEXT NOT NULL DEFAULT '0';
+ALTER TABLE block_contract_stats ADD COLUMN revision_revenue_eur TEXT NOT NULL DEFAULT '0';
+ALTER TABLE block_contract_stats ADD COLUMN revision_revenue_btc TEXT NOT NULL DEFAULT '0';
+ALTER TABLE block_host_stats ADD COLUMN fee_revenue_sc BLOB NOT NULL DEFAULT X'00000000000000000000000000000000';
+ALTER TABLE block_host_stats ADD COLUMN fee_revenue_usd TEXT NOT NULL DEFAULT '0';
+ALTER TABLE block_host_stats ADD COLUMN fee_revenue_eur TEXT NOT NULL DEFAULT '0';
+ALTER TABLE block_host_stats ADD COLUMN fee_revenue_btc TEXT NOT NULL DEFAULT '0';
+ALTER TABLE block_host_stats ADD COLUMN revision_revenue_sc BLOB NOT NULL DEFAULT X'00000000000000000000000000000000';
+ALTER TABLE block_host_stats ADD COLUMN revision_revenue_usd TEXT NOT NULL DEFAULT '0';
+ALTER TABLE block_host_stats ADD COLUMN revision_revenue_eur TEXT NOT NULL DEFAULT '0';
+ALTER TABLE block_host_stats ADD COLUMN revision_revenue_btc TEXT NOT NULL DEFAULT '0';
+ALTER TABLE archived_contracts ADD COLUMN fee_revenue_sc BLOB NOT NULL DEFAULT X'00000000000000000000000000000000';
+ALTER TABLE archived_contracts ADD COLUMN fee_revenue_usd TEXT NOT NULL DEFAULT '0';
+ALTER TABLE archived_contracts ADD COLUMN fee_revenue_eur TEXT NOT NULL DEFAULT '0';
+ALTER TABLE archived_contracts ADD COLUMN fee_revenue_btc TEXT NOT NULL DEFAULT '0';
+ALTER TABLE archived_contracts ADD COLUMN revision_revenue_sc BLOB NOT NULL DEFAULT X'00000000000000000000000000000000';
+ALTER TABLE archived_contracts ADD COLUMN revision_revenue_usd TEXT NOT NULL DEFAULT '0';
+ALTER TABLE archived_contracts ADD COLUMN revision_revenue_eur TEXT NOT NULL DEFAULT '0';
+ALTER TABLE archived_contracts ADD COLUMN revision_revenue_btc TEXT NOT NULL DEFAULT '0';`
+	if _, err := tx.Exec(query); err != nil {
+		return err
+	}
+
+	type split struct {
+		id              types.FileContractID
+		fees, revisions stats.Values
+	}
+
+	rows, err := tx.Query(`SELECT contract_id, valid, initial_valid_payout_value, initial_missed_payout_value, valid_payout_value, missed_payout_value,
+initial_valid_revenue, initial_missed_revenue, usd_rate, eur_rate, btc_rate
+FROM archived_contracts`)
+	if err != nil {
+		return fmt.Errorf("failed to get archived contracts: %w", err)
+	}
+	defer rows.Close()
+
+	var splits []split
+	for rows.Next() {
+		var s split
+		var cr contractResolution
+		var estimate fundsEstimate
+		if err := rows.Scan((*sqlHash256)(&s.id), &cr.Valid, (*sqlCurrency)(&cr.InitialValid), (*sqlCurrency)(&cr.InitialMissed), (*sqlCurrency)(&cr.FinalValid), (*sqlCurrency)(&cr.FinalMissed),
+			(*sqlCurrency)(&estimate.InitialValidRevenue), (*sqlCurrency)(&estimate.InitialMissedRevenue), &cr.USDRate, &cr.EURRate, &cr.BTCRate); err != nil {
+			return fmt.Errorf("failed to scan archived contract: %w", err)
+		}
+		if s.fees, s.revisions = cr.revenueSplit(estimate); !s.fees.IsZero() || !s.revisions.IsZero() {
+			splits = append(splits, s)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	for _, s := range splits {
+		const query = `UPDATE archived_contracts SET (fee_revenue_sc, fee_revenue_usd, fee_revenue_eur, fee_revenue_btc, revision_revenue_sc, revision_revenue_usd, revision_revenue_eur, revision_revenue_btc) = ($1, $2, $3, $4, $5, $6, $7, $8) WHERE contract_id=$9`
+		if _, err := tx.Exec(query, sqlCurrency(s.fees.SC), s.fees.USD, s.fees.EUR, s.fees.BTC, sqlCurrency(s.revisions.SC), s.revisions.USD, s.revisions.EUR, s.revisions.BTC, sqlHash256(s.id)); err != nil {
+			return fmt.Errorf("failed to update archived contract %q: %w", s.id, err)
+		}
+	}
+	return nil
+}
+
+// migrateVersion18 recomputes the fiat revenue and payouts of archived
+// contracts from their siacoin values and the exchange rates of their
+// resolution. Valid contracts were resolved without a BTC revenue. The
+// difference is added to the archive and to the stats of the resolution block
+// and every later row. Contracts resolved before the archive was added cannot
+// be recomputed.
+func migrateVersion18(tx txn) error {
+	type correction struct {
+		id        types.FileContractID
+		blockID   int64
+		timestamp time.Time
+		host      *sqlNullable[*sqlHash256]
+		addr      types.Address
+
+		revenue, payout stats.Values
+		// diffs are the changes to the fiat columns
+		diffs map[string]decimal.Decimal
+	}
+
+	rows, err := tx.Query(`SELECT c.contract_id, c.resolved_block_id, b.date_created, c.host_address,
+c.estimated_revenue_sc, c.estimated_revenue_usd, c.estimated_revenue_eur, c.estimated_revenue_btc,
+c.payout_sc, c.payout_usd, c.payout_eur, c.payout_btc,
+c.usd_rate, c.eur_rate, c.btc_rate
+FROM archived_contracts c
+INNER JOIN blocks b ON c.resolved_block_id=b.id`)
+	if err != nil {
+		return fmt.Errorf("failed to get archived contracts: %w", err)
+	}
+	defer rows.Close()
+
+	var corrections []correction
+	for rows.Next() {
+		var c correction
+		var revenue, payout stats.Values
+		var usdRate, eurRate, btcRate decimal.Decimal
+		c.host = nullable((*sqlHash256)(&c.addr))
+		if err := rows.Scan((*sqlHash256)(&c.id), &c.blockID, (*sqlTime)(&c.timestamp), c.host,
+			(*sqlCurrency)(&revenue.SC), &revenue.USD, &revenue.EUR, &revenue.BTC,
+			(*sqlCurrency)(&payout.SC), &payout.USD, &payout.EUR, &payout.BTC,
+			&usdRate, &eurRate, &btcRate); err != nil {
+			return fmt.Errorf("failed to scan archived contract: %w", err)
+		}
+
+		c.revenue = fiatValues(revenue.SC, usdRate, eurRate, btcRate)
+		c.payout = fiatValues(payout.SC, usdRate, eurRate, btcRate)
+		c.diffs = make(map[string]decimal.Decimal)
+		for column, diff := range map[string]decimal.Decimal{
+			"estimated_revenue_usd": c.revenue.USD.Sub(revenue.USD),
+			"estimated_revenue_eur": c.revenue.EUR.Sub(revenue.EUR),
+			"estimated_revenue_btc": c.revenue.BTC.Sub(revenue.BTC),
+			"payout_usd":            c.payout.USD.Sub(payout.USD),
+			"payout_eur":            c.payout.EUR.Sub(payout.EUR),
+			"payout_btc":            c.payout.BTC.Sub(payout.BTC),
+		} {
+			if !diff.IsZero() {
+				c.diffs[column] = diff
+			}
+		}
+		if len(c.diffs) > 0 {
+			corrections = append(corrections, c)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	for _, c := range corrections {
+		const query = `UPDATE archived_contracts SET (estimated_revenue_usd, estimated_revenue_eur, estimated_revenue_btc, payout_usd, payout_eur, payout_btc) = ($1, $2, $3, $4, $5, $6) WHERE contract_id=$7`
+		if _, err := tx.Exec(query, c.revenue.USD, c.revenue.EUR, c.revenue.BTC, c.payout.USD, c.payout.EUR, c.payout.BTC, sqlHash256(c.id)); err != nil {
+			return fmt.Errorf("failed to update archived contract %q: %w", c.id, err)
+		}
+
+		// the stats name the payout columns total_payouts
+		for column, diff := range c.diffs {
+			column = strings.Replace(column, "payout_", "total_payouts_", 1)
+			if err := migrateAddDecimal(tx, "block_contract_stats", column, "block_id=$1", diff, c.blockID); err != nil {
+				return fmt.Errorf("failed to update block stats: %w", err)
+			} else if err := migrateAddDecimal(tx, "hourly_contract_stats", column, "date_created >= $1", diff, sqlTime(c.timestamp)); err != nil {
+				return fmt.Errorf("failed to update contract stats: %w", err)
+			} else if !c.host.Valid {
+				continue
+			} else if err := migrateAddDecimal(tx, "block_host_stats", column, "block_id=$1 AND host_address=$2", diff, c.blockID, sqlHash256(c.addr)); err != nil {
+				return fmt.Errorf("failed to update block host stats: %w", err)
+			} else if err := migrateAddDecimal(tx, "hourly_host_stats", column, "host_address=$1 AND date_created >= $2", diff, sqlHash256(c.addr), sqlTime(c.timestamp)); err != nil {
+				return fmt.Errorf("failed to update host stats: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// migrateVersion19 adds the contract event feed. Events are only recorded for
+// blocks indexed after the migration.
+func migrateVersion19(tx txn) error {
+	const query = `CREATE TABLE contract_events (
+	id INTEGER PRIMARY KEY AUTOINCREMENT, -- the feed cursor, never reused
+	kind TEXT NOT NULL,
+	contract_id BLOB,
+	block_id BLOB NOT NULL, -- not a reference, events outlive reverted blocks
+	height INTEGER NOT NULL,
+	date_created INTEGER NOT NULL,
+	valid_payout_value BLOB NOT NULL,
+	missed_payout_value BLOB NOT NULL,
+	revenue_sc BLOB NOT NULL,
+	revenue_usd TEXT NOT NULL,
+	revenue_eur TEXT NOT NULL,
+	revenue_btc TEXT NOT NULL,
+	payout_sc BLOB NOT NULL,
+	payout_usd TEXT NOT NULL,
+	payout_eur TEXT NOT NULL,
+	payout_btc TEXT NOT NULL
+);
+CREATE INDEX contract_events_block_id ON contract_events (block_id);`
+	_, err := tx.Exec(query)
+	return err
+}
+
+// migrateVersion20 records the number of confirmations payouts were
+// recognized at. Databases indexed before it was configurable used the
+// maturity delay.
+func migrateVersion20(tx txn) error {
+	if _, err := tx.Exec(`ALTER TABLE global_settings ADD COLUMN confirmations INTEGER`); err != nil {
+		return err
+	}
+	_, err := tx.Exec(`UPDATE global_settings SET confirmations=$1 WHERE contracts_last_processed_change IS NOT NULL`, DefaultConfirmations)
+	return err
+}
+
+// migrateVersion21 backfills the BTC revenue of the blocks that resolved valid
+// contracts. Valid contracts were resolved without a BTC revenue and most were
+// resolved before the contract archive existed, so migrateVersion18 could not
+// correct them. The revenue of each block is revalued at the block's exchange
+// rate and the difference is added to the block's stats and every later
+// hourly row. Blocks without market data are skipped.
+func migrateVersion21(tx txn) error {
+	type blockRevenue struct {
+		blockID   int64
+		timestamp time.Time
+		host      *sqlNullable[*sqlHash256]
+		addr      types.Address
+		sc        types.Currency
+		btc       decimal.Decimal
+	}
+
+	const query = `SELECT s.block_id, b.date_created, NULL, s.estimated_revenue_sc, s.estimated_revenue_btc
+FROM block_contract_stats s
+INNER JOIN blocks b ON s.block_id=b.id
+WHERE s.valid_contracts > 0
+UNION ALL
+SELECT s.block_id, b.date_created, s.host_address, s.estimated_revenue_sc, s.estimated_revenue_btc
+FROM block_host_stats s
+INNER JOIN blocks b ON s.block_id=b.id
+WHERE s.valid_contracts > 0`
+	rows, err := tx.Query(query)
+	if err != nil {
+		return fmt.Errorf("failed to get block stats: %w", err)
+	}
+	defer rows.Close()
+
+	var blocks []blockRevenue
+	for rows.Next() {
+		var br blockRevenue
+		br.host = nullable((*sqlHash256)(&br.addr))
+		if err := rows.Scan(&br.blockID, (*sqlTime)(&br.timestamp), br.host, (*sqlCurrency)(&br.sc), &br.btc); err != nil {
+			return fmt.Errorf("failed to scan block stats: %w", err)
+		}
+		blocks = append(blocks, br)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	for _, br := range blocks {
+		_, _, btcRate, err := getExchangeRate(tx, br.timestamp)
+		if errors.Is(err, errNoExchangeRate) {
+			continue
+		} else if err != nil {
+			return fmt.Errorf("failed to get exchange rate: %w", err)
+		}
+
+		diff := fiatValues(br.sc, decimal.Zero, decimal.Zero, btcRate).BTC.Sub(br.btc)
+		if diff.IsZero() {
+			continue
+		} else if !br.host.Valid {
+			if err := migrateAddDecimal(tx, "block_contract_stats", "estimated_revenue_btc", "block_id=$1", diff, br.blockID); err != nil {
+				return fmt.Errorf("failed to update block stats: %w", err)
+			} else if err := migrateAddDecimal(tx, "hourly_contract_stats", "estimated_revenue_btc", "date_created >= $1", diff, sqlTime(br.timestamp)); err != nil {
+				return fmt.Errorf("failed to update contract stats: %w", err)
+			}
+		} else if err := migrateAddDecimal(tx, "block_host_stats", "estimated_revenue_btc", "block_id=$1 AND host_address=$2", diff, br.blockID, sqlHash256(br.addr)); err != nil {
+			return fmt.Errorf("failed to update block host stats: %w", err)
+		} else if err := migrateAddDecimal(tx, "hourly_host_stats", "estimated_revenue_btc", "host_address=$1 AND date_created >= $2", diff, sqlHash256(br.addr), sqlTime(br.timestamp)); err != nil {
+			return fmt.Errorf("failed to update host stats: %w", err)
+		}
+	}
+	return nil
+}
+
+// migrateVersion22 replaces the archived contracts' resolution index with one
+// that also covers the host address for the host leaderboard.
+func migrateVersion22(tx txn) error {
+	_, err := tx.Exec(`DROP INDEX archived_contracts_resolved_block_id;
+CREATE INDEX archived_contracts_resolved_block_id_host_address ON archived_contracts (resolved_block_id, host_address);`)
+	return err
+}
+
+// migrateVersion23 revalues the BTC revenue of the hourly stats. Databases
+// indexed before the block stats existed only have the cumulative hourly rows,
+// so migrateVersion21 could not correct them. Every row that resolved valid
+// contracts has its revenue increment revalued at the row's exchange rate and
+// the difference is carried forward to the later rows. Rows without market
+// data are skipped.
+func migrateVersion23(tx txn) error {
+	type hourlyRevenue struct {
+		id        int64
+		timestamp time.Time
+		host      *sqlNullable[*sqlHash256]
+		addr      types.Address
+		valid     int64
+		sc        types.Currency
+		btc       decimal.Decimal
+	}
+
+	revalue := func(table, query string) error {
+		rows, err := tx.Query(query)
+		if err != nil {
+			return fmt.Errorf("failed to get %s: %w", table, err)
+		}
+		defer rows.Close()
+
+		var hourly []hourlyRevenue
+		for rows.Next() {
+			var hr hourlyRevenue
+			hr.host = nullable((*sqlHash256)(&hr.addr))
+			if err := rows.Scan(&hr.id, (*sqlTime)(&hr.timestamp), hr.host, &hr.valid, (*sqlCurrency)(&hr.sc), &hr.btc); err != nil {
+				return fmt.Errorf("failed to scan %s: %w", table, err)
+			}
+			hourly = append(hourly, hr)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		rows.Close()
+
+		var prev hourlyRevenue
+		var diff decimal.Decimal
+		for i, hr := range hourly {
+			// the rows are cumulative per host
+			if i == 0 || hr.addr != prev.addr {
+				prev, diff = hourlyRevenue{}, decimal.Zero
+			}
+
+			increment, underflow := hr.sc.SubWithUnderflow(prev.sc)
+			if hr.valid > prev.valid && !underflow {
+				_, _, btcRate, err := getExchangeRate(tx, hr.timestamp)
+				if err != nil && !errors.Is(err, errNoExchangeRate) {
+					return fmt.Errorf("failed to get exchange rate: %w", err)
+				} else if err == nil {
+					expected := fiatValues(increment, decimal.Zero, decimal.Zero, btcRate).BTC
+					diff = diff.Add(expected.Sub(hr.btc.Sub(prev.btc)))
+				}
+			}
+			if !diff.IsZero() {
+				if _, err := tx.Exec(`UPDATE `+table+` SET estimated_revenue_btc=$1 WHERE rowid=$2`, hr.btc.Add(diff), hr.id); err != nil {
+					return fmt.Errorf("failed to update %s: %w", table, err)
+				}
+			}
+			prev = hr
+		}
+		return nil
+	}
+
+	if err := revalue("hourly_contract_stats", `SELECT rowid, date_created, NULL, valid_contracts, estimated_revenue_sc, estimated_revenue_btc
+FROM hourly_contract_stats ORDER BY date_created ASC`); err != nil {
+		return err
+	}
+	return revalue("hourly_host_stats", `SELECT rowid, date_created, host_address, valid_contracts, estimated_revenue_sc, estimated_revenue_btc
+FROM hourly_host_stats ORDER BY host_address ASC, date_created ASC`)
+}
+
+// migrateAddCurrency adds v to a currency column of every row matching the
+// where clause. The locked and risked collateral columns of the per-block stat
+// tables are signed deltas.
+func migrateAddCurrency(tx txn, table, column, where string, v types.Currency, args ...any) error {
+	signed := strings.HasPrefix(table, "block_") && (column == "locked_collateral" || column == "risked_collateral")
+
+	rows, err := tx.Query(`SELECT rowid, `+column+` FROM `+table+` WHERE `+where, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	updated := make(map[int64]any)
+	for rows.Next() {
+		var id int64
+		if signed {
+			var cd currencyDelta
+			if err := rows.Scan(&id, (*sqlCurrencyDelta)(&cd)); err != nil {
+				return err
+			}
+			updated[id] = sqlCurrencyDelta(cd.Add(v))
+		} else {
+			var c types.Currency
+			if err := rows.Scan(&id, (*sqlCurrency)(&c)); err != nil {
+				return err
+			}
+			updated[id] = sqlCurrency(c.Add(v))
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	for id, value := range updated {
+		if _, err := tx.Exec(`UPDATE `+table+` SET `+column+`=$1 WHERE rowid=$2`, value, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateAddDecimal adds v to a decimal column of every row matching the where
+// clause.
+func migrateAddDecimal(tx txn, table, column, where string, v decimal.Decimal, args ...any) error {
+	rows, err := tx.Query(`SELECT rowid, `+column+` FROM `+table+` WHERE `+where, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	updated := make(map[int64]decimal.Decimal)
+	for rows.Next() {
+		var id int64
+		var d decimal.Decimal
+		if err := rows.Scan(&id, &d); err != nil {
+			return err
+		}
+		updated[id] = d.Add(v)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	for id, value := range updated {
+		if _, err := tx.Exec(`UPDATE `+table+` SET `+column+`=$1 WHERE rowid=$2`, value, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var migrations = []func(txn) error{
+	migrateVersion2,
+	migrateVersion3,
+	migrateVersion4,
+	migrateVersion5,
+	migrateVersion6,
+	migrateVersion7,
+	migrateVersion8,
+	migrateVersion9,
+	migrateVersion10,
+	migrateVersion11,
+	migrateVersion12,
+	migrateVersion13,
+	migrateVersion14,
+	migrateVersion15,
+	migrateVersion16,
+	migrateVersion17,
+	migrateVersion18,
+	migrateVersion19,
+	migrateVersion20,
+	migrateVersion21,
+	migrateVersion22,
+	migrateVersion23,
+}
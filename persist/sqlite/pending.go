@@ -0,0 +1,169 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"go.sia.tech/core/consensus"
+	"go.sia.tech/core/types"
+	"go.sia.tech/host-revenue-api/stats"
+)
+
+// A pendingContract is an unresolved contract and the revenue it is expected
+// to realize.
+type pendingContract struct {
+	FormationHeight  uint64
+	ExpirationHeight uint64
+	Filesize         uint64
+	// Payout is the host payout the contract is expected to resolve with.
+	Payout  types.Currency
+	Revenue types.Currency
+}
+
+// chainTip returns the height and timestamp of the latest indexed block.
+func chainTip(tx txn) (height uint64, timestamp time.Time, err error) {
+	err = tx.QueryRow(`SELECT height, date_created FROM blocks ORDER BY height DESC LIMIT 1`).Scan(&height, (*sqlTime)(&timestamp))
+	return
+}
+
+// pendingContracts returns the expected revenue of every unresolved contract.
+// Revenue is calculated the same way as when the contract is resolved. Contracts
+// that expired at or before the height without a proof or renewal will miss
+// their proof, the rest are expected to be valid.
+func pendingContracts(tx txn, height uint64) (contracts []pendingContract, err error) {
+	const query = `SELECT b.height, c.expiration_height, c.filesize, c.proof_block_id IS NULL AND c.expiration_height <= $1 AND r.id IS NULL,
+c.initial_valid_payout_value, c.valid_payout_value, c.initial_valid_revenue,
+c.initial_missed_payout_value, c.missed_payout_value, c.initial_missed_revenue
+FROM active_contracts c
+INNER JOIN blocks b ON c.block_id=b.id
+LEFT JOIN contract_renewals r ON c.contract_id=r.renewed_from
+WHERE c.resolved_block_id IS NULL`
+
+	rows, err := tx.Query(query, height)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var pc pendingContract
+		var missed bool
+		var initialValid, finalValid, initialValidRevenue, initialMissed, finalMissed, initialMissedRevenue types.Currency
+		err := rows.Scan(&pc.FormationHeight, &pc.ExpirationHeight, &pc.Filesize, &missed,
+			(*sqlCurrency)(&initialValid), (*sqlCurrency)(&finalValid), (*sqlCurrency)(&initialValidRevenue),
+			(*sqlCurrency)(&initialMissed), (*sqlCurrency)(&finalMissed), (*sqlCurrency)(&initialMissedRevenue))
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan contract: %w", err)
+		}
+
+		initial, final, initialRevenue := initialValid, finalValid, initialValidRevenue
+		if missed {
+			initial, final, initialRevenue = initialMissed, finalMissed, initialMissedRevenue
+		}
+		pc.Payout = final
+		if v, underflow := final.SubWithUnderflow(initial); !underflow {
+			pc.Revenue = v.Add(initialRevenue)
+		}
+		contracts = append(contracts, pc)
+	}
+	return contracts, rows.Err()
+}
+
+// PendingRevenue returns the revenue of the active contracts that has not been
+// realized yet, valued at the current exchange rate. The fiat values are zero
+// if there is no market data.
+func (s *Store) PendingRevenue() (pending stats.PendingRevenue, err error) {
+	pending.Confirmations = s.confirmations
+	pending.Timestamp = time.Now()
+	err = s.transaction(func(tx txn) error {
+		height, _, err := chainTip(tx)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("failed to get chain tip: %w", err)
+		}
+
+		contracts, err := pendingContracts(tx, height)
+		if err != nil {
+			return fmt.Errorf("failed to get pending contracts: %w", err)
+		}
+
+		usdRate, eurRate, btcRate, err := getExchangeRate(tx, pending.Timestamp)
+		if err != nil && !errors.Is(err, errNoExchangeRate) {
+			return fmt.Errorf("failed to get exchange rate: %w", err)
+		}
+
+		var revenue types.Currency
+		for _, c := range contracts {
+			revenue = revenue.Add(c.Revenue)
+		}
+		pending.Active = len(contracts)
+		pending.Revenue = fiatValues(revenue, usdRate, eurRate, btcRate)
+		return nil
+	})
+	return
+}
+
+// RevenueForecast returns the revenue expected from the active contracts
+// expiring on each of the next days, valued at the current exchange rate.
+// Expiration dates are estimated from the block interval. Contracts that have
+// already expired are included in the first day. The fiat values are zero if
+// there is no market data.
+func (s *Store) RevenueForecast(days int) (forecast []stats.RevenueForecast, err error) {
+	now := time.Now().UTC()
+	start := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	forecast = make([]stats.RevenueForecast, days)
+	for i := range forecast {
+		forecast[i].Confirmations = s.confirmations
+		forecast[i].Timestamp = start.AddDate(0, 0, i)
+	}
+
+	err = s.transaction(func(tx txn) error {
+		height, timestamp, err := chainTip(tx)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("failed to get chain tip: %w", err)
+		}
+
+		contracts, err := pendingContracts(tx, height)
+		if err != nil {
+			return fmt.Errorf("failed to get pending contracts: %w", err)
+		}
+
+		usdRate, eurRate, btcRate, err := getExchangeRate(tx, now)
+		if err != nil && !errors.Is(err, errNoExchangeRate) {
+			return fmt.Errorf("failed to get exchange rate: %w", err)
+		}
+
+		interval := consensus.State{Network: s.network}.BlockInterval()
+		revenue := make([]types.Currency, days)
+		for _, c := range contracts {
+			blocks := int64(c.ExpirationHeight) - int64(height)
+			if blocks > math.MaxInt64/int64(interval) {
+				continue
+			}
+			expiration := timestamp.Add(time.Duration(blocks) * interval)
+
+			var day int
+			if expiration.After(start) {
+				day = int(expiration.Sub(start) / (24 * time.Hour))
+			}
+			if day >= days {
+				continue
+			}
+			forecast[day].Contracts++
+			revenue[day] = revenue[day].Add(c.Revenue)
+		}
+
+		for i := range forecast {
+			forecast[i].Revenue = fiatValues(revenue[i], usdRate, eurRate, btcRate)
+		}
+		return nil
+	})
+	return
+}
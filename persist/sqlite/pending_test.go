@@ -0,0 +1,87 @@
+package sqlite
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/host-revenue-api/stats"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestPendingRevenueNoMarketData(t *testing.T) {
+	db, err := OpenDatabase(filepath.Join(t.TempDir(), "test.db"), DefaultConfirmations, zaptest.NewLogger(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	renterAddr, hostAddr := types.Address{1}, types.Address{2}
+	fc := types.FileContract{
+		Payout:      types.Siacoins(322),
+		WindowStart: 10,
+		WindowEnd:   20,
+		ValidProofOutputs: []types.SiacoinOutput{
+			{Address: renterAddr, Value: types.Siacoins(100)},
+			{Address: hostAddr, Value: types.Siacoins(210)},
+		},
+		MissedProofOutputs: []types.SiacoinOutput{
+			{Address: renterAddr, Value: types.Siacoins(100)},
+			{Address: hostAddr, Value: types.Siacoins(210)},
+			{Address: types.VoidAddress, Value: types.ZeroCurrency},
+		},
+	}
+	estimate := fundsEstimate{
+		Status:               stats.EstimateStatusEstimated,
+		Method:               stats.FundsEstimateAddress,
+		HostFunds:            types.Siacoins(200),
+		InitialValidRevenue:  types.Siacoins(10),
+		InitialMissedRevenue: types.Siacoins(10),
+	}
+
+	// index a contract without any market data
+	err = db.transaction(func(tx txn) error {
+		blockID, err := addBlock(tx, types.BlockID{1}, 1, time.Now())
+		if err != nil {
+			return err
+		}
+		return addActiveContract(tx, types.FileContractID{1}, fc, blockID, estimate, types.ZeroCurrency)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pending, err := db.PendingRevenue()
+	if err != nil {
+		t.Fatal(err)
+	} else if pending.Active != 1 {
+		t.Fatalf("expected 1 pending contract, got %d", pending.Active)
+	} else if !pending.Revenue.SC.Equals(types.Siacoins(10)) {
+		t.Fatalf("expected pending revenue %d, got %d", types.Siacoins(10), pending.Revenue.SC)
+	} else if !pending.Revenue.USD.IsZero() || !pending.Revenue.EUR.IsZero() || !pending.Revenue.BTC.IsZero() {
+		t.Fatalf("expected no fiat values, got %+v", pending.Revenue)
+	}
+
+	forecast, err := db.RevenueForecast(1)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(forecast) != 1 {
+		t.Fatalf("expected 1 day, got %d", len(forecast))
+	} else if !forecast[0].Revenue.USD.IsZero() {
+		t.Fatalf("expected no fiat values, got %+v", forecast[0].Revenue)
+	}
+
+	buckets, err := db.Distribution(stats.DistributionPayout, time.Now().Add(-time.Hour), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	} else if len(buckets) != 1 {
+		t.Fatalf("expected 1 bucket, got %d", len(buckets))
+	} else if buckets[0].Active != 1 {
+		t.Fatalf("expected 1 active contract, got %d", buckets[0].Active)
+	} else if !buckets[0].PendingRevenue.SC.Equals(types.Siacoins(10)) {
+		t.Fatalf("expected pending revenue %d, got %d", types.Siacoins(10), buckets[0].PendingRevenue.SC)
+	} else if !buckets[0].PendingRevenue.USD.IsZero() || !buckets[0].PendingRevenue.EUR.IsZero() || !buckets[0].PendingRevenue.BTC.IsZero() {
+		t.Fatalf("expected no fiat values, got %+v", buckets[0].PendingRevenue)
+	}
+}
@@ -0,0 +1,126 @@
+package sqlite
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"go.sia.tech/core/consensus"
+	"go.sia.tech/core/types"
+	"go.sia.tech/host-revenue-api/stats"
+)
+
+// bytesPerTB is the number of bytes in a terabyte.
+const bytesPerTB = 1e12
+
+// impliedPrice returns the price per TB-month implied by the revenue of
+// storing filesize bytes for duration blocks. The returned bool is false if the
+// contract did not store any data or the price overflows.
+func impliedPrice(revenue types.Currency, filesize, duration, monthBlocks uint64) (types.Currency, bool) {
+	if filesize == 0 || duration == 0 {
+		return types.ZeroCurrency, false
+	}
+
+	price := new(big.Int).Mul(revenue.Big(), big.NewInt(bytesPerTB))
+	price.Mul(price, new(big.Int).SetUint64(monthBlocks))
+	price.Quo(price, new(big.Int).Mul(new(big.Int).SetUint64(filesize), new(big.Int).SetUint64(duration)))
+	if price.BitLen() > 128 {
+		return types.ZeroCurrency, false
+	}
+	lo := new(big.Int).And(price, new(big.Int).SetUint64(^uint64(0))).Uint64()
+	hi := new(big.Int).Rsh(price, 64).Uint64()
+	return types.NewCurrency(lo, hi), true
+}
+
+// priceIndex returns the nearest-rank percentiles of the prices. Each
+// currency is sorted separately.
+func priceIndex(prices []stats.Values) (index stats.StoragePrice) {
+	index.Contracts = len(prices)
+	if len(prices) == 0 {
+		return
+	}
+
+	sc := make([]types.Currency, len(prices))
+	usd := make([]decimal.Decimal, len(prices))
+	eur := make([]decimal.Decimal, len(prices))
+	btc := make([]decimal.Decimal, len(prices))
+	for i, p := range prices {
+		sc[i], usd[i], eur[i], btc[i] = p.SC, p.USD, p.EUR, p.BTC
+	}
+	sort.Slice(sc, func(i, j int) bool { return sc[i].Cmp(sc[j]) < 0 })
+	for _, values := range [][]decimal.Decimal{usd, eur, btc} {
+		sort.Slice(values, func(i, j int) bool { return values[i].LessThan(values[j]) })
+	}
+
+	percentile := func(p int) stats.Values {
+		i := (p*len(prices)+99)/100 - 1
+		if i < 0 {
+			i = 0
+		}
+		return stats.Values{SC: sc[i], USD: usd[i], EUR: eur[i], BTC: btc[i]}
+	}
+	index.P10 = percentile(10)
+	index.P25 = percentile(25)
+	index.Median = percentile(50)
+	index.P75 = percentile(75)
+	index.P90 = percentile(90)
+	return
+}
+
+// StoragePrices returns the storage price per TB-month implied by the
+// revision revenue of the valid contracts resolved in each period between
+// start and end. The revision revenue includes bandwidth, so the price is an
+// upper bound. Contracts without data are skipped. Fiat prices are valued at
+// the exchange rate when the contract was resolved.
+func (s *Store) StoragePrices(start, end time.Time, period string) (index []stats.StoragePrice, err error) {
+	start, end = periodRange(start, end, period)
+	monthBlocks := uint64(30 * 24 * time.Hour / consensus.State{Network: s.network}.BlockInterval())
+
+	prices := make(map[int64][]stats.Values)
+	err = s.transaction(func(tx txn) error {
+		const query = `SELECT fb.height, c.expiration_height, c.filesize, c.revision_revenue_sc, c.usd_rate, c.eur_rate, c.btc_rate, rb.date_created
+FROM archived_contracts c
+INNER JOIN blocks fb ON c.block_id=fb.id
+INNER JOIN blocks rb ON c.resolved_block_id=rb.id
+WHERE c.valid AND c.filesize > 0 AND rb.date_created BETWEEN $1 AND $2`
+		rows, err := tx.Query(query, sqlTime(start), sqlTime(end))
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var formationHeight, expirationHeight, filesize uint64
+			var revenue types.Currency
+			var usdRate, eurRate, btcRate decimal.Decimal
+			var timestamp time.Time
+			err := rows.Scan(&formationHeight, &expirationHeight, &filesize, (*sqlCurrency)(&revenue), &usdRate, &eurRate, &btcRate, (*sqlTime)(&timestamp))
+			if err != nil {
+				return fmt.Errorf("failed to scan archived contract: %w", err)
+			} else if expirationHeight <= formationHeight {
+				continue
+			}
+
+			price, ok := impliedPrice(revenue, filesize, expirationHeight-formationHeight, monthBlocks)
+			if !ok {
+				continue
+			}
+			key := stats.NormalizePeriod(timestamp.In(start.Location()), period).Unix()
+			prices[key] = append(prices[key], fiatValues(price, usdRate, eurRate, btcRate))
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for t := start; t.Before(end); t = nextPeriod(t, period) {
+		p := priceIndex(prices[t.Unix()])
+		p.Confirmations = s.confirmations
+		p.Timestamp = t
+		index = append(index, p)
+	}
+	return
+}
@@ -0,0 +1,78 @@
+package sqlite
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"go.sia.tech/core/types"
+	"go.sia.tech/host-revenue-api/stats"
+)
+
+func TestImpliedPrice(t *testing.T) {
+	const monthBlocks = 4320
+
+	tests := []struct {
+		revenue            types.Currency
+		filesize, duration uint64
+		price              types.Currency
+		ok                 bool
+	}{
+		{types.Siacoins(100), 1e12, monthBlocks, types.Siacoins(100), true},
+		{types.Siacoins(100), 5e11, monthBlocks, types.Siacoins(200), true},
+		{types.Siacoins(100), 1e12, 2 * monthBlocks, types.Siacoins(50), true},
+		{types.Siacoins(100), 1 << 22, monthBlocks, types.Siacoins(100).Mul64(1e12).Div64(1 << 22), true},
+		{types.ZeroCurrency, 1e12, monthBlocks, types.ZeroCurrency, true},
+		{types.Siacoins(100), 0, monthBlocks, types.ZeroCurrency, false},
+		{types.Siacoins(100), 1e12, 0, types.ZeroCurrency, false},
+		{types.MaxCurrency, 1, 1, types.ZeroCurrency, false},
+	}
+
+	for _, test := range tests {
+		price, ok := impliedPrice(test.revenue, test.filesize, test.duration, monthBlocks)
+		if ok != test.ok {
+			t.Fatalf("%d over %d bytes and %d blocks: expected ok %v, got %v", test.revenue, test.filesize, test.duration, test.ok, ok)
+		} else if !price.Equals(test.price) {
+			t.Fatalf("%d over %d bytes and %d blocks: expected %d, got %d", test.revenue, test.filesize, test.duration, test.price, price)
+		}
+	}
+}
+
+func TestPriceIndex(t *testing.T) {
+	if index := priceIndex(nil); index.Contracts != 0 || !index.Median.IsZero() {
+		t.Fatalf("expected an empty index, got %+v", index)
+	}
+
+	// the fiat prices are in the opposite order to check that each currency
+	// is sorted separately
+	var prices []stats.Values
+	for i := 1; i <= 10; i++ {
+		prices = append(prices, stats.Values{
+			SC:  types.Siacoins(uint32(i)),
+			USD: decimal.NewFromInt(int64(11 - i)),
+			EUR: decimal.NewFromInt(int64(11 - i)),
+			BTC: decimal.NewFromInt(int64(11 - i)),
+		})
+	}
+
+	index := priceIndex(prices)
+	for _, test := range []struct {
+		name  string
+		value stats.Values
+		rank  uint32
+	}{
+		{"p10", index.P10, 1},
+		{"p25", index.P25, 3},
+		{"median", index.Median, 5},
+		{"p75", index.P75, 8},
+		{"p90", index.P90, 9},
+	} {
+		if !test.value.SC.Equals(types.Siacoins(test.rank)) {
+			t.Fatalf("expected %s of %d, got %d", test.name, types.Siacoins(test.rank), test.value.SC)
+		} else if !test.value.USD.Equal(decimal.NewFromInt(int64(test.rank))) {
+			t.Fatalf("expected %s of $%d, got $%s", test.name, test.rank, test.value.USD)
+		}
+	}
+	if index.Contracts != 10 {
+		t.Fatalf("expected 10 contracts, got %d", index.Contracts)
+	}
+}
@@ -0,0 +1,466 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"go.sia.tech/core/types"
+	"go.sia.tech/host-revenue-api/stats"
+)
+
+type (
+	// A RecomputeReport summarizes the re-estimation of contracts with the
+	// current estimator.
+	RecomputeReport struct {
+		EstimatorVersion int
+		// Contracts is the number of contracts that were re-estimated.
+		Contracts int
+		// Changed is the number of contracts whose estimate changed.
+		Changed int
+		// Before and After are the current stats before and after the
+		// contracts were re-estimated.
+		Before stats.ContractState
+		After  stats.ContractState
+		// Committed is true if the changes were committed.
+		Committed bool
+	}
+
+	// A contractFormation is a contract and the transaction that formed it.
+	contractFormation struct {
+		ID        types.FileContractID
+		BlockID   int64
+		Timestamp time.Time
+		Contract  types.FileContract
+		Inputs    []siacoinElement
+		Outputs   []siacoinElement
+		Fees      types.Currency
+		Count     int
+	}
+
+	// A contractResolution is the resolution of an archived contract.
+	contractResolution struct {
+		BlockID   int64
+		Timestamp time.Time
+		Valid     bool
+
+		InitialValid  types.Currency
+		InitialMissed types.Currency
+		FinalValid    types.Currency
+		FinalMissed   types.Currency
+
+		Revenue                   stats.Values
+		FeeRevenue                stats.Values
+		RevisionRevenue           stats.Values
+		USDRate, EURRate, BTCRate decimal.Decimal
+	}
+)
+
+// errRecomputeDryRun is returned to roll back the changes made while computing
+// a recompute report.
+var errRecomputeDryRun = errors.New("recompute dry run")
+
+// revenueSplit returns the fee and revision revenue of the contract using the
+// initial revenue of the estimate, valued at the exchange rates of its
+// resolution.
+func (cr contractResolution) revenueSplit(estimate fundsEstimate) (fees, revisions stats.Values) {
+	initial, final, initialRevenue := cr.InitialMissed, cr.FinalMissed, estimate.InitialMissedRevenue
+	if cr.Valid {
+		initial, final, initialRevenue = cr.InitialValid, cr.FinalValid, estimate.InitialValidRevenue
+	}
+
+	feesSC, revisionsSC := contractRevenue(initial, final, initialRevenue)
+	return fiatValues(feesSC, cr.USDRate, cr.EURRate, cr.BTCRate), fiatValues(revisionsSC, cr.USDRate, cr.EURRate, cr.BTCRate)
+}
+
+// revenue returns the revenue of the contract using the initial revenue of the
+// estimate, valued at the exchange rates of its resolution.
+func (cr contractResolution) revenue(estimate fundsEstimate) stats.Values {
+	fees, revisions := cr.revenueSplit(estimate)
+	return fees.Add(revisions)
+}
+
+// formationDelta returns the contribution of a contract's estimate to the
+// stats of the block that formed it.
+func formationDelta(estimate fundsEstimate) (sd statDelta) {
+	sd.Collateral.Locked = sd.Collateral.Locked.Add(estimate.HostFunds)
+	switch estimate.Status {
+	case stats.EstimateStatusEstimated:
+		sd.Estimates.Estimated++
+	case stats.EstimateStatusSkipped:
+		sd.Estimates.Skipped++
+	case stats.EstimateStatusFailed:
+		sd.Estimates.Failed++
+	}
+	return
+}
+
+func setBlockStats(tx txn, blockID int64, delta statDelta) error {
+	query := `INSERT INTO block_contract_stats (block_id, ` + statColumns + `) VALUES ($1, ` + statPlaceholders(2) + `)
+ON CONFLICT (block_id) DO UPDATE SET ` + statUpdates
+	_, err := tx.Exec(query, append([]any{blockID}, delta.args()...)...)
+	return err
+}
+
+func setBlockHostStats(tx txn, blockID int64, addr types.Address, delta statDelta) error {
+	query := `INSERT INTO block_host_stats (block_id, host_address, ` + statColumns + `) VALUES ($1, $2, ` + statPlaceholders(3) + `)
+ON CONFLICT (block_id, host_address) DO UPDATE SET ` + statUpdates
+	_, err := tx.Exec(query, append([]any{blockID, sqlHash256(addr)}, delta.args()...)...)
+	return err
+}
+
+// replaceContribution replaces a contract's contribution to the stats of a
+// block. The block's stored deltas are updated as well so that reverting the
+// block stays exact.
+func replaceContribution(tx txn, blockID int64, timestamp time.Time, addr *types.Address, prev, next statDelta) error {
+	delta, err := blockStats(tx, blockID)
+	if err != nil {
+		return fmt.Errorf("failed to get block stats: %w", err)
+	} else if delta, err = delta.replace(prev, next); err != nil {
+		return fmt.Errorf("failed to replace block stats: %w", err)
+	} else if err := setBlockStats(tx, blockID, delta); err != nil {
+		return fmt.Errorf("failed to set block stats: %w", err)
+	} else if err := updateContractStats(tx, prev, timestamp, true); err != nil {
+		return fmt.Errorf("failed to revert contract stats: %w", err)
+	} else if err := updateContractStats(tx, next, timestamp, false); err != nil {
+		return fmt.Errorf("failed to update contract stats: %w", err)
+	}
+
+	if addr == nil {
+		return nil
+	}
+
+	hostDeltas, err := blockHostStats(tx, blockID)
+	if err != nil {
+		return fmt.Errorf("failed to get block host stats: %w", err)
+	} else if delta, err = hostDeltas[*addr].replace(prev, next); err != nil {
+		return fmt.Errorf("failed to replace block host stats: %w", err)
+	} else if err := setBlockHostStats(tx, blockID, *addr, delta); err != nil {
+		return fmt.Errorf("failed to set block host stats: %w", err)
+	} else if err := updateHostStats(tx, *addr, prev, timestamp, true); err != nil {
+		return fmt.Errorf("failed to revert host stats: %w", err)
+	} else if err := updateHostStats(tx, *addr, next, timestamp, false); err != nil {
+		return fmt.Errorf("failed to update host stats: %w", err)
+	}
+	return nil
+}
+
+// contractEstimate returns the current estimate and host address of a
+// contract. Resolved contracts may no longer be active, so the archive is
+// checked first.
+func contractEstimate(tx txn, id types.FileContractID) (estimate fundsEstimate, addr *types.Address, err error) {
+	const query = `SELECT host_address, host_funds, host_funds_method, estimate_status, initial_valid_revenue, initial_missed_revenue FROM %s WHERE contract_id=$1`
+
+	var hostAddr types.Address
+	hostID := nullable((*sqlHash256)(&hostAddr))
+	dest := []any{hostID, (*sqlCurrency)(&estimate.HostFunds), &estimate.Method, &estimate.Status, (*sqlCurrency)(&estimate.InitialValidRevenue), (*sqlCurrency)(&estimate.InitialMissedRevenue)}
+	err = tx.QueryRow(fmt.Sprintf(query, "archived_contracts"), sqlHash256(id)).Scan(dest...)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = tx.QueryRow(fmt.Sprintf(query, "active_contracts"), sqlHash256(id)).Scan(dest...)
+	}
+	if err != nil {
+		return fundsEstimate{}, nil, err
+	} else if hostID.Valid {
+		addr = &hostAddr
+	}
+	return
+}
+
+// archivedResolution returns the resolution of an archived contract. The bool
+// is false if the contract has not been archived.
+func archivedResolution(tx txn, id types.FileContractID) (cr contractResolution, ok bool, err error) {
+	const query = `SELECT c.resolved_block_id, b.date_created, c.valid,
+c.initial_valid_payout_value, c.initial_missed_payout_value, c.valid_payout_value, c.missed_payout_value,
+c.estimated_revenue_sc, c.estimated_revenue_usd, c.estimated_revenue_eur, c.estimated_revenue_btc,
+c.fee_revenue_sc, c.fee_revenue_usd, c.fee_revenue_eur, c.fee_revenue_btc,
+c.revision_revenue_sc, c.revision_revenue_usd, c.revision_revenue_eur, c.revision_revenue_btc,
+c.usd_rate, c.eur_rate, c.btc_rate
+FROM archived_contracts c
+INNER JOIN blocks b ON c.resolved_block_id=b.id
+WHERE c.contract_id=$1`
+
+	err = tx.QueryRow(query, sqlHash256(id)).Scan(&cr.BlockID, (*sqlTime)(&cr.Timestamp), &cr.Valid,
+		(*sqlCurrency)(&cr.InitialValid), (*sqlCurrency)(&cr.InitialMissed), (*sqlCurrency)(&cr.FinalValid), (*sqlCurrency)(&cr.FinalMissed),
+		(*sqlCurrency)(&cr.Revenue.SC), &cr.Revenue.USD, &cr.Revenue.EUR, &cr.Revenue.BTC,
+		(*sqlCurrency)(&cr.FeeRevenue.SC), &cr.FeeRevenue.USD, &cr.FeeRevenue.EUR, &cr.FeeRevenue.BTC,
+		(*sqlCurrency)(&cr.RevisionRevenue.SC), &cr.RevisionRevenue.USD, &cr.RevisionRevenue.EUR, &cr.RevisionRevenue.BTC,
+		&cr.USDRate, &cr.EURRate, &cr.BTCRate)
+	if errors.Is(err, sql.ErrNoRows) {
+		return contractResolution{}, false, nil
+	}
+	return cr, err == nil, err
+}
+
+// replaceAccrual replaces a contract's ledger entries of a kind with a single
+// entry. No entry is added if the revenue is zero.
+func replaceAccrual(tx txn, id types.FileContractID, blockID int64, kind string, revenue stats.Values) error {
+	if _, err := tx.Exec(`DELETE FROM contract_accruals WHERE contract_id=$1 AND kind=$2`, sqlHash256(id), kind); err != nil {
+		return fmt.Errorf("failed to delete accruals: %w", err)
+	} else if revenue.IsZero() {
+		return nil
+	}
+	return addAccrual(tx, id, blockID, kind, revenue)
+}
+
+// setContractEstimate replaces the estimate of a contract and the stats that
+// were derived from it. It returns true if the estimate changed.
+func setContractEstimate(tx txn, f contractFormation, estimate fundsEstimate, version int) (bool, error) {
+	prev, addr, err := contractEstimate(tx, f.ID)
+	if err != nil {
+		return false, fmt.Errorf("failed to get estimate: %w", err)
+	}
+
+	changed := prev != estimate
+	if changed {
+		// the initial revenue is accrued at formation
+		prevFormation, nextFormation := formationDelta(prev), formationDelta(estimate)
+		prevFormation.Accrued, err = accrualTotal(tx, f.ID, stats.AccrualFormation)
+		if err != nil {
+			return false, fmt.Errorf("failed to get formation accrual: %w", err)
+		} else if !estimate.InitialValidRevenue.IsZero() {
+			usdRate, eurRate, btcRate, err := getExchangeRate(tx, f.Timestamp)
+			if err != nil {
+				return false, fmt.Errorf("failed to get exchange rate: %w", err)
+			}
+			nextFormation.Accrued = fiatValues(estimate.InitialValidRevenue, usdRate, eurRate, btcRate)
+		}
+
+		if err := replaceContribution(tx, f.BlockID, f.Timestamp, addr, prevFormation, nextFormation); err != nil {
+			return false, fmt.Errorf("failed to replace formation stats: %w", err)
+		} else if err := replaceAccrual(tx, f.ID, f.BlockID, stats.AccrualFormation, nextFormation.Accrued); err != nil {
+			return false, fmt.Errorf("failed to replace formation accrual: %w", err)
+		}
+
+		resolution, resolved, err := archivedResolution(tx, f.ID)
+		if err != nil {
+			return false, fmt.Errorf("failed to get resolution: %w", err)
+		} else if resolved {
+			revenue := resolution.revenue(estimate)
+			fees, revisions := resolution.revenueSplit(estimate)
+
+			prevDelta := statDelta{Revenue: resolution.Revenue, FeeRevenue: resolution.FeeRevenue, RevisionRevenue: resolution.RevisionRevenue}
+			prevDelta.Collateral.Locked = prevDelta.Collateral.Locked.Sub(prev.HostFunds)
+			nextDelta := statDelta{Revenue: revenue, FeeRevenue: fees, RevisionRevenue: revisions}
+			nextDelta.Collateral.Locked = nextDelta.Collateral.Locked.Sub(estimate.HostFunds)
+
+			// missed contracts reverse everything they accrued
+			if !resolution.Valid {
+				if prevDelta.Reversed, err = accrualTotal(tx, f.ID, stats.AccrualReversal); err != nil {
+					return false, fmt.Errorf("failed to get reversed revenue: %w", err)
+				} else if nextDelta.Reversed, err = accruedRevenue(tx, f.ID); err != nil {
+					return false, fmt.Errorf("failed to get accrued revenue: %w", err)
+				} else if err := replaceAccrual(tx, f.ID, resolution.BlockID, stats.AccrualReversal, nextDelta.Reversed); err != nil {
+					return false, fmt.Errorf("failed to replace reversal: %w", err)
+				}
+			}
+
+			if err := replaceContribution(tx, resolution.BlockID, resolution.Timestamp, addr, prevDelta, nextDelta); err != nil {
+				return false, fmt.Errorf("failed to replace resolution stats: %w", err)
+			}
+
+			const query = `UPDATE archived_contracts SET (estimated_revenue_sc, estimated_revenue_usd, estimated_revenue_eur, estimated_revenue_btc,
+fee_revenue_sc, fee_revenue_usd, fee_revenue_eur, fee_revenue_btc,
+revision_revenue_sc, revision_revenue_usd, revision_revenue_eur, revision_revenue_btc) = ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) WHERE contract_id=$13`
+			if _, err := tx.Exec(query, sqlCurrency(revenue.SC), revenue.USD, revenue.EUR, revenue.BTC,
+				sqlCurrency(fees.SC), fees.USD, fees.EUR, fees.BTC,
+				sqlCurrency(revisions.SC), revisions.USD, revisions.EUR, revisions.BTC, sqlHash256(f.ID)); err != nil {
+				return false, fmt.Errorf("failed to update revenue: %w", err)
+			}
+		}
+	}
+
+	for _, table := range []string{"active_contracts", "archived_contracts"} {
+		query := `UPDATE ` + table + ` SET (host_funds, host_funds_method, estimate_status, initial_valid_revenue, initial_missed_revenue, estimator_version) = ($1, $2, $3, $4, $5, $6) WHERE contract_id=$7`
+		if _, err := tx.Exec(query, sqlCurrency(estimate.HostFunds), estimate.Method, estimate.Status, sqlCurrency(estimate.InitialValidRevenue), sqlCurrency(estimate.InitialMissedRevenue), version, sqlHash256(f.ID)); err != nil {
+			return false, fmt.Errorf("failed to update %s: %w", table, err)
+		}
+	}
+	return changed, nil
+}
+
+// staleFormations returns the formations of the contracts that were estimated
+// by an older estimator.
+func staleFormations(tx txn) ([]contractFormation, error) {
+	const query = `SELECT f.id, f.contract_id, f.block_id, b.date_created, f.file_contract, f.miner_fees, f.contract_count
+FROM contract_formations f
+INNER JOIN blocks b ON f.block_id=b.id
+LEFT JOIN active_contracts ac ON f.contract_id=ac.contract_id
+LEFT JOIN archived_contracts arc ON f.contract_id=arc.contract_id
+WHERE COALESCE(arc.estimator_version, ac.estimator_version) < $1
+ORDER BY f.id ASC`
+
+	rows, err := tx.Query(query, estimatorVersion)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	var formations []contractFormation
+	for rows.Next() {
+		var id int64
+		var f contractFormation
+		if err := rows.Scan(&id, (*sqlHash256)(&f.ID), &f.BlockID, (*sqlTime)(&f.Timestamp), (*sqlFileContract)(&f.Contract), (*sqlCurrency)(&f.Fees), &f.Count); err != nil {
+			return nil, fmt.Errorf("failed to scan formation: %w", err)
+		}
+		ids = append(ids, id)
+		formations = append(formations, f)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	for i, id := range ids {
+		if err := formationElements(tx, id, &formations[i]); err != nil {
+			return nil, fmt.Errorf("failed to get elements of formation %q: %w", formations[i].ID, err)
+		}
+	}
+	return formations, nil
+}
+
+// formationElements adds the siacoin inputs and outputs of a formation
+// transaction to f in their original order.
+func formationElements(tx txn, formationID int64, f *contractFormation) error {
+	rows, err := tx.Query(`SELECT output, address, value FROM contract_formation_elements WHERE formation_id=$1 ORDER BY id ASC`, formationID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var output bool
+		var sce siacoinElement
+		if err := rows.Scan(&output, (*sqlHash256)(&sce.Address), (*sqlCurrency)(&sce.Value)); err != nil {
+			return fmt.Errorf("failed to scan element: %w", err)
+		}
+		if output {
+			f.Outputs = append(f.Outputs, sce)
+		} else {
+			f.Inputs = append(f.Inputs, sce)
+		}
+	}
+	return rows.Err()
+}
+
+// currentMetrics returns the latest contract stats. The stats are empty if no
+// blocks have been indexed.
+func currentMetrics(tx txn) (stats.ContractState, error) {
+	state, err := getMetrics(tx, time.Now())
+	if errors.Is(err, sql.ErrNoRows) {
+		return stats.ContractState{}, nil
+	}
+	return state, err
+}
+
+// recomputeState identifies the state of the database a recompute report was
+// computed against.
+type recomputeState struct {
+	Tip types.BlockID
+	// EstimatorVersion is the highest estimator version of any contract.
+	EstimatorVersion int
+	// Stale is the number of contracts estimated by an older estimator.
+	Stale int
+}
+
+// currentRecomputeState returns the chain tip and the estimator versions of
+// the contracts.
+func currentRecomputeState(tx txn) (state recomputeState, err error) {
+	err = tx.QueryRow(`SELECT block_id FROM blocks ORDER BY height DESC LIMIT 1`).Scan((*sqlHash256)(&state.Tip))
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return recomputeState{}, fmt.Errorf("failed to get chain tip: %w", err)
+	}
+
+	const query = `SELECT COALESCE(MAX(estimator_version), 0), COALESCE(SUM(estimator_version < $1), 0) FROM (
+	SELECT estimator_version FROM active_contracts
+	UNION ALL
+	SELECT estimator_version FROM archived_contracts
+)`
+	if err := tx.QueryRow(query, estimatorVersion).Scan(&state.EstimatorVersion, &state.Stale); err != nil {
+		return recomputeState{}, fmt.Errorf("failed to get estimator versions: %w", err)
+	}
+	return state, nil
+}
+
+// reestimateContracts re-estimates the stale contracts and returns the report
+// of the changes.
+func reestimateContracts(tx txn) (RecomputeReport, error) {
+	report := RecomputeReport{EstimatorVersion: estimatorVersion}
+
+	var err error
+	report.Before, err = currentMetrics(tx)
+	if err != nil {
+		return RecomputeReport{}, fmt.Errorf("failed to get metrics: %w", err)
+	}
+
+	formations, err := staleFormations(tx)
+	if err != nil {
+		return RecomputeReport{}, fmt.Errorf("failed to get stale contracts: %w", err)
+	}
+
+	for _, f := range formations {
+		estimate := estimateContract(f.Contract, f.Inputs, f.Outputs, f.Fees, f.Count)
+		changed, err := setContractEstimate(tx, f, estimate, estimatorVersion)
+		if err != nil {
+			return RecomputeReport{}, fmt.Errorf("failed to re-estimate contract %q: %w", f.ID, err)
+		}
+		report.Contracts++
+		if changed {
+			report.Changed++
+		}
+	}
+
+	report.After, err = currentMetrics(tx)
+	if err != nil {
+		return RecomputeReport{}, fmt.Errorf("failed to get metrics: %w", err)
+	}
+	return report, nil
+}
+
+// Recompute re-estimates the contracts that were estimated by an older
+// estimator from their stored formation transactions, then re-derives their
+// revenue and the block, hourly and host stats that depend on the estimate.
+// The report is computed in a transaction that is rolled back and passed to
+// confirm outside of any transaction. If confirm returns true, the changes are
+// applied in a new transaction, failing if the chain tip or the estimated
+// contracts changed in the meantime.
+func (s *Store) Recompute(confirm func(RecomputeReport) bool) (RecomputeReport, error) {
+	var report RecomputeReport
+	var state recomputeState
+	err := s.transaction(func(tx txn) (err error) {
+		state, err = currentRecomputeState(tx)
+		if err != nil {
+			return err
+		}
+		report, err = reestimateContracts(tx)
+		if err != nil {
+			return err
+		}
+		return errRecomputeDryRun
+	})
+	if !errors.Is(err, errRecomputeDryRun) {
+		return RecomputeReport{}, err
+	} else if !confirm(report) {
+		return report, nil
+	}
+
+	err = s.transaction(func(tx txn) error {
+		current, err := currentRecomputeState(tx)
+		if err != nil {
+			return err
+		} else if current.Tip != state.Tip {
+			return errors.New("chain tip changed since the report was computed")
+		} else if current.EstimatorVersion != state.EstimatorVersion || current.Stale != state.Stale {
+			return errors.New("contracts were re-estimated since the report was computed")
+		}
+		_, err = reestimateContracts(tx)
+		return err
+	})
+	if err != nil {
+		return RecomputeReport{}, err
+	}
+	report.Committed = true
+	return report, nil
+}
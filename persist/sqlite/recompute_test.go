@@ -0,0 +1,217 @@
+package sqlite
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"go.sia.tech/core/types"
+	"go.sia.tech/host-revenue-api/stats"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestRecompute(t *testing.T) {
+	db, err := OpenDatabase(filepath.Join(t.TempDir(), "test.db"), DefaultConfirmations, zaptest.NewLogger(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	rate := decimal.NewFromInt(2)
+	if err := db.AddMarketData(rate, rate, rate, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	renterAddr, hostAddr := types.Address{1}, types.Address{2}
+	fc := types.FileContract{
+		Payout: types.Siacoins(322),
+		ValidProofOutputs: []types.SiacoinOutput{
+			{Address: renterAddr, Value: types.Siacoins(100)},
+			{Address: hostAddr, Value: types.Siacoins(210)},
+		},
+		MissedProofOutputs: []types.SiacoinOutput{
+			{Address: renterAddr, Value: types.Siacoins(100)},
+			{Address: hostAddr, Value: types.Siacoins(210)},
+			{Address: types.VoidAddress, Value: types.ZeroCurrency},
+		},
+	}
+	inputs := []siacoinElement{{Address: renterAddr, Value: types.Siacoins(500)}, {Address: hostAddr, Value: types.Siacoins(300)}}
+	outputs := []siacoinElement{{Address: renterAddr, Value: types.Siacoins(377)}, {Address: hostAddr, Value: types.Siacoins(100)}}
+	fees := types.Siacoins(1)
+	fcID := types.FileContractID{1}
+
+	formed := time.Now().Add(-2 * time.Hour).Truncate(time.Second)
+	resolved := formed.Add(time.Hour)
+
+	// index a contract that an older estimator failed to estimate
+	err = db.transaction(func(tx txn) error {
+		formationID, err := addBlock(tx, types.BlockID{1}, 1, formed)
+		if err != nil {
+			return err
+		}
+		estimate := fundsEstimate{Status: stats.EstimateStatusFailed}
+		if err := addActiveContract(tx, fcID, fc, formationID, estimate, types.ZeroCurrency); err != nil {
+			return err
+		} else if err := addContractFormation(tx, fcID, fc, formationID, inputs, outputs, fees, 1); err != nil {
+			return err
+		} else if _, err := tx.Exec(`UPDATE active_contracts SET estimator_version=1`); err != nil {
+			return err
+		}
+		delta := formationDelta(estimate)
+		delta.Active++
+		if err := addBlockStats(tx, formationID, delta); err != nil {
+			return err
+		} else if err := updateContractStats(tx, delta, formed, false); err != nil {
+			return err
+		} else if err := addBlockHostStats(tx, formationID, hostAddr, delta); err != nil {
+			return err
+		} else if err := updateHostStats(tx, hostAddr, delta, formed, false); err != nil {
+			return err
+		}
+
+		resolutionID, err := addBlock(tx, types.BlockID{2}, 2, resolved)
+		if err != nil {
+			return err
+		} else if err := resolveContract(tx, fcID, resolutionID, true, stats.Values{}, stats.Values{}, stats.Values{}, stats.Values{}, stats.Values{}, rate, rate, rate); err != nil {
+			return err
+		}
+		delta = statDelta{Active: -1, Valid: 1}
+		if err := addBlockStats(tx, resolutionID, delta); err != nil {
+			return err
+		} else if err := updateContractStats(tx, delta, resolved, false); err != nil {
+			return err
+		} else if err := addBlockHostStats(tx, resolutionID, hostAddr, delta); err != nil {
+			return err
+		}
+		return updateHostStats(tx, hostAddr, delta, resolved, false)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the host added 200 SC, so the initial revenue is 10 SC
+	expectedRevenue := types.Siacoins(10)
+
+	// an unconfirmed recompute should not change anything
+	report, err := db.Recompute(func(RecomputeReport) bool { return false })
+	if err != nil {
+		t.Fatal(err)
+	} else if report.Committed {
+		t.Fatal("expected recompute to be rolled back")
+	} else if report.Contracts != 1 || report.Changed != 1 {
+		t.Fatalf("expected 1 changed contract, got %d of %d", report.Changed, report.Contracts)
+	} else if !report.Before.Revenue.SC.IsZero() {
+		t.Fatalf("expected no revenue before, got %d", report.Before.Revenue.SC)
+	} else if !report.After.Revenue.SC.Equals(expectedRevenue) {
+		t.Fatalf("expected revenue %d after, got %d", expectedRevenue, report.After.Revenue.SC)
+	}
+
+	state, err := db.Metrics(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	} else if !state.Revenue.SC.IsZero() {
+		t.Fatalf("expected no revenue, got %d", state.Revenue.SC)
+	} else if state.Estimates != (stats.EstimateCoverage{Failed: 1}) {
+		t.Fatalf("expected 1 failed estimate, got %+v", state.Estimates)
+	}
+
+	// the changes must not be applied if a block is indexed while waiting for
+	// confirmation
+	_, err = db.Recompute(func(RecomputeReport) bool {
+		err := db.transaction(func(tx txn) error {
+			_, err := addBlock(tx, types.BlockID{3}, 3, time.Now())
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return true
+	})
+	if err == nil {
+		t.Fatal("expected recompute to fail after the chain tip changed")
+	} else if contract, err := db.Contract(fcID); err != nil {
+		t.Fatal(err)
+	} else if contract.EstimatorVersion != 1 {
+		t.Fatalf("expected estimator version 1, got %d", contract.EstimatorVersion)
+	}
+
+	report, err = db.Recompute(func(RecomputeReport) bool { return true })
+	if err != nil {
+		t.Fatal(err)
+	} else if !report.Committed {
+		t.Fatal("expected recompute to be committed")
+	}
+
+	state, err = db.Metrics(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	} else if !state.Revenue.SC.Equals(expectedRevenue) {
+		t.Fatalf("expected revenue %d, got %d", expectedRevenue, state.Revenue.SC)
+	} else if !state.Revenue.USD.Equal(decimal.NewFromInt(20)) {
+		t.Fatalf("expected revenue $20, got $%s", state.Revenue.USD)
+	} else if !state.Collateral.Locked.IsZero() {
+		t.Fatalf("expected no locked collateral, got %d", state.Collateral.Locked)
+	} else if state.Estimates != (stats.EstimateCoverage{Estimated: 1}) {
+		t.Fatalf("expected 1 estimated contract, got %+v", state.Estimates)
+	} else if !state.Accrued.SC.Equals(expectedRevenue) {
+		t.Fatalf("expected accrued revenue %d, got %d", expectedRevenue, state.Accrued.SC)
+	} else if !state.FeeRevenue.SC.Equals(expectedRevenue) {
+		t.Fatalf("expected fee revenue %d, got %d", expectedRevenue, state.FeeRevenue.SC)
+	}
+
+	// the collateral was locked until the contract was resolved
+	state, err = db.Metrics(formed)
+	if err != nil {
+		t.Fatal(err)
+	} else if !state.Collateral.Locked.Equals(types.Siacoins(200)) {
+		t.Fatalf("expected 200 SC locked, got %d", state.Collateral.Locked)
+	}
+
+	state, err = db.HostMetrics(hostAddr, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	} else if !state.Revenue.SC.Equals(expectedRevenue) {
+		t.Fatalf("expected host revenue %d, got %d", expectedRevenue, state.Revenue.SC)
+	}
+
+	contract, err := db.Contract(fcID)
+	if err != nil {
+		t.Fatal(err)
+	} else if contract.EstimatorVersion != estimatorVersion {
+		t.Fatalf("expected estimator version %d, got %d", estimatorVersion, contract.EstimatorVersion)
+	} else if contract.HostFundsMethod != stats.FundsEstimateAddress {
+		t.Fatalf("expected method %q, got %q", stats.FundsEstimateAddress, contract.HostFundsMethod)
+	} else if !contract.HostFunds.Equals(types.Siacoins(200)) {
+		t.Fatalf("expected 200 SC host funds, got %d", contract.HostFunds)
+	} else if !contract.Revenue.SC.Equals(expectedRevenue) {
+		t.Fatalf("expected contract revenue %d, got %d", expectedRevenue, contract.Revenue.SC)
+	}
+
+	// the resolution block's delta must include the new revenue so that
+	// reverting it stays exact
+	err = db.transaction(func(tx txn) error {
+		var resolutionID int64
+		if err := tx.QueryRow(`SELECT id FROM blocks WHERE height=2`).Scan(&resolutionID); err != nil {
+			return err
+		}
+		delta, err := blockStats(tx, resolutionID)
+		if err != nil {
+			return err
+		} else if !delta.Revenue.SC.Equals(expectedRevenue) {
+			t.Fatalf("expected block revenue %d, got %d", expectedRevenue, delta.Revenue.SC)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the contract is up to date
+	report, err = db.Recompute(func(RecomputeReport) bool { return true })
+	if err != nil {
+		t.Fatal(err)
+	} else if report.Contracts != 0 {
+		t.Fatalf("expected no contracts to re-estimate, got %d", report.Contracts)
+	}
+}
@@ -1,16 +1,23 @@
 package sqlite
 
 import (
+	"database/sql"
+	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/shopspring/decimal"
+	"go.sia.tech/core/types"
+	"go.sia.tech/host-revenue-api/stats"
+	"go.sia.tech/siad/modules"
 	"go.uber.org/zap/zaptest"
 )
 
 func TestInit(t *testing.T) {
 	fp := filepath.Join(t.TempDir(), "test.db")
 	log := zaptest.NewLogger(t)
-	db, err := OpenDatabase(fp, log)
+	db, err := OpenDatabase(fp, DefaultConfirmations, log)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -21,3 +28,212 @@ func TestInit(t *testing.T) {
 		t.Fatalf("expected non-zero version, got %v", version)
 	}
 }
+
+func TestConfirmations(t *testing.T) {
+	fp := filepath.Join(t.TempDir(), "test.db")
+	log := zaptest.NewLogger(t)
+	db, err := OpenDatabase(fp, 6, log)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the depth can change until blocks are indexed
+	db.Close()
+	db, err = OpenDatabase(fp, 12, log)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.transaction(func(tx txn) error {
+		if err := setLastChange(tx, modules.ConsensusChangeID{1}, 1); err != nil {
+			return err
+		}
+		return updateContractStats(tx, statDelta{Active: 1}, time.Now(), false)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := db.Metrics(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	} else if state.Confirmations != 12 {
+		t.Fatalf("expected metrics at 12 confirmations, got %d", state.Confirmations)
+	}
+
+	// every response derived from the payouts carries the depth
+	periods, err := db.ProofPeriods(time.Now().Add(-time.Hour), time.Now(), stats.PeriodHourly)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(periods) == 0 {
+		t.Fatal("expected proof periods")
+	}
+	for _, period := range periods {
+		if period.Confirmations != 12 {
+			t.Fatalf("expected proof period at 12 confirmations, got %d", period.Confirmations)
+		}
+	}
+	pending, err := db.PendingRevenue()
+	if err != nil {
+		t.Fatal(err)
+	} else if pending.Confirmations != 12 {
+		t.Fatalf("expected pending revenue at 12 confirmations, got %d", pending.Confirmations)
+	}
+	db.Close()
+
+	if _, err := OpenDatabase(fp, 6, log); err == nil {
+		t.Fatal("expected opening an indexed database with a different depth to fail")
+	}
+
+	db, err = OpenDatabase(fp, 12, log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if db.Confirmations() != 12 {
+		t.Fatalf("expected 12 confirmations, got %d", db.Confirmations())
+	}
+}
+
+func TestMigrateBlockBTCRevenue(t *testing.T) {
+	db, err := OpenDatabase(filepath.Join(t.TempDir(), "test.db"), DefaultConfirmations, zaptest.NewLogger(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	btcRate := decimal.NewFromFloat(0.0000005)
+	if err := db.AddMarketData(decimal.NewFromFloat(0.01), decimal.NewFromFloat(0.009), btcRate, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	// resolve a valid contract without a BTC revenue, like the indexer did
+	// before the conversion was fixed
+	hostAddr := types.Address{1}
+	resolved := time.Now().Add(-time.Hour).Truncate(time.Second)
+	revenue := stats.Values{SC: types.Siacoins(10), USD: decimal.NewFromFloat(0.1), EUR: decimal.NewFromFloat(0.09)}
+	err = db.transaction(func(tx txn) error {
+		blockID, err := addBlock(tx, types.BlockID{1}, 1, resolved)
+		if err != nil {
+			return err
+		}
+		delta := statDelta{Valid: 1, Revenue: revenue}
+		if err := addBlockStats(tx, blockID, delta); err != nil {
+			return err
+		} else if err := updateContractStats(tx, delta, resolved, false); err != nil {
+			return err
+		} else if err := addBlockHostStats(tx, blockID, hostAddr, delta); err != nil {
+			return err
+		}
+		return updateHostStats(tx, hostAddr, delta, resolved, false)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.transaction(migrateVersion21); err != nil {
+		t.Fatal(err)
+	} else if err := db.transaction(migrateVersion23); err != nil { // the hourly rows are already corrected
+		t.Fatal(err)
+	}
+
+	expected := decimal.NewFromInt(10).Mul(btcRate)
+	state, err := db.Metrics(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	} else if !state.Revenue.BTC.Equal(expected) {
+		t.Fatalf("expected revenue %s BTC, got %s BTC", expected, state.Revenue.BTC)
+	} else if !state.Revenue.USD.Equal(revenue.USD) {
+		t.Fatalf("expected revenue $%s, got $%s", revenue.USD, state.Revenue.USD)
+	}
+
+	state, err = db.HostMetrics(hostAddr, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	} else if !state.Revenue.BTC.Equal(expected) {
+		t.Fatalf("expected host revenue %s BTC, got %s BTC", expected, state.Revenue.BTC)
+	}
+
+	err = db.transaction(func(tx txn) error {
+		delta, err := blockStats(tx, 1)
+		if err != nil {
+			return err
+		} else if !delta.Revenue.BTC.Equal(expected) {
+			t.Fatalf("expected block revenue %s BTC, got %s BTC", expected, delta.Revenue.BTC)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMigrateHourlyBTCRevenue(t *testing.T) {
+	fp := filepath.Join(t.TempDir(), "test.db")
+	schema, err := os.ReadFile(filepath.Join("testdata", "init-v1.sql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// index the stats with the initial schema, like the indexer did before
+	// the BTC conversion of valid contracts was fixed
+	db, err := sql.Open(driverName, sqliteFilepath(fp))
+	if err != nil {
+		t.Fatal(err)
+	} else if _, err := db.Exec(string(schema)); err != nil {
+		t.Fatal(err)
+	} else if _, err := db.Exec(`UPDATE global_settings SET db_version=1`); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now().Add(-3 * time.Hour).Truncate(time.Second)
+	timestamps := []time.Time{start, start.Add(time.Hour), start.Add(2 * time.Hour)}
+	rates := []decimal.Decimal{decimal.NewFromFloat(0.0000004), decimal.NewFromFloat(0.0000005), decimal.NewFromFloat(0.0000006)}
+	for i, timestamp := range timestamps {
+		if _, err := db.Exec(`INSERT INTO market_data (date_created, usd_rate, eur_rate, btc_rate) VALUES ($1, $2, $3, $4)`, sqlTime(timestamp), decimal.NewFromFloat(0.01), decimal.NewFromFloat(0.009), rates[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a missed contract, a valid contract with a zero BTC revenue, then
+	// another missed contract
+	missedBTC := decimal.NewFromInt(5).Mul(rates[0])
+	rows := []struct {
+		valid, missed int
+		revenue       types.Currency
+		btc           decimal.Decimal
+	}{
+		{0, 1, types.Siacoins(5), missedBTC},
+		{1, 1, types.Siacoins(15), missedBTC},
+		{1, 2, types.Siacoins(18), missedBTC.Add(decimal.NewFromInt(3).Mul(rates[2]))},
+	}
+	for i, row := range rows {
+		const query = `INSERT INTO hourly_contract_stats (date_created, active_contracts, valid_contracts, missed_contracts,
+total_payouts_sc, total_payouts_usd, total_payouts_eur, total_payouts_btc,
+estimated_revenue_sc, estimated_revenue_usd, estimated_revenue_eur, estimated_revenue_btc)
+VALUES ($1, 0, $2, $3, $4, '0', '0', '0', $5, '0', '0', $6)`
+		if _, err := db.Exec(query, sqlTime(timestamps[i]), row.valid, row.missed, sqlCurrency(types.ZeroCurrency), sqlCurrency(row.revenue), row.btc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+
+	store, err := OpenDatabase(fp, DefaultConfirmations, zaptest.NewLogger(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	validBTC := decimal.NewFromInt(10).Mul(rates[1])
+	expected := []decimal.Decimal{rows[0].btc, rows[1].btc.Add(validBTC), rows[2].btc.Add(validBTC)}
+	for i, timestamp := range timestamps {
+		state, err := store.Metrics(timestamp)
+		if err != nil {
+			t.Fatal(err)
+		} else if !state.Revenue.SC.Equals(rows[i].revenue) {
+			t.Fatalf("row %d: expected revenue %d SC, got %d SC", i, rows[i].revenue, state.Revenue.SC)
+		} else if !state.Revenue.BTC.Equal(expected[i]) {
+			t.Fatalf("row %d: expected revenue %s BTC, got %s BTC", i, expected[i], state.Revenue.BTC)
+		}
+	}
+}
@@ -0,0 +1,334 @@
+package sqlite
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/host-revenue-api/stats"
+)
+
+// statColumns are the columns shared by the hourly and per-block stat tables.
+// The order must match statDelta.dest and stateDest.
+const statColumns = `active_contracts, valid_contracts, missed_contracts,
+total_payouts_sc, total_payouts_usd, total_payouts_eur, total_payouts_btc,
+estimated_revenue_sc, estimated_revenue_usd, estimated_revenue_eur, estimated_revenue_btc,
+stored_bytes, locked_collateral, risked_collateral, burned_collateral,
+burned_sc, burned_usd, burned_eur, burned_btc,
+siafund_tax_sc, siafund_tax_usd, siafund_tax_eur, siafund_tax_btc,
+miner_fees_sc, miner_fees_usd, miner_fees_eur, miner_fees_btc,
+estimates_estimated, estimates_skipped, estimates_failed,
+accrued_revenue_sc, accrued_revenue_usd, accrued_revenue_eur, accrued_revenue_btc,
+reversed_revenue_sc, reversed_revenue_usd, reversed_revenue_eur, reversed_revenue_btc,
+fee_revenue_sc, fee_revenue_usd, fee_revenue_eur, fee_revenue_btc,
+revision_revenue_sc, revision_revenue_usd, revision_revenue_eur, revision_revenue_btc`
+
+var (
+	// statColumnCount is the number of columns in statColumns.
+	statColumnCount = len(strings.Split(statColumns, ","))
+	// statUpdates sets each stat column to its excluded value in an upsert.
+	statUpdates = func() string {
+		var updates []string
+		for _, col := range strings.Split(statColumns, ",") {
+			col = strings.TrimSpace(col)
+			updates = append(updates, col+"=EXCLUDED."+col)
+		}
+		return strings.Join(updates, ", ")
+	}()
+)
+
+// A currencyDelta is a signed change in a currency value.
+type currencyDelta struct {
+	Amount   types.Currency
+	Negative bool
+}
+
+// IsZero returns true if the delta does not change the value.
+func (cd currencyDelta) IsZero() bool {
+	return cd.Amount.IsZero()
+}
+
+// Add returns the delta increased by v.
+func (cd currencyDelta) Add(v types.Currency) currencyDelta {
+	switch {
+	case !cd.Negative:
+		cd.Amount = cd.Amount.Add(v)
+	case cd.Amount.Cmp(v) > 0:
+		cd.Amount = cd.Amount.Sub(v)
+	default:
+		cd.Amount, cd.Negative = v.Sub(cd.Amount), false
+	}
+	return cd
+}
+
+// Sub returns the delta decreased by v.
+func (cd currencyDelta) Sub(v types.Currency) currencyDelta {
+	return cd.Neg().Add(v).Neg()
+}
+
+// AddDelta returns the sum of the deltas.
+func (cd currencyDelta) AddDelta(v currencyDelta) currencyDelta {
+	if v.Negative {
+		return cd.Sub(v.Amount)
+	}
+	return cd.Add(v.Amount)
+}
+
+// Neg returns the negated delta.
+func (cd currencyDelta) Neg() currencyDelta {
+	cd.Negative = !cd.Negative && !cd.Amount.IsZero()
+	return cd
+}
+
+// Apply adds the delta to v. The returned bool is true if the result would
+// be negative.
+func (cd currencyDelta) Apply(v types.Currency) (types.Currency, bool) {
+	if cd.Negative {
+		return v.SubWithUnderflow(cd.Amount)
+	}
+	return v.Add(cd.Amount), false
+}
+
+// A collateralDelta is the change in the host collateral stats.
+type collateralDelta struct {
+	Locked currencyDelta
+	Risked currencyDelta
+	Burned types.Currency
+}
+
+// A statDelta is the change in the contract stats caused by a single block.
+type statDelta struct {
+	Active     int
+	Valid      int
+	Missed     int
+	Revenue    stats.Values
+	Payout     stats.Values
+	Stored     int64
+	Collateral collateralDelta
+	Burned     stats.Values
+	SiafundTax stats.Values
+	MinerFees  stats.Values
+	Estimates  stats.EstimateCoverage
+	Accrued    stats.Values
+	Reversed   stats.Values
+	// FeeRevenue and RevisionRevenue split the revenue into its contract
+	// fee and revision components.
+	FeeRevenue      stats.Values
+	RevisionRevenue stats.Values
+}
+
+// IsZero returns true if the delta does not change the stats.
+func (sd statDelta) IsZero() bool {
+	return sd.Active == 0 && sd.Valid == 0 && sd.Missed == 0 &&
+		sd.Revenue.IsZero() && sd.Payout.IsZero() && sd.Stored == 0 &&
+		sd.Collateral.Locked.IsZero() && sd.Collateral.Risked.IsZero() && sd.Collateral.Burned.IsZero() &&
+		sd.Burned.IsZero() && sd.SiafundTax.IsZero() && sd.MinerFees.IsZero() &&
+		sd.Estimates == (stats.EstimateCoverage{}) &&
+		sd.Accrued.IsZero() && sd.Reversed.IsZero() &&
+		sd.FeeRevenue.IsZero() && sd.RevisionRevenue.IsZero()
+}
+
+// Apply adds the delta to the contract state.
+func (sd statDelta) Apply(state stats.ContractState) (stats.ContractState, error) {
+	state.Active += sd.Active
+	state.Valid += sd.Valid
+	state.Missed += sd.Missed
+	state.Revenue = state.Revenue.Add(sd.Revenue)
+	state.Payout = state.Payout.Add(sd.Payout)
+
+	stored := int64(state.Stored) + sd.Stored
+	if stored < 0 {
+		return state, fmt.Errorf("stored bytes underflow")
+	}
+	state.Stored = uint64(stored)
+
+	var underflow bool
+	if state.Collateral.Locked, underflow = sd.Collateral.Locked.Apply(state.Collateral.Locked); underflow {
+		return state, fmt.Errorf("locked collateral underflow")
+	} else if state.Collateral.Risked, underflow = sd.Collateral.Risked.Apply(state.Collateral.Risked); underflow {
+		return state, fmt.Errorf("risked collateral underflow")
+	}
+	state.Collateral.Burned = state.Collateral.Burned.Add(sd.Collateral.Burned)
+	state.Burned = state.Burned.Add(sd.Burned)
+	state.SiafundTax = state.SiafundTax.Add(sd.SiafundTax)
+	state.MinerFees = state.MinerFees.Add(sd.MinerFees)
+	state.Estimates.Estimated += sd.Estimates.Estimated
+	state.Estimates.Skipped += sd.Estimates.Skipped
+	state.Estimates.Failed += sd.Estimates.Failed
+	state.Accrued = state.Accrued.Add(sd.Accrued)
+	state.Reversed = state.Reversed.Add(sd.Reversed)
+	state.FeeRevenue = state.FeeRevenue.Add(sd.FeeRevenue)
+	state.RevisionRevenue = state.RevisionRevenue.Add(sd.RevisionRevenue)
+	return state, validateContractState(state)
+}
+
+// Revert subtracts the delta from the contract state.
+func (sd statDelta) Revert(state stats.ContractState) (stats.ContractState, error) {
+	state.Active -= sd.Active
+	state.Valid -= sd.Valid
+	state.Missed -= sd.Missed
+	state.Estimates.Estimated -= sd.Estimates.Estimated
+	state.Estimates.Skipped -= sd.Estimates.Skipped
+	state.Estimates.Failed -= sd.Estimates.Failed
+
+	var underflow bool
+	if state.Revenue, underflow = state.Revenue.SubWithUnderflow(sd.Revenue); underflow {
+		return state, fmt.Errorf("revenue underflow")
+	} else if state.Payout, underflow = state.Payout.SubWithUnderflow(sd.Payout); underflow {
+		return state, fmt.Errorf("payout underflow")
+	}
+
+	stored := int64(state.Stored) - sd.Stored
+	if stored < 0 {
+		return state, fmt.Errorf("stored bytes underflow")
+	}
+	state.Stored = uint64(stored)
+
+	if state.Collateral.Locked, underflow = sd.Collateral.Locked.Neg().Apply(state.Collateral.Locked); underflow {
+		return state, fmt.Errorf("locked collateral underflow")
+	} else if state.Collateral.Risked, underflow = sd.Collateral.Risked.Neg().Apply(state.Collateral.Risked); underflow {
+		return state, fmt.Errorf("risked collateral underflow")
+	} else if state.Collateral.Burned, underflow = state.Collateral.Burned.SubWithUnderflow(sd.Collateral.Burned); underflow {
+		return state, fmt.Errorf("burned collateral underflow")
+	} else if state.Burned, underflow = state.Burned.SubWithUnderflow(sd.Burned); underflow {
+		return state, fmt.Errorf("burned underflow")
+	} else if state.SiafundTax, underflow = state.SiafundTax.SubWithUnderflow(sd.SiafundTax); underflow {
+		return state, fmt.Errorf("siafund tax underflow")
+	} else if state.MinerFees, underflow = state.MinerFees.SubWithUnderflow(sd.MinerFees); underflow {
+		return state, fmt.Errorf("miner fees underflow")
+	} else if state.Accrued, underflow = state.Accrued.SubWithUnderflow(sd.Accrued); underflow {
+		return state, fmt.Errorf("accrued revenue underflow")
+	} else if state.Reversed, underflow = state.Reversed.SubWithUnderflow(sd.Reversed); underflow {
+		return state, fmt.Errorf("reversed revenue underflow")
+	} else if state.FeeRevenue, underflow = state.FeeRevenue.SubWithUnderflow(sd.FeeRevenue); underflow {
+		return state, fmt.Errorf("fee revenue underflow")
+	} else if state.RevisionRevenue, underflow = state.RevisionRevenue.SubWithUnderflow(sd.RevisionRevenue); underflow {
+		return state, fmt.Errorf("revision revenue underflow")
+	}
+	return state, validateContractState(state)
+}
+
+// replace returns the delta with prev's contribution replaced by next's. Only
+// the stats derived from the host funds estimate are replaced: revenue, locked
+// collateral, estimate coverage and accrued, reversed, fee and revision
+// revenue.
+func (sd statDelta) replace(prev, next statDelta) (statDelta, error) {
+	var underflow bool
+	if sd.Revenue, underflow = sd.Revenue.SubWithUnderflow(prev.Revenue); underflow {
+		return sd, fmt.Errorf("revenue underflow")
+	} else if sd.Accrued, underflow = sd.Accrued.SubWithUnderflow(prev.Accrued); underflow {
+		return sd, fmt.Errorf("accrued revenue underflow")
+	} else if sd.Reversed, underflow = sd.Reversed.SubWithUnderflow(prev.Reversed); underflow {
+		return sd, fmt.Errorf("reversed revenue underflow")
+	} else if sd.FeeRevenue, underflow = sd.FeeRevenue.SubWithUnderflow(prev.FeeRevenue); underflow {
+		return sd, fmt.Errorf("fee revenue underflow")
+	} else if sd.RevisionRevenue, underflow = sd.RevisionRevenue.SubWithUnderflow(prev.RevisionRevenue); underflow {
+		return sd, fmt.Errorf("revision revenue underflow")
+	}
+	sd.Revenue = sd.Revenue.Add(next.Revenue)
+	sd.Accrued = sd.Accrued.Add(next.Accrued)
+	sd.Reversed = sd.Reversed.Add(next.Reversed)
+	sd.FeeRevenue = sd.FeeRevenue.Add(next.FeeRevenue)
+	sd.RevisionRevenue = sd.RevisionRevenue.Add(next.RevisionRevenue)
+	sd.Collateral.Locked = sd.Collateral.Locked.AddDelta(prev.Collateral.Locked.Neg()).AddDelta(next.Collateral.Locked)
+	sd.Estimates.Estimated += next.Estimates.Estimated - prev.Estimates.Estimated
+	sd.Estimates.Skipped += next.Estimates.Skipped - prev.Estimates.Skipped
+	sd.Estimates.Failed += next.Estimates.Failed - prev.Estimates.Failed
+	return sd, nil
+}
+
+// args returns the delta's values in the order of statColumns.
+func (sd statDelta) args() []any {
+	return []any{sd.Active, sd.Valid, sd.Missed,
+		sqlCurrency(sd.Payout.SC), sd.Payout.USD, sd.Payout.EUR, sd.Payout.BTC,
+		sqlCurrency(sd.Revenue.SC), sd.Revenue.USD, sd.Revenue.EUR, sd.Revenue.BTC,
+		sd.Stored, sqlCurrencyDelta(sd.Collateral.Locked), sqlCurrencyDelta(sd.Collateral.Risked), sqlCurrency(sd.Collateral.Burned),
+		sqlCurrency(sd.Burned.SC), sd.Burned.USD, sd.Burned.EUR, sd.Burned.BTC,
+		sqlCurrency(sd.SiafundTax.SC), sd.SiafundTax.USD, sd.SiafundTax.EUR, sd.SiafundTax.BTC,
+		sqlCurrency(sd.MinerFees.SC), sd.MinerFees.USD, sd.MinerFees.EUR, sd.MinerFees.BTC,
+		sd.Estimates.Estimated, sd.Estimates.Skipped, sd.Estimates.Failed,
+		sqlCurrency(sd.Accrued.SC), sd.Accrued.USD, sd.Accrued.EUR, sd.Accrued.BTC,
+		sqlCurrency(sd.Reversed.SC), sd.Reversed.USD, sd.Reversed.EUR, sd.Reversed.BTC,
+		sqlCurrency(sd.FeeRevenue.SC), sd.FeeRevenue.USD, sd.FeeRevenue.EUR, sd.FeeRevenue.BTC,
+		sqlCurrency(sd.RevisionRevenue.SC), sd.RevisionRevenue.USD, sd.RevisionRevenue.EUR, sd.RevisionRevenue.BTC}
+}
+
+// dest returns the scan destinations of the delta in the order of
+// statColumns.
+func (sd *statDelta) dest() []any {
+	return []any{&sd.Active, &sd.Valid, &sd.Missed,
+		(*sqlCurrency)(&sd.Payout.SC), &sd.Payout.USD, &sd.Payout.EUR, &sd.Payout.BTC,
+		(*sqlCurrency)(&sd.Revenue.SC), &sd.Revenue.USD, &sd.Revenue.EUR, &sd.Revenue.BTC,
+		&sd.Stored, (*sqlCurrencyDelta)(&sd.Collateral.Locked), (*sqlCurrencyDelta)(&sd.Collateral.Risked), (*sqlCurrency)(&sd.Collateral.Burned),
+		(*sqlCurrency)(&sd.Burned.SC), &sd.Burned.USD, &sd.Burned.EUR, &sd.Burned.BTC,
+		(*sqlCurrency)(&sd.SiafundTax.SC), &sd.SiafundTax.USD, &sd.SiafundTax.EUR, &sd.SiafundTax.BTC,
+		(*sqlCurrency)(&sd.MinerFees.SC), &sd.MinerFees.USD, &sd.MinerFees.EUR, &sd.MinerFees.BTC,
+		&sd.Estimates.Estimated, &sd.Estimates.Skipped, &sd.Estimates.Failed,
+		(*sqlCurrency)(&sd.Accrued.SC), &sd.Accrued.USD, &sd.Accrued.EUR, &sd.Accrued.BTC,
+		(*sqlCurrency)(&sd.Reversed.SC), &sd.Reversed.USD, &sd.Reversed.EUR, &sd.Reversed.BTC,
+		(*sqlCurrency)(&sd.FeeRevenue.SC), &sd.FeeRevenue.USD, &sd.FeeRevenue.EUR, &sd.FeeRevenue.BTC,
+		(*sqlCurrency)(&sd.RevisionRevenue.SC), &sd.RevisionRevenue.USD, &sd.RevisionRevenue.EUR, &sd.RevisionRevenue.BTC}
+}
+
+// stateArgs returns the state's values in the order of statColumns.
+func stateArgs(state stats.ContractState) []any {
+	return []any{state.Active, state.Valid, state.Missed,
+		sqlCurrency(state.Payout.SC), state.Payout.USD, state.Payout.EUR, state.Payout.BTC,
+		sqlCurrency(state.Revenue.SC), state.Revenue.USD, state.Revenue.EUR, state.Revenue.BTC,
+		int64(state.Stored), sqlCurrency(state.Collateral.Locked), sqlCurrency(state.Collateral.Risked), sqlCurrency(state.Collateral.Burned),
+		sqlCurrency(state.Burned.SC), state.Burned.USD, state.Burned.EUR, state.Burned.BTC,
+		sqlCurrency(state.SiafundTax.SC), state.SiafundTax.USD, state.SiafundTax.EUR, state.SiafundTax.BTC,
+		sqlCurrency(state.MinerFees.SC), state.MinerFees.USD, state.MinerFees.EUR, state.MinerFees.BTC,
+		state.Estimates.Estimated, state.Estimates.Skipped, state.Estimates.Failed,
+		sqlCurrency(state.Accrued.SC), state.Accrued.USD, state.Accrued.EUR, state.Accrued.BTC,
+		sqlCurrency(state.Reversed.SC), state.Reversed.USD, state.Reversed.EUR, state.Reversed.BTC,
+		sqlCurrency(state.FeeRevenue.SC), state.FeeRevenue.USD, state.FeeRevenue.EUR, state.FeeRevenue.BTC,
+		sqlCurrency(state.RevisionRevenue.SC), state.RevisionRevenue.USD, state.RevisionRevenue.EUR, state.RevisionRevenue.BTC}
+}
+
+// stateDest returns the scan destinations of the state in the order of
+// statColumns.
+func stateDest(state *stats.ContractState) []any {
+	return []any{&state.Active, &state.Valid, &state.Missed,
+		(*sqlCurrency)(&state.Payout.SC), &state.Payout.USD, &state.Payout.EUR, &state.Payout.BTC,
+		(*sqlCurrency)(&state.Revenue.SC), &state.Revenue.USD, &state.Revenue.EUR, &state.Revenue.BTC,
+		&state.Stored, (*sqlCurrency)(&state.Collateral.Locked), (*sqlCurrency)(&state.Collateral.Risked), (*sqlCurrency)(&state.Collateral.Burned),
+		(*sqlCurrency)(&state.Burned.SC), &state.Burned.USD, &state.Burned.EUR, &state.Burned.BTC,
+		(*sqlCurrency)(&state.SiafundTax.SC), &state.SiafundTax.USD, &state.SiafundTax.EUR, &state.SiafundTax.BTC,
+		(*sqlCurrency)(&state.MinerFees.SC), &state.MinerFees.USD, &state.MinerFees.EUR, &state.MinerFees.BTC,
+		&state.Estimates.Estimated, &state.Estimates.Skipped, &state.Estimates.Failed,
+		(*sqlCurrency)(&state.Accrued.SC), &state.Accrued.USD, &state.Accrued.EUR, &state.Accrued.BTC,
+		(*sqlCurrency)(&state.Reversed.SC), &state.Reversed.USD, &state.Reversed.EUR, &state.Reversed.BTC,
+		(*sqlCurrency)(&state.FeeRevenue.SC), &state.FeeRevenue.USD, &state.FeeRevenue.EUR, &state.FeeRevenue.BTC,
+		(*sqlCurrency)(&state.RevisionRevenue.SC), &state.RevisionRevenue.USD, &state.RevisionRevenue.EUR, &state.RevisionRevenue.BTC}
+}
+
+// statPlaceholders returns the query placeholders for the stat columns,
+// numbered from start.
+func statPlaceholders(start int) string {
+	placeholders := make([]string, statColumnCount)
+	for i := range placeholders {
+		placeholders[i] = "$" + strconv.Itoa(start+i)
+	}
+	return strings.Join(placeholders, ", ")
+}
+
+func validateContractState(state stats.ContractState) error {
+	if state.Active < 0 {
+		return fmt.Errorf("invalid active contract count: %d", state.Active)
+	} else if state.Valid < 0 {
+		return fmt.Errorf("invalid valid contract count: %d", state.Valid)
+	} else if state.Missed < 0 {
+		return fmt.Errorf("invalid missed contract count: %d", state.Missed)
+	} else if state.Estimates.Estimated < 0 || state.Estimates.Skipped < 0 || state.Estimates.Failed < 0 {
+		return fmt.Errorf("invalid estimate counts: %+v", state.Estimates)
+	}
+	return nil
+}
+
+// scanContractState scans the stat columns followed by date_created.
+func scanContractState(row scanner) (state stats.ContractState, err error) {
+	err = row.Scan(append(stateDest(&state), (*sqlTime)(&state.Timestamp))...)
+	return
+}
@@ -10,6 +10,8 @@ import (
 	"time"
 
 	"github.com/mattn/go-sqlite3"
+	"go.sia.tech/core/consensus"
+	"go.sia.tech/host-revenue-api/build"
 	"go.uber.org/zap"
 	"lukechampine.com/frand"
 )
@@ -17,8 +19,12 @@ import (
 type (
 	// A Store is a persistent store that uses a SQL database as its backend.
 	Store struct {
-		db  *sql.DB
-		log *zap.Logger
+		db      *sql.DB
+		log     *zap.Logger
+		network *consensus.Network
+		// confirmations is the number of blocks a proof window or storage
+		// proof must be buried before the payout is recognized.
+		confirmations uint64
 	}
 )
 
@@ -97,18 +103,25 @@ func doTransaction(db *sql.DB, log *zap.Logger, fn func(tx txn) error) error {
 }
 
 // OpenDatabase creates a new SQLite store and initializes the database. If the
-// database does not exist, it is created.
-func OpenDatabase(fp string, log *zap.Logger) (*Store, error) {
-	db, err := sql.Open("sqlite3", sqliteFilepath(fp))
+// database does not exist, it is created. Payouts are recognized once they
+// have the number of confirmations, which must match the number the database
+// was indexed with.
+func OpenDatabase(fp string, confirmations uint64, log *zap.Logger) (*Store, error) {
+	db, err := sql.Open(driverName, sqliteFilepath(fp))
 	if err != nil {
 		return nil, err
 	}
+	network, _ := build.Network()
 	store := &Store{
-		db:  db,
-		log: log,
+		db:      db,
+		log:     log,
+		network: network,
 	}
 	if err := store.init(); err != nil {
 		return nil, fmt.Errorf("failed to initialize database: %w", err)
+	} else if err := store.setConfirmations(confirmations); err != nil {
+		db.Close()
+		return nil, err
 	}
 	return store, nil
 }
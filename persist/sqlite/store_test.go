@@ -13,7 +13,7 @@ import (
 func TestTransactionRetry(t *testing.T) {
 	t.Run("transaction retry", func(t *testing.T) {
 		log := zaptest.NewLogger(t)
-		db, err := OpenDatabase(filepath.Join(t.TempDir(), "test.db"), log)
+		db, err := OpenDatabase(filepath.Join(t.TempDir(), "test.db"), DefaultConfirmations, log)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -30,7 +30,7 @@ func TestTransactionRetry(t *testing.T) {
 		// this should allow for the next transaction to be retried a few times
 		go func() {
 			err := db.transaction(func(tx txn) error {
-				_, err := tx.Exec(`UPDATE global_settings SET host_key=?`, `foo`) // upgrade the transaction to an exclusive lock;
+				_, err := tx.Exec(`UPDATE global_settings SET contracts_height=?`, 1) // upgrade the transaction to an exclusive lock;
 				if err != nil {
 					return err
 				}
@@ -47,7 +47,7 @@ func TestTransactionRetry(t *testing.T) {
 		<-ch // wait for the transaction to start
 
 		err = db.transaction(func(tx txn) error {
-			_, err = tx.Exec(`UPDATE global_settings SET host_key=?`, `bar`) // should fail and be retried
+			_, err = tx.Exec(`UPDATE global_settings SET contracts_height=?`, 2) // should fail and be retried
 			if err != nil {
 				return err
 			}
@@ -62,7 +62,7 @@ func TestTransactionRetry(t *testing.T) {
 
 	t.Run("transaction timeout", func(t *testing.T) {
 		log := zaptest.NewLogger(t)
-		db, err := OpenDatabase(filepath.Join(t.TempDir(), "test.db"), log)
+		db, err := OpenDatabase(filepath.Join(t.TempDir(), "test.db"), DefaultConfirmations, log)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -77,7 +77,7 @@ func TestTransactionRetry(t *testing.T) {
 
 		go func() {
 			err := db.transaction(func(tx txn) error {
-				_, err := tx.Exec(`UPDATE global_settings SET host_key=?`, `foo`) // upgrade the transaction to an exclusive lock;
+				_, err := tx.Exec(`UPDATE global_settings SET contracts_height=?`, 1) // upgrade the transaction to an exclusive lock;
 				if err != nil {
 					return err
 				}
@@ -94,7 +94,7 @@ func TestTransactionRetry(t *testing.T) {
 		<-ch // wait for the transaction to start
 
 		err = db.transaction(func(tx txn) error {
-			_, err := tx.Exec(`UPDATE global_settings SET host_key=?`, `bar`) // should fail and be retried
+			_, err := tx.Exec(`UPDATE global_settings SET contracts_height=?`, 2) // should fail and be retried
 			if err != nil {
 				return err
 			}
@@ -1,20 +1,26 @@
 package sqlite
 
 import (
+	"bytes"
 	"database/sql"
 	"database/sql/driver"
 	"encoding/binary"
 	"encoding/hex"
 	"fmt"
+	"math"
+	"math/big"
 	"time"
 
 	"go.sia.tech/core/types"
 )
 
 type (
-	sqlCurrency types.Currency
-	sqlHash256  [32]byte
-	sqlTime     time.Time
+	sqlCurrency      types.Currency
+	sqlCurrencyDelta currencyDelta
+	sqlFileContract  types.FileContract
+	sqlHash256       [32]byte
+	sqlTime          time.Time
+	sqlUint64        uint64
 
 	sqlNullable[T sql.Scanner] struct {
 		Value T
@@ -71,6 +77,83 @@ func (sc sqlCurrency) Value() (driver.Value, error) {
 	return buf, nil
 }
 
+// Scan implements the sql.Scanner interface.
+func (scd *sqlCurrencyDelta) Scan(src any) error {
+	var str string
+	switch src := src.(type) {
+	case string:
+		str = src
+	case []byte:
+		str = string(src)
+	case int64:
+		str = fmt.Sprint(src)
+	default:
+		return fmt.Errorf("cannot scan %T to currency delta", src)
+	}
+
+	v, ok := new(big.Int).SetString(str, 10)
+	if !ok {
+		return fmt.Errorf("cannot parse %q as currency delta", str)
+	}
+	scd.Negative = v.Sign() < 0
+	v.Abs(v)
+	if v.BitLen() > 128 {
+		return fmt.Errorf("currency delta %q overflows", str)
+	}
+	scd.Amount = types.NewCurrency(new(big.Int).And(v, new(big.Int).SetUint64(math.MaxUint64)).Uint64(), new(big.Int).Rsh(v, 64).Uint64())
+	return nil
+}
+
+// Value implements the driver.Valuer interface. The delta is stored as a
+// signed decimal string of hastings.
+func (scd sqlCurrencyDelta) Value() (driver.Value, error) {
+	v := scd.Amount.Big()
+	if scd.Negative {
+		v.Neg(v)
+	}
+	return v.String(), nil
+}
+
+// Scan implements the sql.Scanner interface.
+func (sfc *sqlFileContract) Scan(src any) error {
+	buf, ok := src.([]byte)
+	if !ok {
+		return fmt.Errorf("cannot scan %T to FileContract", src)
+	}
+
+	d := types.NewBufDecoder(buf)
+	(*types.FileContract)(sfc).DecodeFrom(d)
+	return d.Err()
+}
+
+// Value implements the driver.Valuer interface. The contract is stored in its
+// binary encoding.
+func (sfc sqlFileContract) Value() (driver.Value, error) {
+	var buf bytes.Buffer
+	e := types.NewEncoder(&buf)
+	types.FileContract(sfc).EncodeTo(e)
+	if err := e.Flush(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Scan implements the sql.Scanner interface.
+func (su *sqlUint64) Scan(src any) error {
+	v, ok := src.(int64)
+	if !ok {
+		return fmt.Errorf("cannot scan %T to uint64", src)
+	}
+	*su = sqlUint64(v)
+	return nil
+}
+
+// Value implements the driver.Valuer interface. The value is stored as its
+// two's complement since SQLite does not support unsigned integers.
+func (su sqlUint64) Value() (driver.Value, error) {
+	return int64(su), nil
+}
+
 func (st *sqlTime) Scan(src any) error {
 	switch src := src.(type) {
 	case int64:
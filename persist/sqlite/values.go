@@ -0,0 +1,20 @@
+package sqlite
+
+import (
+	"github.com/shopspring/decimal"
+	"go.sia.tech/core/types"
+	"go.sia.tech/host-revenue-api/stats"
+)
+
+// fiatValues values siacoins in every currency at the exchange rates. All
+// siacoin amounts are converted by this function so that each currency is
+// valued the same way.
+func fiatValues(v types.Currency, usdRate, eurRate, btcRate decimal.Decimal) stats.Values {
+	sc := decimal.NewFromBigInt(v.Big(), -24)
+	return stats.Values{
+		SC:  v,
+		USD: sc.Mul(usdRate),
+		EUR: sc.Mul(eurRate),
+		BTC: sc.Mul(btcRate),
+	}
+}
@@ -0,0 +1,38 @@
+package sqlite
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"go.sia.tech/core/types"
+)
+
+func TestFiatValues(t *testing.T) {
+	usdRate := decimal.RequireFromString("0.004")
+	eurRate := decimal.RequireFromString("0.0037")
+	btcRate := decimal.RequireFromString("0.00000012")
+
+	tests := []struct {
+		value         types.Currency
+		usd, eur, btc string
+	}{
+		{types.ZeroCurrency, "0", "0", "0"},
+		{types.Siacoins(1000), "4", "3.7", "0.00012"},
+		{types.Siacoins(1).Div64(4), "0.001", "0.000925", "0.00000003"},
+		{types.NewCurrency64(1), "0.000000000000000000000000004", "0.0000000000000000000000000037", "0.00000000000000000000000000000012"},
+	}
+
+	for _, test := range tests {
+		v := fiatValues(test.value, usdRate, eurRate, btcRate)
+		if !v.SC.Equals(test.value) {
+			t.Fatalf("expected %d SC, got %d", test.value, v.SC)
+		} else if !v.USD.Equal(decimal.RequireFromString(test.usd)) {
+			t.Fatalf("%d: expected $%s, got $%s", test.value, test.usd, v.USD)
+		} else if !v.EUR.Equal(decimal.RequireFromString(test.eur)) {
+			t.Fatalf("%d: expected €%s, got €%s", test.value, test.eur, v.EUR)
+		} else if !v.BTC.Equal(decimal.RequireFromString(test.btc)) {
+			// every currency must be valued, not just the fiat ones
+			t.Fatalf("%d: expected %s BTC, got %s BTC", test.value, test.btc, v.BTC)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package stats
 
 import (
+	"errors"
 	"time"
 
 	"github.com/shopspring/decimal"
@@ -8,6 +9,13 @@ import (
 	"go.uber.org/zap"
 )
 
+// contract statuses
+const (
+	ContractStatusActive = "active"
+	ContractStatusValid  = "valid"
+	ContractStatusMissed = "missed"
+)
+
 const (
 	PeriodDaily   = "daily"
 	PeriodHourly  = "hourly"
@@ -15,6 +23,71 @@ const (
 	PeriodMonthly = "monthly"
 )
 
+// host leaderboard sort orders
+const (
+	HostSortRevenue      = "revenue"
+	HostSortContracts    = "contracts"
+	HostSortSuccessRatio = "successRatio"
+)
+
+// initial revenue estimation statuses
+const (
+	EstimateStatusEstimated = "estimated"
+	// EstimateStatusSkipped is used for contracts formed in transactions with
+	// multiple contracts
+	EstimateStatusSkipped = "skipped"
+	EstimateStatusFailed  = "failed"
+)
+
+// host fund estimation methods
+const (
+	FundsEstimateAddress    = "address"
+	FundsEstimatePositional = "positional"
+)
+
+// revenue accounting bases
+const (
+	// BasisCash recognizes revenue when the contract payout matures.
+	BasisCash = "cash"
+	// BasisAccrual recognizes revenue as it is earned.
+	BasisAccrual = "accrual"
+)
+
+// accrual ledger entry kinds
+const (
+	AccrualFormation = "formation"
+	AccrualRevision  = "revision"
+	AccrualReversal  = "reversal"
+)
+
+// contract event kinds
+const (
+	EventContractFormed  = "formed"
+	EventContractRevised = "revised"
+	EventProofSubmitted  = "proofSubmitted"
+	EventProofReverted   = "proofReverted"
+	EventMaturedValid    = "maturedValid"
+	EventMaturedMissed   = "maturedMissed"
+	// EventBlockReverted is recorded when a block is reverted. Events
+	// previously recorded for the block are no longer part of the chain.
+	EventBlockReverted = "blockReverted"
+)
+
+// contract distribution kinds
+const (
+	// DistributionDuration buckets contracts by the number of blocks from
+	// formation to the end of the proof window.
+	DistributionDuration = "duration"
+	// DistributionSize buckets contracts by filesize in bytes.
+	DistributionSize = "size"
+	// DistributionPayout buckets contracts by the host's payout in whole
+	// siacoins.
+	DistributionPayout = "payout"
+)
+
+// ErrNotFound is returned when a requested item is not indexed.
+var ErrNotFound = errors.New("not found")
+
 type (
 	Contract struct {
 		ID                   types.FileContractID
@@ -28,6 +101,11 @@ type (
 		InitialMissedRevenue types.Currency
 		ProofHeight          uint64
 		ExpirationHeight     uint64
+		HostAddress          types.Address
+		Filesize             uint64
+		HostFunds            types.Currency
+		VoidPayout           types.Currency
+		SiafundTax           types.Currency
 	}
 
 	Values struct {
@@ -37,18 +115,286 @@ type (
 		BTC decimal.Decimal `json:"btc"`
 	}
 
+	// EstimateCoverage is the number of contracts whose initial revenue was
+	// estimated, skipped or could not be estimated. Skipped and failed
+	// contracts have no initial revenue, so revenue is a lower bound.
+	EstimateCoverage struct {
+		Estimated int `json:"estimated"`
+		Skipped   int `json:"skipped"`
+		Failed    int `json:"failed"`
+	}
+
+	// Collateral is the host collateral in file contracts.
+	Collateral struct {
+		// Locked is the host funds in active contracts.
+		Locked types.Currency `json:"locked"`
+		// Risked is the difference between the valid and missed host
+		// payouts of active contracts.
+		Risked types.Currency `json:"risked"`
+		// Burned is the host collateral sent to the void by contracts that
+		// missed their storage proof.
+		Burned types.Currency `json:"burned"`
+	}
+
 	ContractState struct {
-		Active    int       `json:"active"`
-		Valid     int       `json:"valid"`
-		Missed    int       `json:"missed"`
-		Revenue   Values    `json:"revenue"`
-		Payout    Values    `json:"payout"`
+		Active  int    `json:"active"`
+		Valid   int    `json:"valid"`
+		Missed  int    `json:"missed"`
+		Revenue Values `json:"revenue"`
+		// FeeRevenue is the part of the revenue earned from the contract
+		// fees charged at formation or renewal.
+		FeeRevenue Values `json:"feeRevenue"`
+		// RevisionRevenue is the part of the revenue earned from storage and
+		// bandwidth paid for by revising the contract.
+		RevisionRevenue Values `json:"revisionRevenue"`
+		Payout          Values `json:"payout"`
+		// Stored is the number of bytes stored under active contracts.
+		Stored     uint64     `json:"stored"`
+		Collateral Collateral `json:"collateral"`
+		// Burned is the siacoins sent to the void by contracts that missed
+		// their storage proof, valued at the time they were burned.
+		Burned Values `json:"burned"`
+		// SiafundTax is the tax paid to the siafund pool by contracts at
+		// formation, valued at the time they were formed.
+		SiafundTax Values `json:"siafundTax"`
+		// MinerFees is the miner fees paid by transactions forming
+		// contracts, valued at the time they were paid.
+		MinerFees Values `json:"minerFees"`
+		// Estimates is the coverage of the initial revenue estimates of
+		// contracts formed so far.
+		Estimates EstimateCoverage `json:"estimates"`
+		// Accrued is the revenue recognized as it is earned: the initial
+		// revenue when a contract is formed and the host payout increase of
+		// each revision when it is confirmed, valued at the time.
+		Accrued Values `json:"accruedRevenue"`
+		// Reversed is the accrued revenue of contracts that missed their
+		// storage proof, reversed when they were resolved.
+		Reversed Values `json:"reversedRevenue"`
+		// Confirmations is the number of blocks payouts were buried before
+		// they were recognized in the stats.
+		Confirmations uint64    `json:"confirmations"`
+		Timestamp     time.Time `json:"timestamp"`
+	}
+
+	// A ContractRevision is a confirmed revision of a file contract.
+	ContractRevision struct {
+		RevisionNumber uint64         `json:"revisionNumber"`
+		BlockID        types.BlockID  `json:"blockID"`
+		Height         uint64         `json:"height"`
+		ValidPayout    types.Currency `json:"validPayout"`
+		MissedPayout   types.Currency `json:"missedPayout"`
+		VoidPayout     types.Currency `json:"voidPayout"`
+		Filesize       uint64         `json:"filesize"`
+	}
+
+	// A ContractLifecycle is the history of a file contract as seen by the
+	// indexer.
+	ContractLifecycle struct {
+		ID          types.FileContractID `json:"id"`
+		Status      string               `json:"status"`
+		HostAddress *types.Address       `json:"hostAddress,omitempty"`
+
+		FormationBlockID types.BlockID `json:"formationBlockID"`
+		FormationHeight  uint64        `json:"formationHeight"`
+		ExpirationHeight uint64        `json:"expirationHeight"`
+
+		ProofBlockID      *types.BlockID `json:"proofBlockID,omitempty"`
+		ProofHeight       uint64         `json:"proofHeight,omitempty"`
+		ResolutionBlockID *types.BlockID `json:"resolutionBlockID,omitempty"`
+		ResolutionHeight  uint64         `json:"resolutionHeight,omitempty"`
+
+		InitialValidPayout   types.Currency `json:"initialValidPayout"`
+		InitialMissedPayout  types.Currency `json:"initialMissedPayout"`
+		InitialValidRevenue  types.Currency `json:"initialValidRevenue"`
+		InitialMissedRevenue types.Currency `json:"initialMissedRevenue"`
+		HostFunds            types.Currency `json:"hostFunds"`
+		// EstimateStatus is the outcome of estimating the initial revenue.
+		EstimateStatus string `json:"estimateStatus,omitempty"`
+		// HostFundsMethod is the method used to estimate the host's funds. It
+		// is empty if the funds could not be estimated.
+		HostFundsMethod string `json:"hostFundsMethod,omitempty"`
+		// EstimatorVersion is the version of the estimator used to
+		// estimate the host's funds.
+		EstimatorVersion int            `json:"estimatorVersion"`
+		ValidPayout      types.Currency `json:"validPayout"`
+		MissedPayout     types.Currency `json:"missedPayout"`
+		VoidPayout       types.Currency `json:"voidPayout"`
+		SiafundTax       types.Currency `json:"siafundTax"`
+		InitialFilesize  uint64         `json:"initialFilesize"`
+		Filesize         uint64         `json:"filesize"`
+
+		// RenewedFrom and RenewedTo link the contract to the contracts it
+		// renewed and was renewed by
+		RenewedFrom *types.FileContractID `json:"renewedFrom,omitempty"`
+		RenewedTo   *types.FileContractID `json:"renewedTo,omitempty"`
+
+		Revisions []ContractRevision `json:"revisions"`
+
+		// Revenue, Payout and Burned are only set once the contract is
+		// resolved
+		Revenue *Values `json:"revenue,omitempty"`
+		Payout  *Values `json:"payout,omitempty"`
+		Burned  *Values `json:"burned,omitempty"`
+	}
+
+	// A ContractRenewal links a renewed contract to the contract that
+	// renewed it.
+	ContractRenewal struct {
+		RenewedFrom types.FileContractID `json:"renewedFrom"`
+		RenewedTo   types.FileContractID `json:"renewedTo"`
+		BlockID     types.BlockID        `json:"blockID"`
+		Height      uint64               `json:"height"`
+	}
+
+	// A ValueSnapshot is the cumulative value of a metric at a point in
+	// time.
+	ValueSnapshot struct {
+		Values
 		Timestamp time.Time `json:"timestamp"`
 	}
 
+	// PendingRevenue is the revenue of active contracts that has not been
+	// realized yet, valued at the current exchange rate.
+	PendingRevenue struct {
+		Active  int    `json:"active"`
+		Revenue Values `json:"revenue"`
+		// Confirmations is the payout confirmation depth, see ContractState.
+		Confirmations uint64    `json:"confirmations"`
+		Timestamp     time.Time `json:"timestamp"`
+	}
+
+	// A RevenueForecast is the revenue expected from the active contracts
+	// expiring on a day, valued at the current exchange rate.
+	RevenueForecast struct {
+		Contracts int    `json:"contracts"`
+		Revenue   Values `json:"revenue"`
+		// Confirmations is the payout confirmation depth, see ContractState.
+		Confirmations uint64    `json:"confirmations"`
+		Timestamp     time.Time `json:"timestamp"`
+	}
+
+	// A ContractEvent is a change to a file contract observed by the
+	// indexer. Events are only appended, reorgs are recorded as new events.
+	ContractEvent struct {
+		// ID is the cursor of the event in the feed.
+		ID   uint64 `json:"id"`
+		Kind string `json:"kind"`
+		// ContractID is not set for reverted blocks.
+		ContractID *types.FileContractID `json:"contractID,omitempty"`
+		BlockID    types.BlockID         `json:"blockID"`
+		Height     uint64                `json:"height"`
+		Timestamp  time.Time             `json:"timestamp"`
+		// ValidPayout and MissedPayout are the host's payouts after the
+		// event.
+		ValidPayout  types.Currency `json:"validPayout"`
+		MissedPayout types.Currency `json:"missedPayout"`
+		// Revenue and Payout are only set when a contract matures.
+		Revenue Values `json:"revenue"`
+		Payout  Values `json:"payout"`
+		// Confirmations is the payout confirmation depth, see ContractState.
+		Confirmations uint64 `json:"confirmations"`
+	}
+
+	// A BlockSummary is an indexed block, the contracts it changed and its
+	// contribution to the contract stats.
+	BlockSummary struct {
+		ID        types.BlockID `json:"id"`
+		Height    uint64        `json:"height"`
+		Timestamp time.Time     `json:"timestamp"`
+
+		Formed        []types.FileContractID `json:"formed"`
+		Revised       []types.FileContractID `json:"revised"`
+		Proven        []types.FileContractID `json:"proven"`
+		MaturedValid  []types.FileContractID `json:"maturedValid"`
+		MaturedMissed []types.FileContractID `json:"maturedMissed"`
+
+		// Revenue and Payout are the revenue and payouts of the contracts
+		// that matured in the block.
+		Revenue Values `json:"revenue"`
+		Payout  Values `json:"payout"`
+		// Confirmations is the payout confirmation depth, see ContractState.
+		Confirmations uint64 `json:"confirmations"`
+	}
+
+	// A DistributionBucket is the contracts with a duration, size or payout
+	// in [Min, Max). Bucket bounds are powers of two.
+	DistributionBucket struct {
+		Min uint64 `json:"min"`
+		Max uint64 `json:"max"`
+
+		Active int `json:"active"`
+		Valid  int `json:"valid"`
+		Missed int `json:"missed"`
+		// Revenue is the revenue of the resolved contracts, valued at the
+		// time they were resolved.
+		Revenue Values `json:"revenue"`
+		// PendingRevenue is the revenue expected from the active contracts,
+		// valued at the current exchange rate.
+		PendingRevenue Values `json:"pendingRevenue"`
+		// Confirmations is the payout confirmation depth, see ContractState.
+		Confirmations uint64 `json:"confirmations"`
+	}
+
+	// A StoragePrice is the storage price per TB-month implied by the revision
+	// revenue of the valid contracts resolved in a period. Each currency's
+	// percentiles are calculated separately.
+	StoragePrice struct {
+		Contracts int    `json:"contracts"`
+		P10       Values `json:"p10"`
+		P25       Values `json:"p25"`
+		Median    Values `json:"median"`
+		P75       Values `json:"p75"`
+		P90       Values `json:"p90"`
+		// Confirmations is the payout confirmation depth, see ContractState.
+		Confirmations uint64    `json:"confirmations"`
+		Timestamp     time.Time `json:"timestamp"`
+	}
+
+	// A ProofPeriod is the contracts that matured valid or missed in a
+	// period.
+	ProofPeriod struct {
+		Valid  int `json:"valid"`
+		Missed int `json:"missed"`
+		// SuccessRatio is the ratio of valid contracts to matured contracts.
+		// It is zero if no contracts matured in the period.
+		SuccessRatio float64 `json:"successRatio"`
+		// Confirmations is the payout confirmation depth, see ContractState.
+		Confirmations uint64    `json:"confirmations"`
+		Timestamp     time.Time `json:"timestamp"`
+	}
+
+	// A HostRevenue is a host's earnings from the contracts resolved in a
+	// window.
+	HostRevenue struct {
+		Address      types.Address `json:"address"`
+		Revenue      Values        `json:"revenue"`
+		Valid        int           `json:"valid"`
+		Missed       int           `json:"missed"`
+		SuccessRatio float64       `json:"successRatio"`
+		// Confirmations is the payout confirmation depth, see ContractState.
+		Confirmations uint64 `json:"confirmations"`
+	}
+
 	Store interface {
 		Metrics(time.Time) (ContractState, error)
+		MetricsAtHeight(height uint64) (ContractState, error)
 		Periods(start, end time.Time, period string) ([]ContractState, error)
+		ProofPeriods(start, end time.Time, period string) ([]ProofPeriod, error)
+		Contract(types.FileContractID) (ContractLifecycle, error)
+		ContractRenewals(types.FileContractID) ([]ContractRenewal, error)
+		PendingRevenue() (PendingRevenue, error)
+		RevenueForecast(days int) ([]RevenueForecast, error)
+		Events(since uint64, limit int) ([]ContractEvent, error)
+		Block(id types.BlockID) (BlockSummary, error)
+		BlockAtHeight(height uint64) (BlockSummary, error)
+
+		HostMetrics(addr types.Address, timestamp time.Time) (ContractState, error)
+		HostPeriods(addr types.Address, start, end time.Time, period string) ([]ContractState, error)
+		HostProofPeriods(addr types.Address, start, end time.Time, period string) ([]ProofPeriod, error)
+		Hosts(start, end time.Time, sort string, limit, offset int) ([]HostRevenue, error)
+
+		Distribution(kind string, start, end time.Time) ([]DistributionBucket, error)
+		StoragePrices(start, end time.Time, period string) ([]StoragePrice, error)
 	}
 
 	// A Provider indexes stats on the current state of the Sia network.
@@ -68,14 +414,122 @@ func (v Values) Add(b Values) Values {
 	}
 }
 
+// SubWithUnderflow subtracts b from v. The returned bool is true if any
+// of the values underflowed.
+func (v Values) SubWithUnderflow(b Values) (Values, bool) {
+	sc, underflow := v.SC.SubWithUnderflow(b.SC)
+	r := Values{
+		SC:  sc,
+		USD: v.USD.Sub(b.USD),
+		EUR: v.EUR.Sub(b.EUR),
+		BTC: v.BTC.Sub(b.BTC),
+	}
+	return r, underflow || r.USD.IsNegative() || r.EUR.IsNegative() || r.BTC.IsNegative()
+}
+
+// IsZero returns true if all of the values are zero.
+func (v Values) IsZero() bool {
+	return v.SC.IsZero() && v.USD.IsZero() && v.EUR.IsZero() && v.BTC.IsZero()
+}
+
+// AccrualRevenue returns the accrued revenue less the reversed revenue.
+func (cs ContractState) AccrualRevenue() Values {
+	v, _ := cs.Accrued.SubWithUnderflow(cs.Reversed)
+	return v
+}
+
 func (p *Provider) Metrics(timestamp time.Time) (ContractState, error) {
 	return p.store.Metrics(timestamp)
 }
 
+// MetricsAtHeight returns the contract stats as of the block at the height.
+func (p *Provider) MetricsAtHeight(height uint64) (ContractState, error) {
+	return p.store.MetricsAtHeight(height)
+}
+
 func (p *Provider) Periods(start, end time.Time, periods string) ([]ContractState, error) {
 	return p.store.Periods(start, end, periods)
 }
 
+// ProofPeriods returns the contracts that matured valid or missed in each
+// period between start and end.
+func (p *Provider) ProofPeriods(start, end time.Time, period string) ([]ProofPeriod, error) {
+	return p.store.ProofPeriods(start, end, period)
+}
+
+// Contract returns the lifecycle of a file contract.
+func (p *Provider) Contract(id types.FileContractID) (ContractLifecycle, error) {
+	return p.store.Contract(id)
+}
+
+// ContractRenewals returns the renewal chain of the contract.
+func (p *Provider) ContractRenewals(id types.FileContractID) ([]ContractRenewal, error) {
+	return p.store.ContractRenewals(id)
+}
+
+// PendingRevenue returns the revenue of active contracts that has not been
+// realized yet.
+func (p *Provider) PendingRevenue() (PendingRevenue, error) {
+	return p.store.PendingRevenue()
+}
+
+// RevenueForecast returns the revenue expected from active contracts
+// expiring on each of the next days.
+func (p *Provider) RevenueForecast(days int) ([]RevenueForecast, error) {
+	return p.store.RevenueForecast(days)
+}
+
+// Events returns up to limit contract events recorded after the cursor.
+func (p *Provider) Events(since uint64, limit int) ([]ContractEvent, error) {
+	return p.store.Events(since, limit)
+}
+
+// Block returns the summary of the block with the ID.
+func (p *Provider) Block(id types.BlockID) (BlockSummary, error) {
+	return p.store.Block(id)
+}
+
+// BlockAtHeight returns the summary of the block at the height.
+func (p *Provider) BlockAtHeight(height uint64) (BlockSummary, error) {
+	return p.store.BlockAtHeight(height)
+}
+
+// HostMetrics returns the contract stats of the host with the payout address
+// at the timestamp.
+func (p *Provider) HostMetrics(addr types.Address, timestamp time.Time) (ContractState, error) {
+	return p.store.HostMetrics(addr, timestamp)
+}
+
+// HostPeriods returns the contract stats of the host with the payout address
+// for each period between start and end.
+func (p *Provider) HostPeriods(addr types.Address, start, end time.Time, period string) ([]ContractState, error) {
+	return p.store.HostPeriods(addr, start, end, period)
+}
+
+// HostProofPeriods returns the contracts of the host with the payout address
+// that matured valid or missed in each period between start and end.
+func (p *Provider) HostProofPeriods(addr types.Address, start, end time.Time, period string) ([]ProofPeriod, error) {
+	return p.store.HostProofPeriods(addr, start, end, period)
+}
+
+// Hosts returns the hosts ranked by their earnings from contracts resolved
+// between start and end.
+func (p *Provider) Hosts(start, end time.Time, sort string, limit, offset int) ([]HostRevenue, error) {
+	return p.store.Hosts(start, end, sort, limit, offset)
+}
+
+// Distribution returns the active contracts and the contracts resolved
+// between start and end bucketed by the kind.
+func (p *Provider) Distribution(kind string, start, end time.Time) ([]DistributionBucket, error) {
+	return p.store.Distribution(kind, start, end)
+}
+
+// StoragePrices returns the implied storage price per TB-month of the
+// contracts resolved in each period between start and end.
+func (p *Provider) StoragePrices(start, end time.Time, period string) ([]StoragePrice, error) {
+	return p.store.StoragePrices(start, end, period)
+}
+
 // NewProvider creates a new Provider.
 func NewProvider(s Store, log *zap.Logger) (*Provider, error) {
 	p := &Provider{